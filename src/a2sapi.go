@@ -4,10 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/syncore/a2sapi/src/config"
 	"github.com/syncore/a2sapi/src/constants"
 	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/logger"
 	"github.com/syncore/a2sapi/src/steam"
 	"github.com/syncore/a2sapi/src/steam/filters"
 	"github.com/syncore/a2sapi/src/util"
@@ -18,12 +20,16 @@ var (
 	doConfig       bool
 	useDebugConfig bool
 	runSilent      bool
+	doMigrate      bool
+	doDBStatus     bool
 )
 
 const (
-	configFlag = "config"
-	debugFlag  = "debug"
-	silentFlag = "silent"
+	configFlag   = "config"
+	debugFlag    = "debug"
+	silentFlag   = "silent"
+	migrateFlag  = "migrate"
+	dbStatusFlag = "db-status"
 )
 
 func init() {
@@ -31,6 +37,10 @@ func init() {
 	flag.BoolVar(&useDebugConfig, debugFlag, false, "Use debug mode configuration file")
 	flag.BoolVar(&runSilent, silentFlag, false,
 		"Launch without displaying startup information")
+	flag.BoolVar(&doMigrate, migrateFlag, false,
+		"Apply the pending server database migrations and exit")
+	flag.BoolVar(&doDBStatus, dbStatusFlag, false,
+		"Display the server database's schema version and migrations and exit")
 }
 
 func main() {
@@ -47,16 +57,24 @@ func main() {
 	if useDebugConfig {
 		config.CreateDebugConfig()
 		constants.IsDebug = true
-		launch(true)
-	} else {
-		launch(false)
 	}
-}
 
-func launch(isDebug bool) {
-	if !util.FileExists(constants.GameFileFullPath) {
-		filters.DumpDefaultGames()
+	if doMigrate || doDBStatus {
+		loadConfig(useDebugConfig)
+		if doMigrate {
+			migrateDB()
+		} else {
+			printDBStatus()
+		}
+		os.Exit(0)
 	}
+
+	launch(useDebugConfig)
+}
+
+// loadConfig initializes the application-wide configuration, exiting if there is
+// no configuration file.
+func loadConfig(isDebug bool) {
 	if !isDebug {
 		if !util.FileExists(constants.ConfigFilePath) {
 			fmt.Printf("Could not read configuration file '%s' in the '%s' directory.\n",
@@ -68,6 +86,18 @@ func launch(isDebug bool) {
 	}
 	// Initialize the application-wide configuration
 	config.InitConfig()
+	// Open the log sinks before anything is logged
+	if err := logger.Configure(config.Config); err != nil {
+		fmt.Printf("Invalid logging configuration: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func launch(isDebug bool) {
+	if !util.FileExists(constants.GameFileFullPath) {
+		filters.DumpDefaultGames()
+	}
+	loadConfig(isDebug)
 	// Initialize the application-wide database connections (panic on failure)
 	db.InitDBs()
 
@@ -76,21 +106,40 @@ func launch(isDebug bool) {
 	}
 
 	if config.Config.SteamConfig.AutoQueryMaster {
-		autoQueryGame := filters.GetGameByName(
-			config.Config.SteamConfig.AutoQueryGame)
-		if autoQueryGame == filters.GameUnspecified {
-			fmt.Println("Invalid game specified for automatic timed query!")
-			fmt.Printf(
-				"You may need to delete: '%s' and/or recreate the config with: %s --%s",
-				constants.GameFileFullPath, os.Args[0], configFlag)
+		var gameFilters []filters.Filter
+		for _, g := range config.Config.SteamConfig.AutoQueryGames {
+			filter, err := g.GetFilter()
+			if err != nil {
+				fmt.Printf("Invalid game specified for automatic timed query: %s\n", err)
+				fmt.Printf(
+					"You may need to delete: '%s' and/or recreate the config with: %s --%s",
+					constants.GameFileFullPath, os.Args[0], configFlag)
+				os.Exit(1)
+			}
+			gameFilters = append(gameFilters, filter)
+		}
+		if len(gameFilters) == 0 {
+			fmt.Println("No games specified for automatic timed query!")
+			fmt.Printf("You may need to recreate the config with: %s --%s",
+				os.Args[0], configFlag)
 			os.Exit(1)
 		}
-		// HTTP server + API + Steam auto-querier
+		// Serve the most recent lists until the first retrievals complete
+		for _, g := range config.Config.SteamConfig.AutoQueryGames {
+			steam.LoadMasterListSnapshot(g.Name,
+				config.Config.SteamConfig.MaxSnapshotAge)
+		}
+		// HTTP server + API + Steam auto-querier (one per game)
 		go web.Start(runSilent)
-		filter := filters.NewFilter(autoQueryGame, filters.SrAll, nil)
 		stop := make(chan bool, 1)
-		go steam.StartMasterRetrieval(stop, filter, 7,
-			config.Config.SteamConfig.TimeBetweenMasterQueries)
+		for i, filter := range gameFilters {
+			go steam.StartMasterRetrieval(stop, filter, 7,
+				config.Config.SteamConfig.AutoQueryGames[i].TimeBetweenMasterQueries)
+		}
+		// Retire the IDs of servers that have not been seen in the retention period
+		if days := config.Config.SteamConfig.ServerIDRetention; days > 0 {
+			go db.StartServerPruning(stop, time.Duration(days)*24*time.Hour)
+		}
 		<-stop
 	} else {
 		// HTTP server + API standalone
@@ -98,6 +147,40 @@ func launch(isDebug bool) {
 	}
 }
 
+func migrateDB() {
+	n, err := db.MigrateServerDB()
+	if err != nil {
+		fmt.Printf("Unable to migrate the server database: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Applied %d server database migration(s)\n", n)
+}
+
+func printDBStatus() {
+	status, err := db.ServerDBStatus()
+	if err != nil {
+		fmt.Printf("Unable to read the server database's schema version: %s\n", err)
+		os.Exit(1)
+	}
+	version, pending := 0, 0
+	for _, m := range status {
+		if m.Applied == 0 {
+			pending++
+		} else {
+			version = m.Version
+		}
+	}
+	fmt.Printf("Server database schema version: %d (%d pending migration(s))\n",
+		version, pending)
+	for _, m := range status {
+		state := "pending"
+		if m.Applied != 0 {
+			state = "applied " + time.Unix(m.Applied, 0).Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-30s  %s\n", m.Version, state, m.Description)
+	}
+}
+
 func printStartInfo() {
 	fmt.Printf("%s\n", constants.AppInfo)
 	if useDebugConfig {
@@ -105,10 +188,11 @@ func printStartInfo() {
 	}
 	if config.Config.SteamConfig.AutoQueryMaster {
 		fmt.Println("Automatic timed master server queries: enabled")
-		fmt.Printf("Automatic timed master server queries every %d seconds\n",
-			config.Config.SteamConfig.TimeBetweenMasterQueries)
-		fmt.Printf("Automatic timed master server query game: %s\n",
-			config.Config.SteamConfig.AutoQueryGame)
+		for _, g := range config.Config.SteamConfig.AutoQueryGames {
+			fmt.Printf(
+				"Automatic timed master server query game: %s (every %d seconds, region: %s)\n",
+				g.Name, g.TimeBetweenMasterQueries, g.Region)
+		}
 		fmt.Printf("Automatic timed master server query max hosts to receive: %d\n",
 			config.Config.SteamConfig.MaximumHostsToReceive)
 	} else {
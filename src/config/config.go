@@ -6,6 +6,8 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"runtime"
 
@@ -25,10 +27,12 @@ var Config *Cfg
 
 // Cfg represents logging, steam-related, and API-related options.
 type Cfg struct {
-	LogConfig   CfgLog   `json:"logConfig"`
-	SteamConfig CfgSteam `json:"steamConfig"`
-	WebConfig   CfgWeb   `json:"webConfig"`
-	DebugConfig CfgDebug `json:"debugConfig"`
+	LogConfig     CfgLog     `json:"logConfig"`
+	SteamConfig   CfgSteam   `json:"steamConfig"`
+	HistoryConfig CfgHistory `json:"historyConfig"`
+	WebConfig     CfgWeb     `json:"webConfig"`
+	DBConfig      CfgDB      `json:"dbConfig"`
+	DebugConfig   CfgDebug   `json:"debugConfig"`
 }
 
 func getNewLineForOS() string {
@@ -52,10 +56,8 @@ func InitConfig() {
 the --config switch. Error: %s`, err))
 	}
 	defer f.Close()
-	r := bufio.NewReader(f)
-	d := json.NewDecoder(r)
-	cfg := &Cfg{}
-	if err := d.Decode(cfg); err != nil {
+	cfg, err := readConfig(bufio.NewReader(f))
+	if err != nil {
 		panic(fmt.Sprintf(`
 "Error decoding config file. You might need to recreate it by using
 the --config switch. Error: %s`, err))
@@ -64,6 +66,56 @@ the --config switch. Error: %s`, err))
 	Config = cfg
 }
 
+// readConfig decodes a configuration file, upgrading the settings of files that
+// were created by older versions.
+func readConfig(r io.Reader) (*Cfg, error) {
+	cfg := &Cfg{}
+	// set before decoding so that files without the key get the default while an
+	// explicit 0 still disables loading snapshots
+	cfg.SteamConfig.MaxSnapshotAge = defaultMaxSnapshotAge
+	if err := json.NewDecoder(r).Decode(cfg); err != nil {
+		return nil, err
+	}
+	cfg.SteamConfig.upgradeLegacyGame()
+	cfg.SteamConfig.applyDefaults()
+	return cfg, nil
+}
+
+const redactedValue = "REDACTED"
+
+// Redacted returns a copy of the configuration whose secrets are replaced, i.e.
+// for display.
+func (c *Cfg) Redacted() Cfg {
+	r := *c
+	if r.SteamConfig.SteamWebAPIKey != "" {
+		r.SteamConfig.SteamWebAPIKey = redactedValue
+	}
+	if r.WebConfig.AdminAPIKey != "" {
+		r.WebConfig.AdminAPIKey = redactedValue
+	}
+	if r.DBConfig.PostgresURL != "" {
+		r.DBConfig.PostgresURL = redactURL(r.DBConfig.PostgresURL)
+	}
+	return r
+}
+
+// redactURL replaces the password of a database URL, or the entire URL if it is
+// not in the URL format (i.e. a key=value connection string).
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redactedValue
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+	}
+	if q := u.Query(); q.Get("password") != "" {
+		q.Set("password", redactedValue)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
 func getBoolString(b bool) string {
 	if b {
 		return "yes"
@@ -77,10 +129,11 @@ func getBoolString(b bool) string {
 func CreateConfig() {
 	reader := bufio.NewReader(os.Stdin)
 	cfg := &Cfg{
-		LogConfig:   CfgLog{},
-		SteamConfig: CfgSteam{},
-		WebConfig:   CfgWeb{},
-		DebugConfig: CfgDebug{},
+		LogConfig:     CfgLog{},
+		SteamConfig:   CfgSteam{},
+		HistoryConfig: CfgHistory{},
+		WebConfig:     CfgWeb{},
+		DebugConfig:   CfgDebug{},
 	}
 	color.Set(color.FgHiYellow)
 	fmt.Printf(`
@@ -105,6 +158,8 @@ default value.
 		cfg.LogConfig.MaximumLogSize = defaultMaxLogSize
 		cfg.LogConfig.MaximumLogCount = defaultMaxLogCount
 	}
+	cfg.LogConfig.Level = defaultLogLevel
+	cfg.LogConfig.Format = defaultLogFormat
 
 	// Steam configuration
 	// Query the master server (master server or server list from steam api) automatically at timed intervals
@@ -116,18 +171,39 @@ default value.
 			// The Steam WebAPI key to use to get the web server list
 			cfg.SteamConfig.SteamWebAPIKey = configureSteamWebAPIKey(reader)
 		}
-		// The game to automatically query the master server for at timed intervals
-		cfg.SteamConfig.AutoQueryGame = configureTimedQueryGame(reader)
-		// Time between Steam Master server queries
-		cfg.SteamConfig.TimeBetweenMasterQueries = configureTimeBetweenQueries(reader,
-			cfg.SteamConfig.AutoQueryGame)
+		// The game(s) to automatically query the master server for at timed intervals
+		for _, game := range configureTimedQueryGames(reader) {
+			g := newDefaultSteamGame(game)
+			// Time between Steam Master server queries for this game
+			g.TimeBetweenMasterQueries = configureTimeBetweenQueries(reader, game)
+			// Master server region to retrieve this game's servers from
+			g.Region = configureRegion(reader, game)
+			cfg.SteamConfig.AutoQueryGames = append(cfg.SteamConfig.AutoQueryGames, g)
+		}
 		// Maximum # of servers to retrieve from Steam Master server
 		cfg.SteamConfig.MaximumHostsToReceive = configureMaxServersToRetrieve(reader)
 	} else {
-		cfg.SteamConfig.AutoQueryGame = filters.GameQuakeLive.Name
-		cfg.SteamConfig.TimeBetweenMasterQueries = defaultTimeBetweenMasterQueries
+		cfg.SteamConfig.AutoQueryGames = []CfgSteamGame{
+			newDefaultSteamGame(filters.GameQuakeLive.Name)}
 		cfg.SteamConfig.MaximumHostsToReceive = defaultMaxHostsToReceive
 	}
+	// Shared sockets, send rate, and concurrency of the A2S query engine (not
+	// user-selectable in the dialog; can be tuned in the configuration file)
+	cfg.SteamConfig.QuerySocketCount = defaultQuerySocketCount
+	cfg.SteamConfig.MaxQueriesPerSecond = defaultMaxQueriesPerSecond
+	cfg.SteamConfig.MaxConcurrentQueries = defaultMaxConcurrentQueries
+	cfg.SteamConfig.Retry = NewDefaultRetry()
+	cfg.SteamConfig.MaxSnapshotAge = defaultMaxSnapshotAge
+	cfg.SteamConfig.ServerIDRetention = defaultServerIDRetention
+	cfg.DBConfig = newDefaultDB()
+
+	// History configuration
+	// Record the history of servers on each timed retrieval
+	if cfg.SteamConfig.AutoQueryMaster {
+		cfg.HistoryConfig = newDefaultHistory(configureHistoryEnable(reader))
+	} else {
+		cfg.HistoryConfig = newDefaultHistory(false)
+	}
 
 	// Web API configuration
 	// Direct queries: whether users can query any host (not just those with IDs)
@@ -141,6 +217,8 @@ default value.
 	cfg.WebConfig.APIWebPort = configureWebServerPort(reader)
 	// Enable or disable gzip compression of responses
 	cfg.WebConfig.CompressResponses = configureResponseCompression(reader)
+	// Admin API key: required for managing webhooks
+	cfg.WebConfig.AdminAPIKey = configureAdminAPIKey(reader)
 
 	// Debug configuration (not user-selectable. for debug/development purposes)
 	// Print a few "debug" messages to stdout
@@ -167,12 +245,21 @@ func CreateDebugConfig() {
 	cfg.LogConfig.EnableWebLogging = true
 	cfg.LogConfig.MaximumLogCount = defaultMaxLogCount
 	cfg.LogConfig.MaximumLogSize = defaultMaxLogSize
+	cfg.LogConfig.Level = "debug"
+	cfg.LogConfig.Format = defaultLogFormat
 	cfg.SteamConfig.AutoQueryMaster = false
 	cfg.SteamConfig.SteamWebAPIKey = "none"
 	cfg.SteamConfig.UseWebServerList = defaultUseWebServerList
-	cfg.SteamConfig.AutoQueryGame = "QuakeLive"
-	cfg.SteamConfig.TimeBetweenMasterQueries = defaultTimeBetweenMasterQueries
+	cfg.SteamConfig.AutoQueryGames = []CfgSteamGame{newDefaultSteamGame("QuakeLive")}
 	cfg.SteamConfig.MaximumHostsToReceive = defaultMaxHostsToReceive
+	cfg.SteamConfig.QuerySocketCount = defaultQuerySocketCount
+	cfg.SteamConfig.MaxQueriesPerSecond = defaultMaxQueriesPerSecond
+	cfg.SteamConfig.MaxConcurrentQueries = defaultMaxConcurrentQueries
+	cfg.SteamConfig.Retry = NewDefaultRetry()
+	cfg.SteamConfig.MaxSnapshotAge = defaultMaxSnapshotAge
+	cfg.SteamConfig.ServerIDRetention = defaultServerIDRetention
+	cfg.DBConfig = newDefaultDB()
+	cfg.HistoryConfig = newDefaultHistory(true)
 	cfg.WebConfig.AllowDirectUserQueries = true
 	cfg.WebConfig.APIWebPort = defaultAPIWebPort
 	cfg.WebConfig.APIWebTimeout = defaultAPIWebTimeout
@@ -198,11 +285,21 @@ func CreateTestConfig() {
 	cfg := &Cfg{}
 	cfg.LogConfig.MaximumLogCount = defaultMaxLogCount
 	cfg.LogConfig.MaximumLogSize = defaultMaxLogSize
-	cfg.SteamConfig.AutoQueryGame = "QuakeLive"
-	cfg.SteamConfig.TimeBetweenMasterQueries = defaultTimeBetweenMasterQueries
+	cfg.LogConfig.Level = defaultLogLevel
+	cfg.LogConfig.Format = defaultLogFormat
+	cfg.SteamConfig.AutoQueryGames = []CfgSteamGame{newDefaultSteamGame("QuakeLive")}
 	cfg.SteamConfig.MaximumHostsToReceive = defaultMaxHostsToReceive
+	cfg.SteamConfig.QuerySocketCount = defaultQuerySocketCount
+	cfg.SteamConfig.MaxQueriesPerSecond = defaultMaxQueriesPerSecond
+	cfg.SteamConfig.MaxConcurrentQueries = defaultMaxConcurrentQueries
+	cfg.SteamConfig.Retry = NewDefaultRetry()
+	cfg.SteamConfig.MaxSnapshotAge = defaultMaxSnapshotAge
+	cfg.SteamConfig.ServerIDRetention = defaultServerIDRetention
+	cfg.DBConfig = newDefaultDB()
+	cfg.HistoryConfig = newDefaultHistory(true)
 	cfg.WebConfig.AllowDirectUserQueries = true
 	cfg.WebConfig.APIWebPort = 40081
+	cfg.WebConfig.AdminAPIKey = "test-admin-key"
 	cfg.WebConfig.APIWebTimeout = defaultAPIWebTimeout
 	cfg.WebConfig.CompressResponses = defaultCompressResponses
 	cfg.WebConfig.MaximumHostsPerAPIQuery = defaultMaxHostsPerAPIQuery
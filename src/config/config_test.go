@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/steam/filters"
+)
+
+// configuration file in the format of versions that retrieved a single game
+const legacyConfigFile = `{
+	"logConfig": {"enableAppLogging": false, "enableSteamLogging": false,
+		"enableWebLogging": false, "maxLogFilesize": 5120, "maxLogCount": 5},
+	"steamConfig": {"timedMasterServerQuery": true, "steamWebAPIKey": "none",
+		"useWebServerList": false, "gameForTimedMasterQuery": "Reflex",
+		"timeBetweenMasterQueries": 60, "maxHostsToReceive": 4000},
+	"webConfig": {"allowDirectUserQueries": true, "apiWebPort": 40080,
+		"apiWebTimeout": 7, "compressResponses": true, "maxHostsPerAPIQuery": 12},
+	"debugConfig": {"debugMessages": false, "dumpServers": false,
+		"useServerDumpAsMaster": false, "serverDumpFilename": "serverdump.json"}
+}`
+
+func TestReadLegacyConfig(t *testing.T) {
+	cfg, err := readConfig(strings.NewReader(legacyConfigFile))
+	if err != nil {
+		t.Fatalf("Unexpected error reading legacy configuration: %s", err)
+	}
+	games := cfg.SteamConfig.AutoQueryGames
+	if len(games) != 1 || games[0].Name != "Reflex" ||
+		games[0].TimeBetweenMasterQueries != 60 ||
+		games[0].Region != filters.DefaultRegionName {
+		t.Fatalf("Expected the legacy game to be retrieved, got: %+v", games)
+	}
+	if cfg.SteamConfig.LegacyAutoQueryGame != "" {
+		t.Fatalf("Expected the legacy game to be cleared")
+	}
+	if _, err := games[0].GetFilter(); err != nil {
+		t.Fatalf("Unexpected error building legacy game's filter: %s", err)
+	}
+	sc := cfg.SteamConfig
+	if sc.QuerySocketCount != defaultQuerySocketCount ||
+		sc.MaxQueriesPerSecond != defaultMaxQueriesPerSecond ||
+		sc.MaxConcurrentQueries != defaultMaxConcurrentQueries {
+		t.Fatalf("Expected query engine defaults, got: %+v", sc)
+	}
+	if sc.MaxSnapshotAge != defaultMaxSnapshotAge {
+		t.Fatalf("Expected default snapshot age, got: %d", sc.MaxSnapshotAge)
+	}
+}
+
+func TestReadConfigSnapshotsDisabled(t *testing.T) {
+	cfg, err := readConfig(strings.NewReader(
+		`{"steamConfig": {"maxSnapshotAgeSecs": 0}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error reading configuration: %s", err)
+	}
+	if cfg.SteamConfig.MaxSnapshotAge != 0 {
+		t.Fatalf("Expected snapshots to stay disabled, got: %d",
+			cfg.SteamConfig.MaxSnapshotAge)
+	}
+}
+
+func TestReadConfigKeepsGames(t *testing.T) {
+	cfg, err := readConfig(strings.NewReader(`{"steamConfig": {
+		"gamesForTimedMasterQuery": [{"name": "QuakeLive",
+			"timeBetweenMasterQueries": 90, "region": "europe"}],
+		"gameForTimedMasterQuery": "Reflex"}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error reading configuration: %s", err)
+	}
+	if games := cfg.SteamConfig.AutoQueryGames; len(games) != 1 ||
+		games[0].Name != "QuakeLive" {
+		t.Fatalf("Expected the list of games to be kept, got: %+v", games)
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+const (
+	defaultEnableHistory = true
+	// raw samples (one per server per timed retrieval) are kept for this long
+	defaultHistoryRawRetention = 48
+	// raw samples older than the raw retention are averaged into buckets of
+	// this many seconds
+	defaultHistoryDownsampleInterval = 3600
+	// downsampled samples are kept for this long
+	defaultHistoryDownsampledRetention = 90
+)
+
+// CfgHistory represents options for the historical server and player data that
+// is recorded on each timed master server retrieval.
+type CfgHistory struct {
+	EnableHistory bool `json:"enableHistory"`
+	// in hours
+	RawRetention int `json:"rawRetentionHours"`
+	// in seconds
+	DownsampleInterval int `json:"downsampleIntervalSecs"`
+	// in days
+	DownsampledRetention int `json:"downsampledRetentionDays"`
+}
+
+func newDefaultHistory(enable bool) CfgHistory {
+	return CfgHistory{
+		EnableHistory:        enable,
+		RawRetention:         defaultHistoryRawRetention,
+		DownsampleInterval:   defaultHistoryDownsampleInterval,
+		DownsampledRetention: defaultHistoryDownsampledRetention,
+	}
+}
+
+func configureHistoryEnable(reader *bufio.Reader) bool {
+	valid, val := false, false
+	prompt := fmt.Sprintf(`
+Record the player counts, bot counts, and maps of the retrieved servers on each
+timed retrieval? This allows the API to provide the history of servers, games,
+and countries over time.
+%s`, promptColor("> 'yes' or 'no' [default: %s]: ",
+		getBoolString(defaultEnableHistory)))
+
+	input := func(r *bufio.Reader) (bool, error) {
+		enable, rserr := r.ReadString('\n')
+		if rserr != nil {
+			return defaultEnableHistory,
+				fmt.Errorf("Unable to read respone: %s", rserr)
+		}
+		if enable == newline {
+			return defaultEnableHistory, nil
+		}
+		response := strings.Trim(enable, newline)
+		if strings.EqualFold(response, "y") || strings.EqualFold(response, "yes") {
+			return true, nil
+		} else if strings.EqualFold(response, "n") || strings.EqualFold(response,
+			"no") {
+			return false, nil
+		} else {
+			return defaultEnableHistory,
+				fmt.Errorf("[ERROR] Invalid response. Valid responses: y, yes, n, no")
+		}
+	}
+	var err error
+	for !valid {
+		fmt.Fprintf(color.Output, prompt)
+		val, err = input(reader)
+		if err != nil {
+			errorColor(err)
+		} else {
+			valid = true
+		}
+	}
+	return val
+}
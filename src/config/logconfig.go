@@ -16,6 +16,22 @@ const (
 	defaultEnableWebLogging   = false
 	defaultMaxLogSize         = 5120
 	defaultMaxLogCount        = 5
+	defaultLogLevel           = "info"
+	defaultLogFormat          = LogFormatLogfmt
+)
+
+const (
+	// LogFormatJSON writes each log record as a JSON object on its own line.
+	LogFormatJSON = "json"
+	// LogFormatLogfmt writes each log record as key=value pairs on its own line.
+	LogFormatLogfmt = "logfmt"
+
+	// LogSinkFile writes log records to a file that is rotated by size.
+	LogSinkFile = "file"
+	// LogSinkStdout writes log records to stdout.
+	LogSinkStdout = "stdout"
+	// LogSinkSyslog sends log records to a syslog socket.
+	LogSinkSyslog = "syslog"
 )
 
 // CfgLog represents logging-related configuration options.
@@ -25,6 +41,31 @@ type CfgLog struct {
 	EnableWebLogging   bool  `json:"enableWebLogging"`
 	MaximumLogSize     int64 `json:"maxLogFilesize"`
 	MaximumLogCount    int   `json:"maxLogCount"`
+	// debug, info, warn or error; can be changed at runtime
+	Level string `json:"level"`
+	// json or logfmt
+	Format string `json:"format"`
+	// where log records are written; if empty, then the enabled logs are written
+	// to their files in the logs directory and debug messages to stdout
+	Sinks []CfgLogSink `json:"sinks"`
+}
+
+// CfgLogSink represents a destination of log records; not user-selectable in the
+// configuration dialog.
+type CfgLogSink struct {
+	// file, stdout or syslog
+	Type string `json:"type"`
+	// logs to write (app, steam, web, debug); all logs if empty
+	Logs []string `json:"logs"`
+	// minimum level of the records to write, if above the log level
+	Level string `json:"level"`
+	// file sinks: path of the log file
+	Path string `json:"path"`
+	// syslog sinks: network (unixgram, unix, udp or tcp) and address of the
+	// socket, i.e. unixgram and /dev/log, and the tag of the messages
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Tag     string `json:"tag"`
 }
 
 func configureLoggingEnable(reader *bufio.Reader, logt constants.LogType) bool {
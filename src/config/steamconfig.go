@@ -18,16 +18,135 @@ const (
 	defaultUseWebServerList         = true
 	// defaultTimeForHighServerCount: not used in JSON, only in the config dialog
 	defaultTimeForHighServerCount = 120
+	defaultQuerySocketCount       = 4
+	defaultMaxQueriesPerSecond    = 1000
+	defaultMaxConcurrentQueries   = 500
+	defaultRetryMaxAttempts       = 4
+	defaultRetryInitialTimeout    = 1000
+	defaultRetryMaxTimeout        = 4000
+	defaultRetryTimeoutMultiplier = 1.5
+	defaultRetryInitialBackoff    = 100
+	defaultRetryMaxBackoff        = 1000
+	defaultRetryBackoffMultiplier = 2.0
+	defaultRetryJitter            = 0.2
+	defaultMaxSnapshotAge         = 3600
+	defaultServerIDRetention      = 90
 )
 
 // CfgSteam represents Steam-related configuration options.
 type CfgSteam struct {
-	AutoQueryMaster          bool   `json:"timedMasterServerQuery"`
-	SteamWebAPIKey           string `json:"steamWebAPIKey"`
-	UseWebServerList         bool   `json:"useWebServerList"`
-	AutoQueryGame            string `json:"gameForTimedMasterQuery"`
-	TimeBetweenMasterQueries int    `json:"timeBetweenMasterQueries"`
-	MaximumHostsToReceive    int    `json:"maxHostsToReceive"`
+	AutoQueryMaster       bool           `json:"timedMasterServerQuery"`
+	SteamWebAPIKey        string         `json:"steamWebAPIKey"`
+	UseWebServerList      bool           `json:"useWebServerList"`
+	AutoQueryGames        []CfgSteamGame `json:"gamesForTimedMasterQuery"`
+	MaximumHostsToReceive int            `json:"maxHostsToReceive"`
+	QuerySocketCount      int            `json:"querySocketCount"`
+	MaxQueriesPerSecond   int            `json:"maxQueriesPerSecond"`
+	MaxConcurrentQueries  int            `json:"maxConcurrentQueries"`
+	Retry                 CfgRetry       `json:"queryRetry"`
+	MaxSnapshotAge        int            `json:"maxSnapshotAgeSecs"`
+	ServerIDRetention     int            `json:"serverIDRetentionDays"`
+	// Deprecated: the single game and interval of configuration files that were
+	// created before AutoQueryGames; only read when AutoQueryGames is empty.
+	LegacyAutoQueryGame string `json:"gameForTimedMasterQuery,omitempty"`
+	// Deprecated: see LegacyAutoQueryGame.
+	LegacyTimeBetweenMasterQueries int `json:"timeBetweenMasterQueries,omitempty"`
+}
+
+// applyDefaults sets the options that are missing from configuration files
+// created by older versions to their defaults.
+func (c *CfgSteam) applyDefaults() {
+	if c.QuerySocketCount <= 0 {
+		c.QuerySocketCount = defaultQuerySocketCount
+	}
+	if c.MaxQueriesPerSecond <= 0 {
+		c.MaxQueriesPerSecond = defaultMaxQueriesPerSecond
+	}
+	if c.MaxConcurrentQueries <= 0 {
+		c.MaxConcurrentQueries = defaultMaxConcurrentQueries
+	}
+}
+
+// upgradeLegacyGame builds the list of games for the timed retrieval from the
+// single game of configuration files that predate the list.
+func (c *CfgSteam) upgradeLegacyGame() {
+	if len(c.AutoQueryGames) == 0 && c.LegacyAutoQueryGame != "" {
+		g := newDefaultSteamGame(c.LegacyAutoQueryGame)
+		if c.LegacyTimeBetweenMasterQueries > 0 {
+			g.TimeBetweenMasterQueries = c.LegacyTimeBetweenMasterQueries
+		}
+		c.AutoQueryGames = []CfgSteamGame{g}
+	}
+	c.LegacyAutoQueryGame, c.LegacyTimeBetweenMasterQueries = "", 0
+}
+
+// CfgRetry represents the policy for re-trying failed A2S queries. Timeouts and
+// backoffs are in milliseconds. Each attempt's timeout and the backoff before the
+// next attempt grow by their multipliers, up to their maximums; the backoff is
+// randomly varied by up to +/- jitter (0 to 1) of its value.
+type CfgRetry struct {
+	MaxAttempts       int     `json:"maxAttempts"`
+	InitialTimeout    int     `json:"initialTimeoutMs"`
+	MaxTimeout        int     `json:"maxTimeoutMs"`
+	TimeoutMultiplier float64 `json:"timeoutMultiplier"`
+	InitialBackoff    int     `json:"initialBackoffMs"`
+	MaxBackoff        int     `json:"maxBackoffMs"`
+	BackoffMultiplier float64 `json:"backoffMultiplier"`
+	Jitter            float64 `json:"jitter"`
+}
+
+// NewDefaultRetry returns the default policy for re-trying failed A2S queries.
+func NewDefaultRetry() CfgRetry {
+	return CfgRetry{
+		MaxAttempts:       defaultRetryMaxAttempts,
+		InitialTimeout:    defaultRetryInitialTimeout,
+		MaxTimeout:        defaultRetryMaxTimeout,
+		TimeoutMultiplier: defaultRetryTimeoutMultiplier,
+		InitialBackoff:    defaultRetryInitialBackoff,
+		MaxBackoff:        defaultRetryMaxBackoff,
+		BackoffMultiplier: defaultRetryBackoffMultiplier,
+		Jitter:            defaultRetryJitter,
+	}
+}
+
+// CfgSteamGame represents a game whose servers are retrieved from the Steam
+// master server at timed intervals, along with its own interval, master server
+// region, and additional master server filters (i.e: "\\dedicated\\1").
+type CfgSteamGame struct {
+	Name                     string   `json:"name"`
+	TimeBetweenMasterQueries int      `json:"timeBetweenMasterQueries"`
+	Region                   string   `json:"region"`
+	Filters                  []string `json:"filters"`
+}
+
+// GetFilter builds the master server filter for the timed retrieval of the game.
+func (g CfgSteamGame) GetFilter() (filters.Filter, error) {
+	game := filters.GetGameByName(g.Name)
+	if game == filters.GameUnspecified {
+		return filters.Filter{}, fmt.Errorf("Invalid game '%s'", g.Name)
+	}
+	region, err := filters.GetRegionByName(g.Region)
+	if err != nil {
+		return filters.Filter{}, err
+	}
+	var sf []filters.SrvFilter
+	for _, f := range g.Filters {
+		sf = append(sf, filters.SrvFilter(f))
+	}
+	return filters.NewFilter(game, region, sf), nil
+}
+
+func newDefaultSteamGame(name string) CfgSteamGame {
+	interval := defaultTimeBetweenMasterQueries
+	if filters.HasHighServerCount(name) {
+		interval = defaultTimeForHighServerCount
+	}
+	return CfgSteamGame{
+		Name:                     name,
+		TimeBetweenMasterQueries: interval,
+		Region:                   filters.DefaultRegionName,
+		Filters:                  make([]string, 0),
+	}
 }
 
 func configureTimedMasterQuery(reader *bufio.Reader) bool {
@@ -149,31 +268,80 @@ API key for free from http://steamcommunity.com/dev/apikey
 	return val
 }
 
-func configureTimedQueryGame(reader *bufio.Reader) string {
+func configureTimedQueryGames(reader *bufio.Reader) []string {
 	valid := false
-	var val string
+	var val []string
 	games := strings.Join(filters.GetGameNames(), "\n")
 	prompt := fmt.Sprintf(`
-Choose the game you would like to automatically retrieve servers for at timed
-intervals. Possible choices are:
+Choose the game(s) you would like to automatically retrieve servers for at timed
+intervals. Separate multiple games with commas. Possible choices are:
 %s
 More games can be added via the %s file.
 %s`, games, constants.GameFileFullPath, promptColor("> [default: NONE]: "))
 
-	input := func(r *bufio.Reader) (string, error) {
+	input := func(r *bufio.Reader) ([]string, error) {
 		gameval, rserr := r.ReadString('\n')
 		if rserr != nil {
-			return "", fmt.Errorf("Unable to read respone: %s", rserr)
+			return nil, fmt.Errorf("Unable to read respone: %s", rserr)
 		}
 		if gameval == newline {
-			return "", fmt.Errorf("[ERROR] Invalid response. Valid responses:\n%s", games)
+			return nil, fmt.Errorf("[ERROR] Invalid response. Valid responses:\n%s", games)
 		}
-		response := strings.Trim(gameval, newline)
-		if filters.IsValidGame(response) {
+		var selected []string
+		for _, g := range strings.Split(strings.Trim(gameval, newline), ",") {
+			g = strings.TrimSpace(g)
+			if !filters.IsValidGame(g) {
+				return nil, fmt.Errorf("[ERROR] Invalid game '%s'. Valid responses: %s",
+					g, games)
+			}
 			// format the capitalization
-			return filters.GetGameByName(response).Name, nil
+			name := filters.GetGameByName(g).Name
+			for _, s := range selected {
+				if s == name {
+					return nil, fmt.Errorf("[ERROR] Game '%s' was specified more than once",
+						name)
+				}
+			}
+			selected = append(selected, name)
+		}
+		return selected, nil
+	}
+	var err error
+	for !valid {
+		fmt.Fprintf(color.Output, prompt)
+		val, err = input(reader)
+		if err != nil {
+			errorColor(err)
+		} else {
+			valid = true
 		}
-		return "", fmt.Errorf("[ERROR] Invalid response. Valid responses: %s", games)
+	}
+	return val
+}
+
+func configureRegion(reader *bufio.Reader, game string) string {
+	valid := false
+	var val string
+	regions := strings.Join(filters.GetRegionNames(), ", ")
+	prompt := fmt.Sprintf(`
+Enter the master server region to retrieve %s servers from. Possible choices are:
+%s
+%s`, game, regions, promptColor("> [default: %s]: ", filters.DefaultRegionName))
+
+	input := func(r *bufio.Reader) (string, error) {
+		regionval, rserr := r.ReadString('\n')
+		if rserr != nil {
+			return filters.DefaultRegionName,
+				fmt.Errorf("Unable to read response: %s", rserr)
+		}
+		if regionval == newline {
+			return filters.DefaultRegionName, nil
+		}
+		response := strings.ToLower(strings.Trim(regionval, newline))
+		if _, err := filters.GetRegionByName(response); err != nil {
+			return filters.DefaultRegionName, fmt.Errorf("[ERROR] %s", err)
+		}
+		return response, nil
 	}
 	var err error
 	for !valid {
@@ -243,9 +411,9 @@ Valve will throttle future requests for 1 min.`
 	}
 	prompt := fmt.Sprintf(`
 Enter the time, in seconds, between requests to grab all servers from the master
-server. For many games this needs to be at least 60. For some games this will
+server for %s. For many games this needs to be at least 60. For some games this will
 need to be even higher. %s
-%s `, retrievalMethodMsg, promptColor("> [default: %d]: ", defaultVal))
+%s `, game, retrievalMethodMsg, promptColor("> [default: %d]: ", defaultVal))
 
 	input := func(r *bufio.Reader) (int, error) {
 		timeval, rserr := r.ReadString('\n')
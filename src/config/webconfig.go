@@ -24,6 +24,8 @@ type CfgWeb struct {
 	APIWebTimeout           int  `json:"apiWebTimeout"`
 	CompressResponses       bool `json:"compressResponses"`
 	MaximumHostsPerAPIQuery int  `json:"maxHostsPerAPIQuery"`
+	// key required by the administrative routes (i.e. webhooks); disabled if empty
+	AdminAPIKey string `json:"adminAPIKey"`
 }
 
 func configureDirectQueries(reader *bufio.Reader, timedEnabled bool) bool {
@@ -237,3 +239,19 @@ already handles compression for you.
 	}
 	return val
 }
+
+func configureAdminAPIKey(reader *bufio.Reader) string {
+	prompt := fmt.Sprintf(`
+Enter a key for the API's administrative routes (i.e. managing webhooks). Requests
+to these routes must send the key in the X-API-Key header. Leave blank to disable
+the administrative routes.
+%s`, promptColor("> [default: NONE]: "))
+
+	fmt.Fprintf(color.Output, prompt)
+	keyval, err := reader.ReadString('\n')
+	if err != nil {
+		errorColor(fmt.Errorf("Unable to read respone: %s", err))
+		return ""
+	}
+	return strings.Trim(keyval, newline)
+}
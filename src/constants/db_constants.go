@@ -9,6 +9,8 @@ const (
 	DbDirectory = "db"
 	// ServerDbFilename specifies the name of the server database file.
 	ServerDbFilename = "servers.sqlite"
+	// HistoryDbFilename specifies the name of the server history database file.
+	HistoryDbFilename = "history.sqlite"
 	// CountryMMDbFilename specifies the name of geolocation database file.
 	CountryMMDbFilename = "GeoLite2-City.mmdb"
 )
@@ -30,3 +32,12 @@ func GetServerDBPath() string {
 	}
 	return path.Join(DbDirectory, ServerDbFilename)
 }
+
+// GetHistoryDBPath returns the full OS-independent path to the server history DB
+// file.
+func GetHistoryDBPath() string {
+	if IsTest {
+		return path.Join(TestTempDirectory, TestHistoryDbFilename)
+	}
+	return path.Join(DbDirectory, HistoryDbFilename)
+}
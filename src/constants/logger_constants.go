@@ -29,6 +29,23 @@ const (
 	LTypeWeb
 )
 
+// String returns the name of the log type, which is also used in the
+// configuration of the log sinks.
+func (lt LogType) String() string {
+	switch lt {
+	case LTypeApp:
+		return "app"
+	case LTypeDebug:
+		return "debug"
+	case LTypeSteam:
+		return "steam"
+	case LTypeWeb:
+		return "web"
+	default:
+		return ""
+	}
+}
+
 var (
 	// AppLogFilePath represents the OS-independent full path to app log file.
 	AppLogFilePath = path.Join(LogDirectory, AppLogFilename)
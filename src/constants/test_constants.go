@@ -12,6 +12,9 @@ const (
 	// TestServerDbFilename specifies the name of the server database file used in
 	// tests.
 	TestServerDbFilename = "servers_test.sqlite"
+	// TestHistoryDbFilename specifies the name of the server history database file
+	// used in tests.
+	TestHistoryDbFilename = "history_test.sqlite"
 )
 
 var (
@@ -28,6 +28,15 @@ type mmdbformat struct {
 	Continent struct {
 		Names map[string]string `maxminddb:"names"`
 	} `maxminddb:"continent"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		// nil if the database has no coordinates for the IP
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
 	Subdivisions []struct {
 		IsoCode string `maxminddb:"iso_code"`
 	} `maxminddb:"subdivisions"`
@@ -39,6 +48,8 @@ func getDefaultCountryData() models.DbCountry {
 		CountryCode: "Unknown",
 		Continent:   "Unknown",
 		State:       "Unknown",
+		City:        "Unknown",
+		TimeZone:    "Unknown",
 	}
 }
 
@@ -75,22 +86,42 @@ func (cdb *CDB) Close() {
 // GetCountryInfo attempts to retrieve the country information for a given IP,
 // returning the result as a country model object over the corresponding result channel.
 func (cdb *CDB) GetCountryInfo(ch chan<- models.DbCountry, ipstr string) {
+	ch <- cdb.LookupCountryInfo(ipstr)
+}
+
+// LookupCountryInfo retrieves the country information for a given IP, or the
+// default (unknown) country information if the IP is not in the database.
+func (cdb *CDB) LookupCountryInfo(ipstr string) models.DbCountry {
 	ip := net.ParseIP(ipstr)
+	if ip == nil {
+		return getDefaultCountryData()
+	}
 	c := &mmdbformat{}
 	err := cdb.db.Lookup(ip, c)
 	if err != nil {
-		ch <- getDefaultCountryData()
-		return
+		return getDefaultCountryData()
 	}
 	if c.Country.Names["en"] == "" || c.Country.IsoCode == "" {
-		ch <- getDefaultCountryData()
-		return
+		return getDefaultCountryData()
 	}
 
 	countrydata := models.DbCountry{
 		CountryName: c.Country.Names["en"],
 		CountryCode: c.Country.IsoCode,
 		Continent:   c.Continent.Names["en"],
+		City:        c.City.Names["en"],
+		TimeZone:    c.Location.TimeZone,
+	}
+	if countrydata.City == "" {
+		countrydata.City = "Unknown"
+	}
+	if countrydata.TimeZone == "" {
+		countrydata.TimeZone = "Unknown"
+	}
+	if c.Location.Latitude != nil && c.Location.Longitude != nil {
+		countrydata.HasCoordinates = true
+		countrydata.Latitude = *c.Location.Latitude
+		countrydata.Longitude = *c.Location.Longitude
 	}
 	if c.Country.IsoCode == "US" {
 		if len(c.Subdivisions) > 0 {
@@ -101,5 +132,5 @@ func (cdb *CDB) GetCountryInfo(ch chan<- models.DbCountry, ipstr string) {
 	} else {
 		countrydata.State = "None"
 	}
-	ch <- countrydata
+	return countrydata
 }
@@ -45,3 +45,27 @@ func TestGetCountryInfo(t *testing.T) {
 			ip, cinfo.CountryCode)
 	}
 }
+
+func TestLookupCountryInfo(t *testing.T) {
+	cdb, err := OpenCountryDB()
+	if err != nil {
+		t.Fatalf("Error opening country database: %s", err)
+	}
+	defer cdb.Close()
+	ip := "89.20.244.197"
+	cinfo := cdb.LookupCountryInfo(ip)
+	if !cinfo.HasCoordinates || cinfo.Latitude < 57 || cinfo.Latitude > 72 ||
+		cinfo.Longitude < 4 || cinfo.Longitude > 32 {
+		t.Fatalf("Expected coordinates in Norway for IP: %s, got: %v,%v", ip,
+			cinfo.Latitude, cinfo.Longitude)
+	}
+	if !strings.HasPrefix(cinfo.TimeZone, "Europe/") {
+		t.Fatalf("Expected a European time zone for IP: %s, got: %s", ip,
+			cinfo.TimeZone)
+	}
+	ip = "unknown"
+	cinfo = cdb.LookupCountryInfo(ip)
+	if cinfo.HasCoordinates || cinfo.CountryCode != "Unknown" {
+		t.Fatalf("Expected no location for IP: %s, got: %+v", ip, cinfo)
+	}
+}
@@ -15,15 +15,21 @@ import (
 // when building server lists.
 var CountryDB *CDB
 
-// ServerDB is a package-level variable that contains a server information
-// database connection. It is initialized once for re-usability when building
-// server lists.
-var ServerDB *SDB
+// ServerDB is a package-level variable that contains the server store that is
+// selected in the configuration. It is initialized once for re-usability when
+// building server lists.
+var ServerDB ServerStore
 
-// InitDBs initializes the geolocation and server information databases for
-// re-use across server list builds. Panics on failure to initialize.
+// HistoryDB is a package-level variable that contains a server history database
+// connection. It is initialized once for re-usability when recording and
+// retrieving the history of servers.
+var HistoryDB *HDB
+
+// InitDBs initializes the geolocation, server information and server history
+// databases for re-use across server list builds. Panics on failure to
+// initialize.
 func InitDBs() {
-	if CountryDB != nil && ServerDB != nil {
+	if CountryDB != nil && ServerDB != nil && HistoryDB != nil {
 		return
 	}
 
@@ -32,14 +38,20 @@ func InitDBs() {
 		panic(fmt.Sprintf("Unable to initialize country database connection: %s",
 			err))
 	}
-	sdb, err := OpenServerDB()
+	sdb, err := OpenServerStore()
 	if err != nil {
 		panic(fmt.Sprintf(
 			"Unable to initialize server information database connection: %s", err))
 	}
+	hdb, err := OpenHistoryDB()
+	if err != nil {
+		panic(fmt.Sprintf(
+			"Unable to initialize server history database connection: %s", err))
+	}
 	// Set package-level variables
 	CountryDB = cdb
 	ServerDB = sdb
+	HistoryDB = hdb
 }
 
 func verifyServerDbPath() error {
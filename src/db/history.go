@@ -0,0 +1,294 @@
+package db
+
+// history.go - historical player, bot and map information of the servers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/syncore/a2sapi/src/constants"
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+	"github.com/syncore/a2sapi/src/util"
+	// blank import for sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// HDB represents a database containing the history of the servers that have
+// server IDs.
+type HDB struct {
+	db *sql.DB
+	// serializes writes from the games' concurrent retrievals
+	mutex sync.Mutex
+}
+
+// HistoryQuery represents the servers, games and countries whose history is to
+// be retrieved between From and To (unix timestamps). Samples are averaged into
+// buckets of Resolution seconds; a resolution of zero or less returns the samples
+// as they were stored.
+type HistoryQuery struct {
+	IDs        []int64
+	Games      []string
+	Countries  []string
+	From       int64
+	To         int64
+	Resolution int64
+}
+
+func createHistoryTable(db *sql.DB) error {
+	// downsampled is the number of seconds that a sample was averaged over, or
+	// zero for raw samples
+	create := []string{`CREATE TABLE IF NOT EXISTS history (
+	server_id INTEGER NOT NULL,
+	game TEXT NOT NULL,
+	country TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	players REAL NOT NULL,
+	bots REAL NOT NULL,
+	map TEXT NOT NULL,
+	downsampled INTEGER NOT NULL DEFAULT 0
+	)`,
+		"CREATE INDEX IF NOT EXISTS history_server ON history (server_id, timestamp)",
+		"CREATE INDEX IF NOT EXISTS history_timestamp ON history (timestamp)",
+	}
+	for _, c := range create {
+		if _, err := db.Exec(c); err != nil {
+			return logger.LogAppErrorf("Unable to create history table in DB: %s", err)
+		}
+	}
+	return nil
+}
+
+// OpenHistoryDB opens a database connection to the history database file or if
+// that file does not exist, creates it and then opens a database connection to it.
+func OpenHistoryDB() (*HDB, error) {
+	dbfile := constants.GetHistoryDBPath()
+	if !util.FileExists(dbfile) {
+		if err := util.CreateEmptyFile(dbfile, true); err != nil {
+			return nil, logger.LogAppErrorf("Unable to create history DB: %s", err)
+		}
+	}
+	conn, err := openSQLite(dbfile)
+	if err != nil {
+		return nil, logger.LogAppError(err)
+	}
+	if err := createHistoryTable(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &HDB{db: conn}, nil
+}
+
+// Close closes the history database's underlying connection.
+func (hdb *HDB) Close() {
+	err := hdb.db.Close()
+	if err != nil {
+		logger.LogAppErrorf("Error closing history DB: %s", err)
+	}
+}
+
+// AddHistory records the player count, bot count and map of each of the servers
+// at the given time. Servers without a server ID are not recorded.
+func (hdb *HDB) AddHistory(timestamp int64, servers []models.APIServer) error {
+	hdb.mutex.Lock()
+	defer hdb.mutex.Unlock()
+	tx, err := hdb.db.Begin()
+	if err != nil {
+		return logger.LogAppErrorf("AddHistory error creating tx: %s", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO history (server_id, game, country,
+	timestamp, players, bots, map) VALUES ($1, $2, $3, $4, $5, $6, $7)`)
+	if err == nil {
+		for _, s := range servers {
+			if s.ID == 0 {
+				continue
+			}
+			_, err = stmt.Exec(s.ID, s.Game, s.CountryInfo.CountryCode, timestamp,
+				s.Info.Players, s.Info.Bots, s.Info.Map)
+			if err != nil {
+				break
+			}
+		}
+		stmt.Close()
+	}
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			logger.LogAppErrorf("AddHistory error rolling back tx: %s", rerr)
+		}
+		return logger.LogAppErrorf("AddHistory exec error: %s", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return logger.LogAppErrorf("AddHistory error committing tx: %s", err)
+	}
+	return nil
+}
+
+// Downsample averages the raw samples that were recorded before rawCutoff into
+// samples of interval seconds, and removes every sample that was recorded before
+// retentionCutoff.
+func (hdb *HDB) Downsample(rawCutoff, interval, retentionCutoff int64) error {
+	hdb.mutex.Lock()
+	defer hdb.mutex.Unlock()
+	tx, err := hdb.db.Begin()
+	if err != nil {
+		return logger.LogAppErrorf("Downsample error creating tx: %s", err)
+	}
+	if interval > 0 {
+		// only complete buckets, so that a bucket is never averaged twice
+		rawCutoff = rawCutoff / interval * interval
+		_, err = tx.Exec(`INSERT INTO history (server_id, game, country, timestamp,
+		players, bots, map, downsampled)
+		SELECT server_id, MAX(game), MAX(country), timestamp / $1 * $1,
+		AVG(players), AVG(bots), MAX(map), $1 FROM history
+		WHERE downsampled = 0 AND timestamp < $2
+		GROUP BY server_id, timestamp / $1`, interval, rawCutoff)
+		if err == nil {
+			_, err = tx.Exec(
+				"DELETE FROM history WHERE downsampled = 0 AND timestamp < $1",
+				rawCutoff)
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM history WHERE timestamp < $1",
+			retentionCutoff)
+	}
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			logger.LogAppErrorf("Downsample error rolling back tx: %s", rerr)
+		}
+		return logger.LogAppErrorf("Downsample exec error: %s", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return logger.LogAppErrorf("Downsample error committing tx: %s", err)
+	}
+	return nil
+}
+
+// GetHistory retrieves the history of the servers, games and countries in the
+// query. A server's points are its averages within each bucket; a game's or
+// country's points are the totals of its servers' averages.
+func (hdb *HDB) GetHistory(q HistoryQuery) (*models.HistoryList, error) {
+	hl := models.GetDefaultHistoryList()
+	hl.From, hl.To = q.From, q.To
+	res := q.Resolution
+	if res <= 0 {
+		res = 1
+	} else {
+		hl.Resolution = res
+	}
+	if len(q.IDs) > 0 {
+		args := []interface{}{res, q.From, q.To}
+		for _, id := range q.IDs {
+			args = append(args, id)
+		}
+		query := fmt.Sprintf(`SELECT server_id, timestamp / $1 * $1 AS bucket,
+		AVG(players), AVG(bots), MAX(map) FROM history
+		WHERE timestamp >= $2 AND timestamp <= $3 AND server_id IN (%s)
+		GROUP BY server_id, bucket ORDER BY server_id, bucket`,
+			numberedPlaceholders(4, len(q.IDs)))
+		series, err := hdb.getSeries(query, args, true,
+			func(s *models.HistorySeries, key string) {
+				fmt.Sscan(key, &s.ServerID)
+			})
+		if err != nil {
+			return hl, err
+		}
+		hl.Series = append(hl.Series, series...)
+	}
+	if len(q.Games) > 0 {
+		// series are named as requested, regardless of case
+		games := make(map[string]string, len(q.Games))
+		for _, g := range q.Games {
+			games[strings.ToLower(g)] = g
+		}
+		series, err := hdb.getTotals("LOWER(game)", lowered(q.Games), q.From, q.To,
+			res, func(s *models.HistorySeries, key string) { s.Game = games[key] })
+		if err != nil {
+			return hl, err
+		}
+		hl.Series = append(hl.Series, series...)
+	}
+	if len(q.Countries) > 0 {
+		series, err := hdb.getTotals("UPPER(country)", uppered(q.Countries), q.From,
+			q.To, res, func(s *models.HistorySeries, key string) { s.CountryCode = key })
+		if err != nil {
+			return hl, err
+		}
+		hl.Series = append(hl.Series, series...)
+	}
+	hl.SeriesCount = len(hl.Series)
+	return hl, nil
+}
+
+// getTotals retrieves a series for each of the values of the column, where each
+// point is the total of the averages of the matching servers within a bucket.
+func (hdb *HDB) getTotals(column string, values []string, from, to, res int64,
+	name func(*models.HistorySeries, string)) ([]models.HistorySeries, error) {
+	args := []interface{}{res, from, to}
+	for _, v := range values {
+		args = append(args, v)
+	}
+	query := fmt.Sprintf(`SELECT key, bucket, SUM(players), SUM(bots), '' FROM
+	(SELECT %s AS key, server_id, timestamp / $1 * $1 AS bucket,
+	AVG(players) AS players, AVG(bots) AS bots FROM history
+	WHERE timestamp >= $2 AND timestamp <= $3 AND %s IN (%s)
+	GROUP BY key, server_id, bucket) AS averages
+	GROUP BY key, bucket ORDER BY key, bucket`, column, column,
+		numberedPlaceholders(4, len(values)))
+	return hdb.getSeries(query, args, false, name)
+}
+
+// getSeries runs a history query whose rows consist of a series key, bucket,
+// players, bots and map, and groups the rows into one series per key.
+func (hdb *HDB) getSeries(query string, args []interface{}, withMap bool,
+	name func(*models.HistorySeries, string)) ([]models.HistorySeries, error) {
+	rows, err := hdb.db.Query(query, args...)
+	if err != nil {
+		return nil, logger.LogAppErrorf("GetHistory: Error querying database: %s",
+			err)
+	}
+	defer rows.Close()
+	var series []models.HistorySeries
+	lastKey := ""
+	for rows.Next() {
+		var key string
+		p := models.HistoryPoint{}
+		if err := rows.Scan(&key, &p.Timestamp, &p.Players, &p.Bots,
+			&p.Map); err != nil {
+			return nil, logger.LogAppErrorf("GetHistory: Error reading history: %s",
+				err)
+		}
+		if !withMap {
+			p.Map = ""
+		}
+		if len(series) == 0 || key != lastKey {
+			s := models.HistorySeries{}
+			name(&s, key)
+			series = append(series, s)
+			lastKey = key
+		}
+		series[len(series)-1].Points = append(series[len(series)-1].Points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logger.LogAppErrorf("GetHistory: Error reading history: %s", err)
+	}
+	return series, nil
+}
+
+func lowered(vals []string) []string {
+	l := make([]string, len(vals))
+	for i, v := range vals {
+		l[i] = strings.ToLower(v)
+	}
+	return l
+}
+
+func uppered(vals []string) []string {
+	u := make([]string, len(vals))
+	for i, v := range vals {
+		u[i] = strings.ToUpper(v)
+	}
+	return u
+}
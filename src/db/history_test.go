@@ -0,0 +1,102 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func testHistoryServer(id int64, game, country string, players,
+	bots int16) models.APIServer {
+	return models.APIServer{
+		ID:          id,
+		Game:        game,
+		CountryInfo: models.DbCountry{CountryCode: country},
+		Info:        models.SteamServerInfo{Players: players, Bots: bots, Map: "bloodrun"},
+	}
+}
+
+func TestHistory(t *testing.T) {
+	db, err := OpenHistoryDB()
+	if err != nil {
+		t.Fatalf("Unable to open test history database: %s", err)
+	}
+	defer db.Close()
+	if _, err := db.db.Exec("DELETE FROM history"); err != nil {
+		t.Fatalf("Unable to clear test history database: %s", err)
+	}
+
+	// two samples per bucket of 100 seconds, starting at 1000
+	for i := int64(0); i < 4; i++ {
+		servers := []models.APIServer{
+			testHistoryServer(1, "QuakeLive", "US", int16(2*i), 0),
+			testHistoryServer(2, "QuakeLive", "DE", 4, 1),
+			testHistoryServer(3, "Reflex", "US", 1, 0),
+			// no ID; not recorded
+			testHistoryServer(0, "QuakeLive", "US", 8, 0),
+		}
+		if err := db.AddHistory(1000+i*50, servers); err != nil {
+			t.Fatalf("Unexpected error when adding history: %s", err)
+		}
+	}
+	hl, err := db.GetHistory(HistoryQuery{IDs: []int64{1}, Games: []string{"quakelive"},
+		Countries: []string{"us"}, From: 1000, To: 1200, Resolution: 100})
+	if err != nil {
+		t.Fatalf("Unexpected error when getting history: %s", err)
+	}
+	if hl.SeriesCount != 3 {
+		t.Fatalf("Expected 3 series, got: %d", hl.SeriesCount)
+	}
+	server, game, country := hl.Series[0], hl.Series[1], hl.Series[2]
+	if server.ServerID != 1 || len(server.Points) != 2 {
+		t.Fatalf("Expected 2 points for server 1, got: %+v", server)
+	}
+	if server.Points[0].Players != 1 || server.Points[1].Players != 5 {
+		t.Fatalf("Expected averages of 1 and 5 players, got: %+v", server.Points)
+	}
+	if server.Points[1].Timestamp != 1100 || server.Points[1].Map != "bloodrun" {
+		t.Fatalf("Expected second bucket at 1100 on bloodrun, got: %+v",
+			server.Points[1])
+	}
+	// totals of servers 1 and 2
+	if game.Game != "quakelive" || game.Points[1].Players != 9 ||
+		game.Points[1].Bots != 1 {
+		t.Fatalf("Expected quakelive totals of 9 players and 1 bot, got: %+v", game)
+	}
+	// totals of servers 1 and 3
+	if country.CountryCode != "US" || country.Points[0].Players != 2 {
+		t.Fatalf("Expected US total of 2 players, got: %+v", country)
+	}
+
+	// raw samples before 1100 are averaged; everything before 1000 is removed
+	if err := db.Downsample(1100, 100, 1000); err != nil {
+		t.Fatalf("Unexpected error when downsampling: %s", err)
+	}
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM history").Scan(&count); err != nil {
+		t.Fatalf("Unexpected error when counting history: %s", err)
+	}
+	// one downsampled sample per server, plus two raw samples per server
+	if count != 9 {
+		t.Fatalf("Expected 9 samples after downsampling, got: %d", count)
+	}
+	hl, err = db.GetHistory(HistoryQuery{IDs: []int64{1}, From: 1000, To: 1200})
+	if err != nil {
+		t.Fatalf("Unexpected error when getting history: %s", err)
+	}
+	points := hl.Series[0].Points
+	if len(points) != 3 || points[0].Timestamp != 1000 || points[0].Players != 1 {
+		t.Fatalf("Expected downsampled point followed by raw points, got: %+v",
+			points)
+	}
+	if err := db.Downsample(1100, 100, 1100); err != nil {
+		t.Fatalf("Unexpected error when removing history: %s", err)
+	}
+	hl, err = db.GetHistory(HistoryQuery{IDs: []int64{1}, From: 0, To: 1100})
+	if err != nil {
+		t.Fatalf("Unexpected error when getting history: %s", err)
+	}
+	if len(hl.Series) != 1 || len(hl.Series[0].Points) != 1 {
+		t.Fatalf("Expected history before 1100 to be removed, got: %+v", hl.Series)
+	}
+}
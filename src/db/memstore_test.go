@@ -0,0 +1,468 @@
+package db
+
+// In-memory server store that stands in for the database server stores in the
+// server store tests
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syncore/a2sapi/src/models"
+	"github.com/syncore/a2sapi/src/steam/filters"
+)
+
+// memStore is a server store that is kept in memory and lost when it is closed.
+// It behaves the same as the database server stores.
+type memStore struct {
+	mu          sync.Mutex
+	servers     []memServer
+	snapshots   []memSnapshot
+	webhooks    []models.WebhookRule
+	deadLetters []models.WebhookDeadLetter
+	reliability map[int64]*memReliability
+	// last IDs that were given out, which are never re-used
+	lastSnapshotID   int64
+	lastWebhookID    int64
+	lastDeadLetterID int64
+}
+
+type memServer struct {
+	models.DbServer
+	retired    int64
+	mergedInto int64
+}
+
+type memSnapshot struct {
+	id        int64
+	game      string
+	retrieved int64
+	data      []byte
+}
+
+type memReliability struct {
+	models.ServerReliability
+	responseMs float64
+	timed      int
+}
+
+// newMemStore returns an empty in-memory server store.
+func newMemStore() *memStore {
+	return &memStore{reliability: make(map[int64]*memReliability)}
+}
+
+// Close does nothing; the store is kept until it is no longer referenced.
+func (ms *memStore) Close() {}
+
+// Size returns the size of the stored snapshots in bytes; the rest of the store
+// is not counted.
+func (ms *memStore) Size() (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var size int64
+	for _, s := range ms.snapshots {
+		size += int64(len(s.data))
+	}
+	return size, nil
+}
+
+// Ping does nothing; the store is always available.
+func (ms *memStore) Ping() error {
+	return nil
+}
+
+// server returns the server with the ID, which is also its index plus one.
+func (ms *memStore) server(id int64) *memServer {
+	if id < 1 || id > int64(len(ms.servers)) {
+		return nil
+	}
+	return &ms.servers[id-1]
+}
+
+// activeServer returns the active server with the host and game.
+func (ms *memStore) activeServer(host, game string) *memServer {
+	for i := range ms.servers {
+		s := &ms.servers[i]
+		if s.retired == 0 && s.Host == host && s.Game == game {
+			return s
+		}
+	}
+	return nil
+}
+
+// AddServersToDB adds the hosts with their game names to the store, or updates
+// the time that they were last seen if they are already in the store.
+func (ms *memStore) AddServersToDB(hostsgames map[string]string) {
+	now := time.Now().Unix()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for host, game := range hostsgames {
+		if game == filters.GameUnspecified.String() {
+			continue
+		}
+		if s := ms.activeServer(host, game); s != nil {
+			s.LastSeen = now
+			continue
+		}
+		ms.servers = append(ms.servers, memServer{DbServer: models.DbServer{
+			ID: int64(len(ms.servers) + 1), Host: host, Game: game, FirstSeen: now,
+			LastSeen: now}})
+	}
+}
+
+// GetIDsForServerList sends the IDs of the active servers with the hosts and
+// games over the result channel, with 0 for the hosts that are not in the store.
+func (ms *memStore) GetIDsForServerList(result chan map[string]int64,
+	hosts map[string]string) {
+	ms.mu.Lock()
+	m := make(map[string]int64, len(hosts))
+	for host, game := range hosts {
+		m[host] = 0
+		if s := ms.activeServer(host, game); s != nil {
+			m[host] = s.ID
+		}
+	}
+	ms.mu.Unlock()
+	result <- m
+}
+
+// GetIDsAPIQuery sends the active servers whose host contains any of the hosts
+// over the result channel, ordered by ID.
+func (ms *memStore) GetIDsAPIQuery(result chan *models.DbServerID,
+	hosts []string) {
+	ms.mu.Lock()
+	m := &models.DbServerID{}
+	for _, s := range ms.servers {
+		if s.retired != 0 {
+			continue
+		}
+		for _, h := range hosts {
+			// LIKE in SQLite is case-insensitive
+			if strings.Contains(strings.ToLower(s.Host), strings.ToLower(h)) {
+				sid := s.DbServer
+				if r, ok := ms.reliability[s.ID]; ok {
+					sid.Reliability = computeReliability(r.ServerReliability,
+						r.responseMs, r.timed)
+				}
+				m.Servers = append(m.Servers, sid)
+				break
+			}
+		}
+	}
+	ms.mu.Unlock()
+	m.ServerCount = len(m.Servers)
+	result <- m
+}
+
+// GetHostsAndGameFromIDAPIQuery sends the hosts and game names of the servers
+// with the IDs over the result channel. The IDs of merged servers resolve to the
+// server that they were merged into; retired servers are left out.
+func (ms *memStore) GetHostsAndGameFromIDAPIQuery(result chan map[string]string,
+	ids []string) {
+	ms.mu.Lock()
+	hosts := make(map[string]string, len(ids))
+	for _, id := range ids {
+		if host, game := ms.hostAndGame(id); host != "" || game != "" {
+			hosts[host] = game
+		}
+	}
+	ms.mu.Unlock()
+	result <- hosts
+}
+
+func (ms *memStore) hostAndGame(id string) (host, game string) {
+	sid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return "", ""
+	}
+	s := ms.server(sid)
+	if s == nil {
+		return "", ""
+	}
+	if s.mergedInto != 0 {
+		s = ms.server(s.mergedInto)
+	}
+	if s == nil || s.retired != 0 {
+		return "", ""
+	}
+	return s.Host, s.Game
+}
+
+// GetStaleServers retrieves the active servers that have not been seen since the
+// timestamp, least recently seen first.
+func (ms *memStore) GetStaleServers(before int64) ([]models.DbServer, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	servers := make([]models.DbServer, 0)
+	for _, s := range ms.servers {
+		if s.retired == 0 && s.LastSeen < before {
+			servers = append(servers, s.DbServer)
+		}
+	}
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].LastSeen < servers[j].LastSeen
+	})
+	return servers, nil
+}
+
+// RetireServers retires the active servers with the IDs, returning the number of
+// servers that were retired.
+func (ms *memStore) RetireServers(ids []int64) (int64, error) {
+	now := time.Now().Unix()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var n int64
+	for _, id := range ids {
+		if s := ms.server(id); s != nil && s.retired == 0 {
+			s.retired = now
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MergeServer retires the server with the ID and resolves the ID (and any IDs
+// that were merged into it) to the server with the into ID from then on. Both
+// servers must be active.
+func (ms *memStore) MergeServer(id, into int64) error {
+	if id == into {
+		return errors.New("a server cannot be merged into itself")
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	s, t := ms.server(id), ms.server(into)
+	if s == nil || t == nil || s.retired != 0 || t.retired != 0 {
+		return ErrServerNotFound
+	}
+	s.retired = time.Now().Unix()
+	s.mergedInto = into
+	for i := range ms.servers {
+		if ms.servers[i].mergedInto == id {
+			ms.servers[i].mergedInto = into
+		}
+	}
+	return nil
+}
+
+// PruneServers retires the active servers that have not been seen since the
+// timestamp, returning the number of servers that were retired.
+func (ms *memStore) PruneServers(before int64) (int64, error) {
+	now := time.Now().Unix()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var n int64
+	for i := range ms.servers {
+		if s := &ms.servers[i]; s.retired == 0 && s.LastSeen < before {
+			s.retired = now
+			n++
+		}
+	}
+	return n, nil
+}
+
+// SaveSnapshot stores the master server list of the game and removes all but the
+// game's most recent snapshots.
+func (ms *memStore) SaveSnapshot(game string, sl *models.APIServerList) error {
+	data, err := json.Marshal(sl)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.lastSnapshotID++
+	ms.snapshots = append(ms.snapshots, memSnapshot{id: ms.lastSnapshotID,
+		game: game, retrieved: sl.RetrievedTimeStamp, data: data})
+	sort.Slice(ms.snapshots, func(i, j int) bool {
+		a, b := ms.snapshots[i], ms.snapshots[j]
+		if a.retrieved != b.retrieved {
+			return a.retrieved > b.retrieved
+		}
+		return a.id > b.id
+	})
+	kept, count := ms.snapshots[:0], 0
+	for _, s := range ms.snapshots {
+		if s.game == game {
+			if count == maxSnapshotsPerGame {
+				continue
+			}
+			count++
+		}
+		kept = append(kept, s)
+	}
+	ms.snapshots = kept
+	return nil
+}
+
+// GetLatestSnapshot retrieves the most recent snapshot of the game's master
+// server list, along with the time at which the list was retrieved. A nil list
+// is returned if there is no snapshot that is newer than maxAge.
+func (ms *memStore) GetLatestSnapshot(game string,
+	maxAge time.Duration) (*models.APIServerList, time.Time, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	// snapshots are kept newest first
+	for _, s := range ms.snapshots {
+		if s.game != game {
+			continue
+		}
+		rt := time.Unix(s.retrieved, 0)
+		if time.Since(rt) > maxAge {
+			return nil, rt, nil
+		}
+		sl := &models.APIServerList{}
+		if err := json.Unmarshal(s.data, sl); err != nil {
+			return nil, rt, err
+		}
+		return sl, rt, nil
+	}
+	return nil, time.Time{}, nil
+}
+
+func copyWebhook(rule models.WebhookRule) models.WebhookRule {
+	rule.ServerIDs = append(make([]int64, 0, len(rule.ServerIDs)),
+		rule.ServerIDs...)
+	return rule
+}
+
+// AddWebhook stores the webhook rule and returns its new ID.
+func (ms *memStore) AddWebhook(rule models.WebhookRule) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.lastWebhookID++
+	rule = copyWebhook(rule)
+	rule.ID = ms.lastWebhookID
+	ms.webhooks = append(ms.webhooks, rule)
+	return rule.ID, nil
+}
+
+// UpdateWebhook replaces the webhook rule with the same ID, keeping the time
+// that it was created. Returns false if there is no such rule.
+func (ms *memStore) UpdateWebhook(rule models.WebhookRule) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for i, r := range ms.webhooks {
+		if r.ID == rule.ID {
+			rule = copyWebhook(rule)
+			rule.CreatedAt = r.CreatedAt
+			ms.webhooks[i] = rule
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteWebhook removes the webhook rule. Returns false if there is no such rule.
+func (ms *memStore) DeleteWebhook(id int64) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for i, r := range ms.webhooks {
+		if r.ID == id {
+			ms.webhooks = append(ms.webhooks[:i], ms.webhooks[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetWebhooks retrieves all of the webhook rules, or only the enabled ones.
+func (ms *memStore) GetWebhooks(enabledOnly bool) ([]models.WebhookRule, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	rules := make([]models.WebhookRule, 0)
+	for _, r := range ms.webhooks {
+		if r.Enabled || !enabledOnly {
+			rules = append(rules, copyWebhook(r))
+		}
+	}
+	return rules, nil
+}
+
+// AddDeadLetter records a failed webhook delivery and removes all but the most
+// recent failed deliveries.
+func (ms *memStore) AddDeadLetter(dl models.WebhookDeadLetter) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.lastDeadLetterID++
+	dl.ID = ms.lastDeadLetterID
+	ms.deadLetters = append(ms.deadLetters, dl)
+	if len(ms.deadLetters) > maxDeadLetters {
+		ms.deadLetters = ms.deadLetters[len(ms.deadLetters)-maxDeadLetters:]
+	}
+	return nil
+}
+
+// GetDeadLetters retrieves the most recent failed webhook deliveries, newest
+// first.
+func (ms *memStore) GetDeadLetters(limit int) ([]models.WebhookDeadLetter,
+	error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	dls := make([]models.WebhookDeadLetter, 0)
+	for i := len(ms.deadLetters) - 1; i >= 0 && len(dls) < limit; i-- {
+		dls = append(dls, ms.deadLetters[i])
+	}
+	return dls, nil
+}
+
+// RecordResponses records the outcome of a timed retrieval of the game's servers
+// at the timestamp. Failed hosts that are not in the store are ignored.
+func (ms *memStore) RecordResponses(game string, timestamp int64,
+	responded map[int64]float64, failed []string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for id, ping := range responded {
+		if id == 0 {
+			continue
+		}
+		r, ok := ms.reliability[id]
+		if !ok {
+			r = &memReliability{}
+			r.FirstSeen = timestamp
+			ms.reliability[id] = r
+		}
+		r.Checks++
+		r.Responses++
+		r.ConsecutiveFailures = 0
+		r.responseMs += ping
+		if ping > 0 {
+			r.timed++
+		}
+		if r.FirstSeen == 0 {
+			r.FirstSeen = timestamp
+		}
+		r.LastSeen = timestamp
+	}
+	for _, host := range failed {
+		s := ms.activeServer(host, game)
+		if s == nil {
+			continue
+		}
+		r, ok := ms.reliability[s.ID]
+		if !ok {
+			r = &memReliability{}
+			ms.reliability[s.ID] = r
+		}
+		r.Checks++
+		r.ConsecutiveFailures++
+	}
+	return nil
+}
+
+// GetReliability retrieves the response history of the servers with the IDs.
+// Servers that have not been checked by a timed retrieval are left out.
+func (ms *memStore) GetReliability(ids []int64) (map[int64]models.ServerReliability,
+	error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	m := make(map[int64]models.ServerReliability, len(ids))
+	for _, id := range ids {
+		if r, ok := ms.reliability[id]; ok {
+			m[id] = computeReliability(r.ServerReliability, r.responseMs, r.timed)
+		}
+	}
+	return m, nil
+}
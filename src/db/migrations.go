@@ -0,0 +1,253 @@
+package db
+
+// migrations.go - versioned schema migrations of the server store
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/constants"
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/util"
+)
+
+// migration is a change to the schema of a database. Migrations are applied in
+// order of version, each in its own transaction along with the recording of its
+// version.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// MigrationStatus is the state of a schema migration of a database. Applied is
+// the unix timestamp of when the migration was applied, or zero if it has not
+// been applied.
+type MigrationStatus struct {
+	Version     int
+	Description string
+	Applied     int64
+}
+
+// sqliteMigrations are the schema migrations of the SQLite server database. Databases
+// from before the schema version was recorded have no version, so the migrations
+// up to the reliability table also leave the tables of those databases as they
+// are. New migrations are appended; released migrations are never changed.
+var sqliteMigrations = []migration{
+	{1, "Create servers table", createServersTable},
+	{2, "Add first_seen, last_seen, retired and merged_into to servers",
+		addServerSeenColumns},
+	{3, "Create snapshots table", createSnapshotsTable},
+	{4, "Create webhook tables", createWebhooksTables},
+	{5, "Create server reliability table", createReliabilityTable},
+	{6, "Add unique index on the host and game of active servers",
+		addServerHostGameIndex},
+}
+
+func createSchemaVersionTable(db *sql.DB) error {
+	create := `CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER NOT NULL,
+	description TEXT NOT NULL,
+	applied BIGINT NOT NULL,
+	PRIMARY KEY(version)
+	)`
+	if _, err := db.Exec(create); err != nil {
+		return logger.LogAppErrorf("Unable to create schema version table in DB: %s",
+			err)
+	}
+	return nil
+}
+
+// schemaVersion returns the version of the most recent migration that was applied
+// to the database, or zero if none have been applied.
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(
+		&version)
+	if err != nil {
+		return 0, logger.LogAppErrorf("Unable to read schema version: %s", err)
+	}
+	return version, nil
+}
+
+// migrate applies the dialect's migrations that are newer than the database's
+// schema version, returning the number of migrations that were applied. The
+// migrations that were applied before one that fails are kept.
+func migrate(db *sql.DB, d *dialect) (int, error) {
+	if err := createSchemaVersionTable(db); err != nil {
+		return 0, err
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	latest := d.migrations[len(d.migrations)-1].version
+	if version > latest {
+		return 0, logger.LogAppErrorf(
+			"Database schema version %d is newer than the latest supported version %d",
+			version, latest)
+	}
+	applied := 0
+	for _, m := range d.migrations {
+		if m.version <= version {
+			continue
+		}
+		ok, err := applyMigration(db, d, m)
+		if err != nil {
+			return applied, logger.LogAppErrorf(
+				"Unable to apply database migration %d (%s): %s", m.version,
+				m.description, err)
+		}
+		if !ok {
+			continue
+		}
+		logger.LogAppInfo("Applied %s database migration %d: %s", d.name,
+			m.version, m.description)
+		applied++
+	}
+	return applied, nil
+}
+
+// applyMigration applies the migration unless another a2sapi instance that
+// shares the database has applied it in the meantime, in which case false is
+// returned.
+func applyMigration(db *sql.DB, d *dialect, m migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	var done int
+	if d.lockMigrations != "" {
+		_, err = tx.Exec(d.lockMigrations)
+	}
+	if err == nil {
+		err = tx.QueryRow("SELECT COUNT(*) FROM schema_version WHERE version = $1",
+			m.version).Scan(&done)
+	}
+	if err == nil && done == 0 {
+		err = m.up(tx)
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_version (version, description, applied)
+			VALUES ($1, $2, $3)`, m.version, m.description, time.Now().Unix())
+		}
+	}
+	if err != nil || done != 0 {
+		if rerr := tx.Rollback(); rerr != nil {
+			logger.LogAppErrorf("Migration error rolling back tx: %s", rerr)
+		}
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// migrationStatus returns the state of each of the dialect's migrations, as well
+// as any applied migrations that are unknown, i.e. from a newer version of
+// a2sapi.
+func migrationStatus(db *sql.DB, d *dialect) ([]MigrationStatus, error) {
+	applied := make(map[int]MigrationStatus)
+	var exists int
+	if err := db.QueryRow(d.countTables, "schema_version").Scan(&exists); err != nil {
+		return nil, logger.LogAppErrorf("Unable to read schema version: %s", err)
+	}
+	if exists != 0 {
+		rows, err := db.Query(
+			"SELECT version, description, applied FROM schema_version ORDER BY version")
+		if err != nil {
+			return nil, logger.LogAppErrorf("Unable to read schema version: %s", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			s := MigrationStatus{}
+			if err := rows.Scan(&s.Version, &s.Description, &s.Applied); err != nil {
+				return nil, logger.LogAppErrorf("Unable to read schema version: %s", err)
+			}
+			applied[s.Version] = s
+		}
+		if err := rows.Err(); err != nil {
+			return nil, logger.LogAppErrorf("Unable to read schema version: %s", err)
+		}
+	}
+	status := make([]MigrationStatus, 0, len(d.migrations))
+	for _, m := range d.migrations {
+		s := MigrationStatus{Version: m.version, Description: m.description}
+		if a, ok := applied[m.version]; ok {
+			s.Applied = a.Applied
+			delete(applied, m.version)
+		}
+		status = append(status, s)
+	}
+	unknown := make([]int, 0, len(applied))
+	for v := range applied {
+		unknown = append(unknown, v)
+	}
+	sort.Ints(unknown)
+	for _, v := range unknown {
+		status = append(status, applied[v])
+	}
+	return status, nil
+}
+
+// MigrateServerDB applies the pending schema migrations to the server store that
+// is selected in the configuration, creating the SQLite server database if it
+// does not exist. Returns the number of migrations that were applied.
+func MigrateServerDB() (int, error) {
+	if config.Config.DBConfig.ServerStore == config.ServerStorePostgres {
+		conn, err := openPostgres(config.Config.DBConfig.PostgresURL)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		return migrate(conn, postgresDialect)
+	}
+	if err := util.CreateDirectory(constants.DbDirectory); err != nil {
+		return 0, logger.LogAppErrorf("Unable to create database directory %s: %s",
+			constants.DbDirectory, err)
+	}
+	return migrateServerDB(constants.GetServerDBPath())
+}
+
+func migrateServerDB(dbfile string) (int, error) {
+	if !util.FileExists(dbfile) {
+		if err := util.CreateEmptyFile(dbfile, true); err != nil {
+			return 0, logger.LogAppErrorf("Unable to create server DB: %s", err)
+		}
+	}
+	conn, err := openSQLite(dbfile)
+	if err != nil {
+		return 0, logger.LogAppErrorf("Unable to open server DB for migration: %s",
+			err)
+	}
+	defer conn.Close()
+	return migrate(conn, sqliteDialect)
+}
+
+// ServerDBStatus returns the state of the schema migrations of the server store
+// that is selected in the configuration without applying any. All migrations are
+// pending if the SQLite server database does not exist.
+func ServerDBStatus() ([]MigrationStatus, error) {
+	if config.Config.DBConfig.ServerStore == config.ServerStorePostgres {
+		conn, err := openPostgres(config.Config.DBConfig.PostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return migrationStatus(conn, postgresDialect)
+	}
+	dbfile := constants.GetServerDBPath()
+	if !util.FileExists(dbfile) {
+		status := make([]MigrationStatus, 0, len(sqliteMigrations))
+		for _, m := range sqliteMigrations {
+			status = append(status, MigrationStatus{Version: m.version,
+				Description: m.description})
+		}
+		return status, nil
+	}
+	conn, err := openSQLite(dbfile)
+	if err != nil {
+		return nil, logger.LogAppErrorf("Unable to open server DB: %s", err)
+	}
+	defer conn.Close()
+	return migrationStatus(conn, sqliteDialect)
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTempDB(t *testing.T) *sql.DB {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "servers.sqlite"))
+	if err != nil {
+		t.Fatalf("Unable to open test database: %s", err)
+	}
+	return conn
+}
+
+func TestMigrateLegacyServerDB(t *testing.T) {
+	conn := openTempDB(t)
+	defer conn.Close()
+	// a server database from before the schema version was recorded
+	if _, err := conn.Exec(`CREATE TABLE servers (server_id INTEGER NOT NULL,
+	host TEXT NOT NULL, game TEXT NOT NULL, PRIMARY KEY(server_id))`); err != nil {
+		t.Fatalf("Unable to create old servers table: %s", err)
+	}
+	// servers that were added twice by concurrent list builds
+	if _, err := conn.Exec(`INSERT INTO servers (host, game) VALUES
+	('10.9.1.1:27960', 'QuakeLive'), ('10.9.1.1:27960', 'QuakeLive')`); err != nil {
+		t.Fatalf("Unable to add server: %s", err)
+	}
+	before := time.Now().Unix()
+	n, err := migrate(conn, sqliteDialect)
+	if err != nil || n != len(sqliteMigrations) {
+		t.Fatalf("Expected all migrations to be applied, got: %d (%v)", n, err)
+	}
+	if n, err = migrate(conn, sqliteDialect); err != nil || n != 0 {
+		t.Fatalf("Expected no migrations to be re-applied, got: %d (%v)", n, err)
+	}
+	var id, first, last, retired int64
+	if err := conn.QueryRow(`SELECT server_id, first_seen, last_seen, retired
+	FROM servers WHERE retired = 0`).Scan(&id, &first, &last,
+		&retired); err != nil {
+		t.Fatalf("Unable to read migrated server: %s", err)
+	}
+	if id != 1 || first < before || last < before || retired != 0 {
+		t.Fatalf("Unexpected migrated server: ID %d, first seen %d, last seen %d, "+
+			"retired %d", id, first, last, retired)
+	}
+	var merged int64
+	if err := conn.QueryRow(`SELECT merged_into FROM servers
+	WHERE server_id = 2 AND retired != 0`).Scan(&merged); err != nil || merged != 1 {
+		t.Fatalf("Expected the duplicate server to be merged into 1, got: %d (%v)",
+			merged, err)
+	}
+	status, err := migrationStatus(conn, sqliteDialect)
+	if err != nil {
+		t.Fatalf("Unexpected error getting migration status: %s", err)
+	}
+	for _, s := range status {
+		if s.Applied < before {
+			t.Fatalf("Expected migration %d to be applied, got: %+v", s.Version, s)
+		}
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	conn := openTempDB(t)
+	defer conn.Close()
+	d := *sqliteDialect
+	d.migrations = []migration{
+		{1, "Create a table", func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE TABLE a (id INTEGER NOT NULL)")
+			return err
+		}},
+		{2, "Create a table and fail", func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE b (id INTEGER NOT NULL)"); err != nil {
+				return err
+			}
+			return errors.New("failed")
+		}},
+	}
+	if n, err := migrate(conn, &d); err == nil || n != 1 {
+		t.Fatalf("Expected the second migration to fail, got: %d (%v)", n, err)
+	}
+	if v, _ := schemaVersion(conn); v != 1 {
+		t.Fatalf("Expected schema version 1, got: %d", v)
+	}
+	var tables int
+	conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table'
+	AND name='b'`).Scan(&tables)
+	if tables != 0 {
+		t.Fatalf("Expected the failed migration to be rolled back")
+	}
+	status, _ := migrationStatus(conn, &d)
+	if len(status) != 2 || status[0].Applied == 0 || status[1].Applied != 0 {
+		t.Fatalf("Expected migration 2 to be pending, got: %+v", status)
+	}
+	// databases from newer versions are not changed
+	conn.Exec(`INSERT INTO schema_version (version, description, applied)
+	VALUES (3, 'Newer', 1)`)
+	if n, err := migrate(conn, &d); err == nil || n != 0 {
+		t.Fatalf("Expected a newer schema version to be refused, got: %d (%v)", n,
+			err)
+	}
+}
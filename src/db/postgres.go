@@ -0,0 +1,113 @@
+package db
+
+// postgres.go - server store in a PostgreSQL database that can be shared by
+// several a2sapi instances
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/syncore/a2sapi/src/logger"
+	// blank import for postgres driver
+	_ "github.com/lib/pq"
+)
+
+var postgresDialect = &dialect{
+	name:       "PostgreSQL",
+	migrations: postgresMigrations,
+	countTables: `SELECT COUNT(*) FROM information_schema.tables
+	WHERE table_schema = current_schema() AND table_name = $1`,
+	lockMigrations: "LOCK TABLE schema_version IN EXCLUSIVE MODE",
+	size:           "SELECT pg_database_size(current_database())",
+}
+
+// postgresMigrations are the schema migrations of the PostgreSQL server store,
+// which starts out with the schema that the SQLite server database was migrated
+// to. New migrations are appended; released migrations are never changed.
+var postgresMigrations = []migration{
+	{1, "Create tables", createPostgresTables},
+}
+
+func createPostgresTables(tx *sql.Tx) error {
+	create := []string{`CREATE TABLE IF NOT EXISTS servers (
+	server_id BIGSERIAL PRIMARY KEY,
+	host TEXT NOT NULL,
+	game TEXT NOT NULL,
+	first_seen BIGINT NOT NULL DEFAULT 0,
+	last_seen BIGINT NOT NULL DEFAULT 0,
+	retired BIGINT NOT NULL DEFAULT 0,
+	merged_into BIGINT NOT NULL DEFAULT 0
+	)`, `CREATE UNIQUE INDEX IF NOT EXISTS servers_host_game
+	ON servers (host, game) WHERE retired = 0`,
+		`CREATE TABLE IF NOT EXISTS snapshots (
+	snapshot_id BIGSERIAL PRIMARY KEY,
+	game TEXT NOT NULL,
+	retrieved BIGINT NOT NULL,
+	data BYTEA NOT NULL
+	)`, `CREATE TABLE IF NOT EXISTS webhooks (
+	webhook_id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	server_ids TEXT NOT NULL,
+	min_players INTEGER NOT NULL,
+	filter TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	created BIGINT NOT NULL
+	)`, `CREATE TABLE IF NOT EXISTS webhook_deadletters (
+	deadletter_id BIGSERIAL PRIMARY KEY,
+	webhook_id BIGINT NOT NULL,
+	url TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	failed BIGINT NOT NULL
+	)`, `CREATE TABLE IF NOT EXISTS server_reliability (
+	server_id BIGINT PRIMARY KEY,
+	checks BIGINT NOT NULL,
+	responses BIGINT NOT NULL,
+	response_ms DOUBLE PRECISION NOT NULL,
+	timed_responses BIGINT NOT NULL,
+	consecutive_failures BIGINT NOT NULL,
+	first_seen BIGINT NOT NULL,
+	last_seen BIGINT NOT NULL
+	)`}
+	for _, c := range create {
+		if _, err := tx.Exec(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenPostgresServerDB opens a connection to the PostgreSQL server store at the
+// URL and applies its pending schema migrations.
+func OpenPostgresServerDB(url string) (*SDB, error) {
+	conn, err := openPostgres(url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrate(conn, postgresDialect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &SDB{db: conn, dialect: postgresDialect}, nil
+}
+
+func openPostgres(url string) (*sql.DB, error) {
+	if url == "" {
+		return nil, logger.LogAppError(errors.New(
+			"No PostgreSQL URL is configured for the server store"))
+	}
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, logger.LogAppErrorf("Unable to open PostgreSQL server store: %s",
+			err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, logger.LogAppErrorf(
+			"Unable to connect to PostgreSQL server store: %s", err)
+	}
+	return conn, nil
+}
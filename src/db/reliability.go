@@ -0,0 +1,150 @@
+package db
+
+// reliability.go - response history of the servers across the timed retrievals
+
+import (
+	"database/sql"
+
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// maximum number of values per query, below SQLite's limit on the number of
+// host parameters (PostgreSQL's is far higher)
+const maxValuesPerQuery = 500
+
+func createReliabilityTable(tx *sql.Tx) error {
+	create := `CREATE TABLE IF NOT EXISTS server_reliability (
+	server_id INTEGER NOT NULL,
+	checks INTEGER NOT NULL,
+	responses INTEGER NOT NULL,
+	response_ms REAL NOT NULL,
+	timed_responses INTEGER NOT NULL,
+	consecutive_failures INTEGER NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen INTEGER NOT NULL,
+	PRIMARY KEY(server_id)
+	)`
+	_, err := tx.Exec(create)
+	return err
+}
+
+// RecordResponses records the outcome of a timed retrieval of the game's servers
+// at the timestamp. responded maps the IDs of the servers that responded to
+// their ping in milliseconds (0 if not measured); failed are the hosts that did
+// not respond. Failed hosts that are not in the server database are ignored.
+func (sdb *SDB) RecordResponses(game string, timestamp int64,
+	responded map[int64]float64, failed []string) error {
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return logger.LogAppErrorf("RecordResponses error creating tx: %s", err)
+	}
+	err = recordResponses(tx, game, timestamp, responded, failed)
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			logger.LogAppErrorf("RecordResponses error rolling back tx: %s", rerr)
+		}
+		return logger.LogAppErrorf("RecordResponses exec error: %s", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return logger.LogAppErrorf("RecordResponses error committing tx: %s", err)
+	}
+	return nil
+}
+
+func recordResponses(tx *sql.Tx, game string, timestamp int64,
+	responded map[int64]float64, failed []string) error {
+	success, err := tx.Prepare(`INSERT INTO server_reliability (server_id, checks,
+	responses, response_ms, timed_responses, consecutive_failures, first_seen,
+	last_seen) VALUES ($1, 1, 1, $2, $3, 0, $4, $4)
+	ON CONFLICT(server_id) DO UPDATE SET checks = server_reliability.checks + 1,
+	responses = server_reliability.responses + 1,
+	response_ms = server_reliability.response_ms + excluded.response_ms,
+	timed_responses = server_reliability.timed_responses + excluded.timed_responses,
+	consecutive_failures = 0, last_seen = excluded.last_seen,
+	first_seen = CASE WHEN server_reliability.first_seen = 0
+	THEN excluded.first_seen ELSE server_reliability.first_seen END`)
+	if err != nil {
+		return err
+	}
+	defer success.Close()
+	for id, ping := range responded {
+		if id == 0 {
+			continue
+		}
+		timed := 0
+		if ping > 0 {
+			timed = 1
+		}
+		if _, err := success.Exec(id, ping, timed, timestamp); err != nil {
+			return err
+		}
+	}
+	failure, err := tx.Prepare(`INSERT INTO server_reliability (server_id, checks,
+	responses, response_ms, timed_responses, consecutive_failures, first_seen,
+	last_seen) SELECT server_id, 1, 0, 0, 0, 1, 0, 0 FROM servers
+	WHERE host = $1 AND game = $2 AND retired = 0
+	ON CONFLICT(server_id) DO UPDATE SET checks = server_reliability.checks + 1,
+	consecutive_failures = server_reliability.consecutive_failures + 1`)
+	if err != nil {
+		return err
+	}
+	defer failure.Close()
+	for _, host := range failed {
+		if _, err := failure.Exec(host, game); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetReliability retrieves the response history of the servers with the IDs.
+// Servers that have not been checked by a timed retrieval are left out.
+func (sdb *SDB) GetReliability(ids []int64) (map[int64]models.ServerReliability,
+	error) {
+	m := make(map[int64]models.ServerReliability, len(ids))
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	err := forEachChunk(len(args), func(start, end int) error {
+		rows, err := sdb.db.Query(`SELECT server_id, checks, responses, response_ms,
+		timed_responses, consecutive_failures, first_seen, last_seen
+		FROM server_reliability WHERE server_id IN (`+numberedPlaceholders(1, end-start)+`)`,
+			args[start:end]...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var responseMs float64
+			var timed int
+			r := models.ServerReliability{}
+			if err := rows.Scan(&id, &r.Checks, &r.Responses, &responseMs, &timed,
+				&r.ConsecutiveFailures, &r.FirstSeen, &r.LastSeen); err != nil {
+				return err
+			}
+			m[id] = computeReliability(r, responseMs, timed)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, logger.LogAppErrorf(
+			"GetReliability: Error querying database: %s", err)
+	}
+	return m, nil
+}
+
+// computeReliability sets the availability and average response time from the
+// totals.
+func computeReliability(r models.ServerReliability, responseMs float64,
+	timed int) models.ServerReliability {
+	if r.Checks > 0 {
+		r.Availability = float64(r.Responses) * 100 / float64(r.Checks)
+	}
+	if timed > 0 {
+		r.AvgResponseMs = responseMs / float64(timed)
+	}
+	return r
+}
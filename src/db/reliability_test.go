@@ -0,0 +1,70 @@
+package db
+
+import (
+	"math"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func TestRecordResponses(t *testing.T) {
+	db, err := OpenServerDB()
+	if err != nil {
+		t.Fatalf("Unable to open test database: %s", err)
+	}
+	defer db.Close()
+	// keeps the IDs that the server tests expect for their hosts
+	db.AddServersToDB(testData)
+	stable, flaky := "10.9.0.1:27960", "10.9.0.2:27960"
+	db.AddServersToDB(map[string]string{stable: "QuakeLive", flaky: "QuakeLive"})
+	c := make(chan map[string]int64, 1)
+	db.GetIDsForServerList(c, map[string]string{stable: "QuakeLive",
+		flaky: "QuakeLive"})
+	ids := <-c
+	if ids[stable] == 0 || ids[flaky] == 0 {
+		t.Fatalf("Expected IDs for the test servers, got: %v", ids)
+	}
+
+	runs := []struct {
+		responded map[int64]float64
+		failed    []string
+	}{
+		{map[int64]float64{ids[stable]: 20, ids[flaky]: 30}, nil},
+		// hosts that are not in the database are ignored
+		{map[int64]float64{ids[stable]: 40}, []string{flaky, "10.9.0.3:27960"}},
+		{map[int64]float64{ids[stable]: 0}, []string{flaky}},
+	}
+	for i, run := range runs {
+		if err := db.RecordResponses("QuakeLive", int64(1000+i), run.responded,
+			run.failed); err != nil {
+			t.Fatalf("Unexpected error recording responses: %s", err)
+		}
+	}
+	rel, err := db.GetReliability([]int64{ids[stable], ids[flaky], 999999})
+	if err != nil {
+		t.Fatalf("Unexpected error getting reliability: %s", err)
+	}
+	if len(rel) != 2 {
+		t.Fatalf("Expected reliability of 2 servers, got: %+v", rel)
+	}
+	s := rel[ids[stable]]
+	// the unmeasured ping is left out of the average
+	if s.Checks != 3 || s.Responses != 3 || s.Availability != 100 ||
+		s.AvgResponseMs != 30 || s.ConsecutiveFailures != 0 ||
+		s.FirstSeen != 1000 || s.LastSeen != 1002 {
+		t.Fatalf("Unexpected reliability of the stable server: %+v", s)
+	}
+	f := rel[ids[flaky]]
+	if f.Checks != 3 || f.Responses != 1 || math.Abs(f.Availability-33.33) > 0.01 ||
+		f.AvgResponseMs != 30 || f.ConsecutiveFailures != 2 ||
+		f.FirstSeen != 1000 || f.LastSeen != 1000 {
+		t.Fatalf("Unexpected reliability of the flaky server: %+v", f)
+	}
+
+	sc := make(chan *models.DbServerID, 1)
+	db.GetIDsAPIQuery(sc, []string{flaky})
+	sids := <-sc
+	if sids.ServerCount != 1 || sids.Servers[0].Reliability != f {
+		t.Fatalf("Expected server ID with reliability %+v, got: %+v", f, sids)
+	}
+}
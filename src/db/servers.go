@@ -5,111 +5,104 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/syncore/a2sapi/src/constants"
 	"github.com/syncore/a2sapi/src/logger"
 	"github.com/syncore/a2sapi/src/models"
 	"github.com/syncore/a2sapi/src/steam/filters"
-	"github.com/syncore/a2sapi/src/util"
 	// blank import for sqlite3 driver
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // SDB represents a database containing the server ID and game information.
 type SDB struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect *dialect
 }
 
-func createServerDBtable(dbfile string) error {
-	create := `CREATE TABLE servers (
+// createServersTable creates the servers table. Servers are never deleted from
+// the table, only retired, so that the IDs of servers that are no longer seen
+// are never re-used.
+func createServersTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS servers (
 	server_id INTEGER NOT NULL,
 	host TEXT NOT NULL,
 	game TEXT NOT NULL,
 	PRIMARY KEY(server_id)
-	)`
-
-	if util.FileExists(dbfile) {
-		// already exists, so verify integrity
-		db, err := sql.Open("sqlite3", dbfile)
-		if err != nil {
-			return logger.LogAppErrorf(
-				"Unable to open server DB file for verification: %s", err)
-		}
-		defer db.Close()
-		var name string
-		err = db.QueryRow(
-			"SELECT name from sqlite_master where type='table' and name='servers'").Scan(&name)
-		switch {
-		case err == sql.ErrNoRows:
-			if _, err = db.Exec(create); err != nil {
-				return logger.LogAppErrorf("Unable to create servers table in DB: %s", err)
-			}
-		case err != nil:
-			return logger.LogAppErrorf("Server DB table verification error: %s", err)
-		}
-		return nil
-	}
+	)`)
+	return err
+}
 
-	err := util.CreateEmptyFile(dbfile, true)
-	if err != nil {
-		return logger.LogAppErrorf("Unable to create server DB: %s", err)
-	}
+// createServerDBtable creates the server database file if it does not exist and
+// applies the pending schema migrations to it.
+func createServerDBtable(dbfile string) error {
+	_, err := migrateServerDB(dbfile)
+	return err
+}
 
-	db, err := sql.Open("sqlite3", dbfile)
+// addServerHostGameIndex adds a unique index on the host and game of the active
+// servers. Active servers that were added more than once are merged into the
+// first of them.
+func addServerHostGameIndex(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE servers SET retired = $1, merged_into =
+	(SELECT MIN(s.server_id) FROM servers s WHERE s.host = servers.host
+	AND s.game = servers.game AND s.retired = 0)
+	WHERE retired = 0 AND server_id > (SELECT MIN(s.server_id) FROM servers s
+	WHERE s.host = servers.host AND s.game = servers.game AND s.retired = 0)`,
+		time.Now().Unix())
 	if err != nil {
-		return logger.LogAppErrorf(
-			"Unable to open server DB file for table creation: %s", err)
-	}
-	defer db.Close()
-	_, err = db.Exec(create)
-	if err != nil {
-		return logger.LogAppErrorf("Unable to create servers table in servers DB: %s",
-			err)
+		return err
 	}
-	return nil
+	_, err = tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS servers_host_game
+	ON servers (host, game) WHERE retired = 0`)
+	return err
 }
 
-func (sdb *SDB) serverExists(host string, game string) (bool, error) {
-	rows, err := sdb.db.Query(
-		"SELECT host, game FROM servers WHERE host =? AND GAME =? LIMIT 1",
-		host, game)
-	if err != nil {
-		return false, logger.LogAppErrorf(
-			"serverExists: Error querying database for host %s and game %s: %s",
-			host, game, err)
-	}
+// resolvedServerQuery selects the ID, host and game of servers by ID. The IDs of
+// merged servers resolve to the host and game of the server that they were
+// merged into, unless that has since been retired too; retired servers have no
+// host or game.
+const resolvedServerQuery = `SELECT s.server_id, COALESCE(t.host, ''),
+	COALESCE(t.game, '') FROM servers s
+	LEFT JOIN servers t ON t.server_id = CASE WHEN s.merged_into != 0
+	THEN s.merged_into ELSE s.server_id END AND t.retired = 0
+	WHERE s.server_id IN `
 
-	defer rows.Close()
-	h, g := "", ""
-	for rows.Next() {
-		if err := rows.Scan(&h, &g); err != nil {
-			return false, logger.LogAppErrorf(
-				"serverExists: Error querying database for host %s and game %s: %s",
-				host, game, err)
+// forEachChunk calls fn with the bounds of each of the successive chunks of the
+// n values that fit in a query, until fn returns an error.
+func forEachChunk(n int, fn func(start, end int) error) error {
+	for start := 0; start < n; start += maxValuesPerQuery {
+		end := start + maxValuesPerQuery
+		if end > n {
+			end = n
+		}
+		if err := fn(start, end); err != nil {
+			return err
 		}
 	}
-	if h != "" && g != "" {
-		return true, nil
-	}
-	return false, nil
+	return nil
 }
 
+// getHostAndGame retrieves the host and game of the server with the ID. The IDs
+// of merged servers resolve to the server that they were merged into; retired
+// servers have no host or game.
 func (sdb *SDB) getHostAndGame(id string) (host, game string, err error) {
-	rows, err := sdb.db.Query("SELECT host, game FROM servers WHERE server_id =? LIMIT 1",
-		id)
+	sid, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
-		return host, game,
+		return "", "", nil
+	}
+	err = sdb.db.QueryRow(resolvedServerQuery+"($1)", sid).Scan(&sid, &host, &game)
+	switch {
+	case err == sql.ErrNoRows:
+		return "", "", nil
+	case err != nil:
+		return "", "",
 			logger.LogAppErrorf("getHostAndGame: Error querying database for id %s: %s",
 				id, err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		if err := rows.Scan(&host, &game); err != nil {
-			return host, game,
-				logger.LogAppErrorf("getHostAndGame: Error querying database for id %s: %s",
-					id, err)
-		}
-	}
 	return host, game, nil
 }
 
@@ -120,11 +113,11 @@ func OpenServerDB() (*SDB, error) {
 		// will panic if not verified
 		return nil, logger.LogAppError(err)
 	}
-	conn, err := sql.Open("sqlite3", constants.GetServerDBPath())
+	conn, err := openSQLite(constants.GetServerDBPath())
 	if err != nil {
 		return nil, logger.LogAppError(err)
 	}
-	return &SDB{db: conn}, nil
+	return &SDB{db: conn, dialect: sqliteDialect}, nil
 }
 
 // Close closes the server database's underlying connection.
@@ -135,44 +128,37 @@ func (sdb *SDB) Close() {
 	}
 }
 
+// Size returns the size of the server database in bytes.
+func (sdb *SDB) Size() (int64, error) {
+	var size int64
+	if err := sdb.db.QueryRow(sdb.dialect.size).Scan(&size); err != nil {
+		return 0, logger.LogAppErrorf("Unable to get size of server DB: %s", err)
+	}
+	return size, nil
+}
+
+// Ping verifies that the server database can still be reached.
+func (sdb *SDB) Ping() error {
+	return sdb.db.Ping()
+}
+
 // AddServersToDB inserts a specified host and port with its game name into the
-// server database.
+// server database, or updates the time that it was last seen if it is already in
+// the database.
 func (sdb *SDB) AddServersToDB(hostsgames map[string]string) {
-	toInsert := make(map[string]string, len(hostsgames))
-	for host, game := range hostsgames {
-		// If direct queries are enabled, don't add 'Unspecified' game to server DB
-		if game == filters.GameUnspecified.String() {
-			continue
-		}
-		exists, err := sdb.serverExists(host, game)
-		if err != nil {
-			continue
-		}
-		if exists {
-			continue
-		}
-		toInsert[host] = game
-	}
+	now := time.Now().Unix()
 	tx, err := sdb.db.Begin()
 	if err != nil {
 		logger.LogAppErrorf("AddServersToDB error creating tx: %s", err)
 		return
 	}
-	var txexecerr error
-	for host, game := range toInsert {
-		_, txexecerr = tx.Exec("INSERT INTO servers (host, game) VALUES ($1, $2)",
-			host, game)
-		if txexecerr != nil {
-			logger.LogAppErrorf(
-				"AddServersToDB exec error for host %s and game %s: %s", host, game, err)
-			break
-		}
-	}
-	if txexecerr != nil {
+	err = addServers(tx, hostsgames, now)
+	if err != nil {
+		logger.LogAppErrorf("AddServersToDB exec error: %s", err)
 		if err = tx.Rollback(); err != nil {
 			logger.LogAppErrorf("AddServersToDB error rolling back tx: %s", err)
-			return
 		}
+		return
 	}
 	if err = tx.Commit(); err != nil {
 		logger.LogAppErrorf("AddServersToDB error committing tx: %s", err)
@@ -180,6 +166,27 @@ func (sdb *SDB) AddServersToDB(hostsgames map[string]string) {
 	}
 }
 
+func addServers(tx *sql.Tx, hostsgames map[string]string, now int64) error {
+	upsert, err := tx.Prepare(`INSERT INTO servers (host, game, first_seen,
+	last_seen) VALUES ($1, $2, $3, $3)
+	ON CONFLICT(host, game) WHERE retired = 0
+	DO UPDATE SET last_seen = excluded.last_seen`)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+	for host, game := range hostsgames {
+		// If direct queries are enabled, don't add 'Unspecified' game to server DB
+		if game == filters.GameUnspecified.String() {
+			continue
+		}
+		if _, err := upsert.Exec(host, game, now); err != nil {
+			return fmt.Errorf("host %s and game %s: %s", host, game, err)
+		}
+	}
+	return nil
+}
+
 // GetIDsForServerList retrieves the server ID numbers for a given set of hosts,
 // from the server database file, in response to a request to build the master
 // server detail list or the list of server details in response to a request
@@ -188,27 +195,35 @@ func (sdb *SDB) AddServersToDB(hostsgames map[string]string) {
 func (sdb *SDB) GetIDsForServerList(result chan map[string]int64,
 	hosts map[string]string) {
 	m := make(map[string]int64, len(hosts))
-	for host, game := range hosts {
-		rows, err := sdb.db.Query(
-			"SELECT server_id FROM servers WHERE host =? AND game =? LIMIT 1",
-			host, game)
+	args := make([]interface{}, 0, len(hosts))
+	for host := range hosts {
+		m[host] = 0
+		args = append(args, host)
+	}
+	err := forEachChunk(len(args), func(start, end int) error {
+		rows, err := sdb.db.Query(`SELECT server_id, host, game FROM servers
+		WHERE retired = 0 AND host IN (`+numberedPlaceholders(1, end-start)+`)`,
+			args[start:end]...)
 		if err != nil {
-			logger.LogAppErrorf(
-				"GetIDsForServerList: Error querying database to retrieve ID for host %s and game %s: %s",
-				host, game, err)
-			return
+			return err
 		}
 		defer rows.Close()
-		var id int64
 		for rows.Next() {
-			if err := rows.Scan(&id); err != nil {
-				logger.LogAppErrorf(
-					"GetIDsForServerList: Error querying database to retrieve ID for host %s: %s",
-					host, err)
-				return
+			var id int64
+			var host, game string
+			if err := rows.Scan(&id, &host, &game); err != nil {
+				return err
+			}
+			if hosts[host] == game {
+				m[host] = id
 			}
 		}
-		m[host] = id
+		return rows.Err()
+	})
+	if err != nil {
+		logger.LogAppErrorf(
+			"GetIDsForServerList: Error querying database to retrieve IDs: %s", err)
+		return
 	}
 	result <- m
 }
@@ -219,34 +234,48 @@ func (sdb *SDB) GetIDsForServerList(result chan map[string]int64,
 // channel for consumption.
 func (sdb *SDB) GetIDsAPIQuery(result chan *models.DbServerID, hosts []string) {
 	m := &models.DbServerID{}
-	for _, h := range hosts {
-		logger.WriteDebug("DB: GetIDsAPIQuery, host: %s", h)
+	err := forEachChunk(len(hosts), func(start, end int) error {
+		like := make([]string, 0, end-start)
+		args := make([]interface{}, 0, end-start)
+		for i, h := range hosts[start:end] {
+			logger.WriteDebug("DB: GetIDsAPIQuery, host: %s", h)
+			like = append(like, fmt.Sprintf("s.host LIKE $%d", i+1))
+			args = append(args, fmt.Sprintf("%%%s%%", h))
+		}
 		rows, err := sdb.db.Query(
-			"SELECT server_id, host, game FROM servers WHERE host LIKE ?",
-			fmt.Sprintf("%%%s%%", h))
+			`SELECT s.server_id, s.host, s.game, COALESCE(r.checks, 0),
+			COALESCE(r.responses, 0), COALESCE(r.response_ms, 0),
+			COALESCE(r.timed_responses, 0), COALESCE(r.consecutive_failures, 0),
+			COALESCE(r.first_seen, 0), COALESCE(r.last_seen, 0), s.first_seen,
+			s.last_seen FROM servers s
+			LEFT JOIN server_reliability r ON r.server_id = s.server_id
+			WHERE s.retired = 0 AND (`+strings.Join(like, " OR ")+`)
+			ORDER BY s.server_id`, args...)
 		if err != nil {
-			logger.LogAppErrorf(
-				"GetIDsAPIQuery: Error querying database to retrieve ID for host %s: %s",
-				h, err)
-			return
+			return err
 		}
 		defer rows.Close()
-		var id int64
-		host, game := "", ""
-
 		for rows.Next() {
 			sid := models.DbServer{}
-			if err := rows.Scan(&id, &host, &game); err != nil {
-				logger.LogAppErrorf(
-					"GetIDsAPIQuery: Error querying database to retrieve ID for host %s: %s",
-					h, err)
-				return
+			var responseMs float64
+			var timed int
+			rel := models.ServerReliability{}
+			if err := rows.Scan(&sid.ID, &sid.Host, &sid.Game, &rel.Checks,
+				&rel.Responses, &responseMs, &timed, &rel.ConsecutiveFailures,
+				&rel.FirstSeen, &rel.LastSeen, &sid.FirstSeen,
+				&sid.LastSeen); err != nil {
+				return err
 			}
-			sid.ID = id
-			sid.Host = host
-			sid.Game = game
+			sid.Reliability = computeReliability(rel, responseMs, timed)
 			m.Servers = append(m.Servers, sid)
 		}
+		return rows.Err()
+	})
+	if err != nil {
+		logger.LogAppErrorf(
+			"GetIDsAPIQuery: Error querying database to retrieve IDs for hosts: %s",
+			err)
+		return
 	}
 	m.ServerCount = len(m.Servers)
 	result <- m
@@ -259,16 +288,36 @@ func (sdb *SDB) GetIDsAPIQuery(result chan *models.DbServerID, hosts []string) {
 func (sdb *SDB) GetHostsAndGameFromIDAPIQuery(result chan map[string]string,
 	ids []string) {
 	hosts := make(map[string]string, len(ids))
+	args := make([]interface{}, 0, len(ids))
 	for _, id := range ids {
-		host, game, err := sdb.getHostAndGame(id)
+		// IDs that are not numbers cannot match any server
+		if sid, err := strconv.ParseInt(id, 10, 64); err == nil {
+			args = append(args, sid)
+		}
+	}
+	err := forEachChunk(len(args), func(start, end int) error {
+		rows, err := sdb.db.Query(
+			resolvedServerQuery+"("+numberedPlaceholders(1, end-start)+")", args[start:end]...)
 		if err != nil {
-			logger.LogAppErrorf("Error getting host from ID for API query: %s", err)
-			return
+			return err
 		}
-		if host == "" && game == "" {
-			continue
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var host, game string
+			if err := rows.Scan(&id, &host, &game); err != nil {
+				return err
+			}
+			if host == "" && game == "" {
+				continue
+			}
+			hosts[host] = game
 		}
-		hosts[host] = game
+		return rows.Err()
+	})
+	if err != nil {
+		logger.LogAppErrorf("Error getting host from ID for API query: %s", err)
+		return
 	}
 	result <- hosts
 }
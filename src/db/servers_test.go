@@ -1,6 +1,7 @@
 package db
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -102,3 +103,83 @@ func TestGetHostsAndGameFromIDAPIQuery(t *testing.T) {
 		t.Fatalf("Expected result QuakeLive, got: %v", result["1172.16.0.1"])
 	}
 }
+
+// --------------------------------------------------------------------
+
+// number of servers in a large master server list
+const benchServerCount = 4000
+
+func BenchmarkAddServersToDB(b *testing.B) {
+	benchmarkServers(b, func(db *SDB, hosts map[string]string) {
+		db.AddServersToDB(hosts)
+	})
+}
+
+func BenchmarkAddServersToDBPerHost(b *testing.B) {
+	benchmarkServers(b, addServersPerHost)
+}
+
+func BenchmarkGetIDsForServerList(b *testing.B) {
+	benchmarkServers(b, func(db *SDB, hosts map[string]string) {
+		c := make(chan map[string]int64, 1)
+		db.GetIDsForServerList(c, hosts)
+		<-c
+	})
+}
+
+func BenchmarkGetIDsForServerListPerHost(b *testing.B) {
+	benchmarkServers(b, getIDsPerHost)
+}
+
+// --------------------------------------------------------------------
+
+func benchmarkServers(b *testing.B, fn func(db *SDB, hosts map[string]string)) {
+	db, err := OpenServerDB()
+	if err != nil {
+		b.Fatalf("Unable to open test database: %s", err)
+	}
+	defer db.Close()
+	hosts := make(map[string]string, benchServerCount)
+	for i := 0; i < benchServerCount; i++ {
+		hosts[fmt.Sprintf("10.20.%d.%d:27960", i/250, i%250)] = "QuakeLive"
+	}
+	db.AddServersToDB(hosts)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn(db, hosts)
+	}
+}
+
+// addServersPerHost adds the servers with a query to check for and a statement
+// to add or update each server, for comparison.
+func addServersPerHost(db *SDB, hosts map[string]string) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return
+	}
+	for host, game := range hosts {
+		var n int
+		db.db.QueryRow(`SELECT COUNT(*) FROM servers WHERE host = ? AND game = ?
+		AND retired = 0`, host, game).Scan(&n)
+		if n == 0 {
+			tx.Exec(`INSERT INTO servers (host, game, first_seen, last_seen)
+			VALUES ($1, $2, $3, $3)`, host, game, 1)
+			continue
+		}
+		tx.Exec(`UPDATE servers SET last_seen = $1 WHERE host = $2 AND game = $3
+		AND retired = 0`, 1, host, game)
+	}
+	tx.Commit()
+}
+
+// getIDsPerHost retrieves the IDs of the servers with a query for each server,
+// for comparison.
+func getIDsPerHost(db *SDB, hosts map[string]string) {
+	m := make(map[string]int64, len(hosts))
+	for host, game := range hosts {
+		var id int64
+		db.db.QueryRow(`SELECT server_id FROM servers WHERE host = ? AND game = ?
+		AND retired = 0`, host, game).Scan(&id)
+		m[host] = id
+	}
+}
@@ -0,0 +1,89 @@
+package db
+
+// snapshots.go - persisted snapshots of the master server lists
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// maxSnapshotsPerGame is the number of snapshots that are kept for each game.
+const maxSnapshotsPerGame = 3
+
+func createSnapshotsTable(tx *sql.Tx) error {
+	create := `CREATE TABLE IF NOT EXISTS snapshots (
+	snapshot_id INTEGER NOT NULL,
+	game TEXT NOT NULL,
+	retrieved INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	PRIMARY KEY(snapshot_id)
+	)`
+	_, err := tx.Exec(create)
+	return err
+}
+
+// SaveSnapshot stores the completed master server list of the specified game and
+// removes all but the game's most recent snapshots.
+func (sdb *SDB) SaveSnapshot(game string, sl *models.APIServerList) error {
+	data, err := json.Marshal(sl)
+	if err != nil {
+		return logger.LogAppErrorf("SaveSnapshot: error marshaling %s list: %s",
+			game, err)
+	}
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return logger.LogAppErrorf("SaveSnapshot error creating tx: %s", err)
+	}
+	_, err = tx.Exec(
+		"INSERT INTO snapshots (game, retrieved, data) VALUES ($1, $2, $3)",
+		game, sl.RetrievedTimeStamp, data)
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM snapshots WHERE game = $1 AND snapshot_id NOT IN
+		(SELECT snapshot_id FROM snapshots WHERE game = $1
+		ORDER BY retrieved DESC, snapshot_id DESC LIMIT $2)`, game,
+			maxSnapshotsPerGame)
+	}
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			logger.LogAppErrorf("SaveSnapshot error rolling back tx: %s", rerr)
+		}
+		return logger.LogAppErrorf("SaveSnapshot exec error for game %s: %s",
+			game, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return logger.LogAppErrorf("SaveSnapshot error committing tx: %s", err)
+	}
+	return nil
+}
+
+// GetLatestSnapshot retrieves the most recent snapshot of the specified game's
+// master server list, along with the time at which the list was retrieved. A nil
+// list is returned if there is no snapshot that is newer than maxAge.
+func (sdb *SDB) GetLatestSnapshot(game string,
+	maxAge time.Duration) (*models.APIServerList, time.Time, error) {
+	var retrieved int64
+	var data []byte
+	err := sdb.db.QueryRow(`SELECT retrieved, data FROM snapshots WHERE game = $1
+	ORDER BY retrieved DESC, snapshot_id DESC LIMIT 1`, game).Scan(&retrieved, &data)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, time.Time{}, nil
+	case err != nil:
+		return nil, time.Time{}, logger.LogAppErrorf(
+			"GetLatestSnapshot: Error querying database for game %s: %s", game, err)
+	}
+	rt := time.Unix(retrieved, 0)
+	if time.Since(rt) > maxAge {
+		return nil, rt, nil
+	}
+	sl := &models.APIServerList{}
+	if err := json.Unmarshal(data, sl); err != nil {
+		return nil, rt, logger.LogAppErrorf(
+			"GetLatestSnapshot: Error decoding snapshot for game %s: %s", game, err)
+	}
+	return sl, rt, nil
+}
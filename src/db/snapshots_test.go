@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func TestSnapshots(t *testing.T) {
+	db, err := OpenServerDB()
+	if err != nil {
+		t.Fatalf("Unable to open test database: %s", err)
+	}
+	defer db.Close()
+
+	now := time.Now().Unix()
+	for i := 0; i < maxSnapshotsPerGame+2; i++ {
+		sl := models.GetDefaultServerList()
+		sl.RetrievedTimeStamp = now - int64(maxSnapshotsPerGame+2-i)
+		sl.Servers = append(sl.Servers, models.APIServer{Game: "Reflex",
+			Host: "10.0.0.10:25801"})
+		sl.ServerCount = i
+		if err := db.SaveSnapshot("Reflex", sl); err != nil {
+			t.Fatalf("Unexpected error when saving snapshot: %s", err)
+		}
+	}
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM snapshots WHERE game = ?",
+		"Reflex").Scan(&count); err != nil {
+		t.Fatalf("Unexpected error when counting snapshots: %s", err)
+	}
+	if count != maxSnapshotsPerGame {
+		t.Fatalf("Expected %d snapshots to be kept, got: %d", maxSnapshotsPerGame,
+			count)
+	}
+	sl, retrieved, err := db.GetLatestSnapshot("Reflex", time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error when loading snapshot: %s", err)
+	}
+	if sl == nil || sl.ServerCount != maxSnapshotsPerGame+1 {
+		t.Fatalf("Expected the newest snapshot, got: %v", sl)
+	}
+	if retrieved.Unix() != now-1 {
+		t.Fatalf("Expected retrieval time %d, got: %d", now-1, retrieved.Unix())
+	}
+	if len(sl.Servers) != 1 || sl.Servers[0].Host != "10.0.0.10:25801" {
+		t.Fatalf("Expected snapshot to contain the saved server, got: %v",
+			sl.Servers)
+	}
+	// too old
+	sl, _, err = db.GetLatestSnapshot("Reflex", 0)
+	if err != nil || sl != nil {
+		t.Fatalf("Expected no snapshot newer than max age, got: %v, %v", sl, err)
+	}
+	// no snapshots
+	sl, _, err = db.GetLatestSnapshot("QuakeLive", time.Hour)
+	if err != nil || sl != nil {
+		t.Fatalf("Expected no snapshot for QuakeLive, got: %v, %v", sl, err)
+	}
+}
@@ -0,0 +1,175 @@
+package db
+
+// stale.go - retirement and merging of the IDs of servers that are no longer
+// seen
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// serverPruneInterval is the time between the removals of stale servers.
+const serverPruneInterval = time.Hour
+
+// ErrServerNotFound is returned when a server to retire or merge is not an
+// active server in the database.
+var ErrServerNotFound = errors.New("no such active server")
+
+// addServerSeenColumns adds the columns for the times that servers were seen and
+// their retirement. Servers that were added before the times were recorded are
+// treated as being seen at the time of the migration.
+func addServerSeenColumns(tx *sql.Tx) error {
+	rows, err := tx.Query("PRAGMA table_info(servers)")
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		columns[name] = true
+	}
+	rows.Close()
+	for _, c := range []string{"first_seen", "last_seen", "retired",
+		"merged_into"} {
+		if columns[c] {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE servers ADD COLUMN " + c +
+			" INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+	if columns["last_seen"] {
+		return nil
+	}
+	_, err = tx.Exec("UPDATE servers SET first_seen = $1, last_seen = $1",
+		time.Now().Unix())
+	return err
+}
+
+// GetStaleServers retrieves the active servers that have not been seen since the
+// timestamp, least recently seen first.
+func (sdb *SDB) GetStaleServers(before int64) ([]models.DbServer, error) {
+	rows, err := sdb.db.Query(`SELECT server_id, host, game, first_seen, last_seen
+	FROM servers WHERE retired = 0 AND last_seen < $1
+	ORDER BY last_seen, server_id`, before)
+	if err != nil {
+		return nil, logger.LogAppErrorf(
+			"GetStaleServers: Error querying database: %s", err)
+	}
+	defer rows.Close()
+	servers := make([]models.DbServer, 0)
+	for rows.Next() {
+		s := models.DbServer{}
+		if err := rows.Scan(&s.ID, &s.Host, &s.Game, &s.FirstSeen,
+			&s.LastSeen); err != nil {
+			return nil, logger.LogAppErrorf(
+				"GetStaleServers: Error reading server: %s", err)
+		}
+		servers = append(servers, s)
+	}
+	return servers, rows.Err()
+}
+
+// RetireServers retires the active servers with the IDs, returning the number of
+// servers that were retired. Retired IDs are never re-used; if a retired server
+// is seen again, then it is given a new ID.
+func (sdb *SDB) RetireServers(ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := []interface{}{time.Now().Unix()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	res, err := sdb.db.Exec(`UPDATE servers SET retired = $1 WHERE retired = 0
+	AND server_id IN (`+numberedPlaceholders(2, len(ids))+`)`, args...)
+	if err != nil {
+		return 0, logger.LogAppErrorf("RetireServers exec error: %s", err)
+	}
+	return res.RowsAffected()
+}
+
+// MergeServer retires the server with the ID and resolves the ID (and any IDs
+// that were merged into it) to the server with the into ID from then on, i.e.
+// for a server that has moved to a new address. Both servers must be active.
+func (sdb *SDB) MergeServer(id, into int64) error {
+	if id == into {
+		return errors.New("a server cannot be merged into itself")
+	}
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return logger.LogAppErrorf("MergeServer error creating tx: %s", err)
+	}
+	err = mergeServer(tx, id, into, time.Now().Unix())
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			logger.LogAppErrorf("MergeServer error rolling back tx: %s", rerr)
+		}
+		if err == ErrServerNotFound {
+			return err
+		}
+		return logger.LogAppErrorf("MergeServer exec error: %s", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return logger.LogAppErrorf("MergeServer error committing tx: %s", err)
+	}
+	return nil
+}
+
+func mergeServer(tx *sql.Tx, id, into, now int64) error {
+	var active int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM servers WHERE retired = 0
+	AND server_id IN ($1, $2)`, id, into).Scan(&active); err != nil {
+		return err
+	}
+	if active != 2 {
+		return ErrServerNotFound
+	}
+	if _, err := tx.Exec(`UPDATE servers SET retired = $1, merged_into = $2
+	WHERE server_id = $3`, now, into, id); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE servers SET merged_into = $1 WHERE merged_into = $2",
+		into, id)
+	return err
+}
+
+// PruneServers retires the active servers that have not been seen since the
+// timestamp, returning the number of servers that were retired.
+func (sdb *SDB) PruneServers(before int64) (int64, error) {
+	res, err := sdb.db.Exec(`UPDATE servers SET retired = $1
+	WHERE retired = 0 AND last_seen < $2`, time.Now().Unix(), before)
+	if err != nil {
+		return 0, logger.LogAppErrorf("PruneServers exec error: %s", err)
+	}
+	return res.RowsAffected()
+}
+
+// StartServerPruning retires the servers that have not been seen for longer than
+// the retention period every hour, until the stop channel is closed.
+func StartServerPruning(stop chan bool, retention time.Duration) {
+	ticker := time.NewTicker(serverPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := ServerDB.PruneServers(time.Now().Add(-retention).Unix())
+			if err == nil && n > 0 {
+				logger.LogAppInfo("Retired %d server(s) not seen in %s", n, retention)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestStaleServers(t *testing.T) {
+	db, err := OpenServerDB()
+	if err != nil {
+		t.Fatalf("Unable to open test database: %s", err)
+	}
+	defer db.Close()
+	// keeps the IDs that the server tests expect for their hosts
+	db.AddServersToDB(testData)
+	old, moved, active := "10.9.2.1:27960", "10.9.2.2:27960", "10.9.2.3:27960"
+	hosts := map[string]string{old: "QuakeLive", moved: "QuakeLive",
+		active: "QuakeLive"}
+	db.AddServersToDB(hosts)
+	c := make(chan map[string]int64, 1)
+	db.GetIDsForServerList(c, hosts)
+	ids := <-c
+	if len(ids) != 3 {
+		t.Fatalf("Expected IDs for the test servers, got: %v", ids)
+	}
+	if _, err := db.db.Exec("UPDATE servers SET last_seen = 1000 WHERE host IN ($1, $2)",
+		old, moved); err != nil {
+		t.Fatalf("Unable to age test servers: %s", err)
+	}
+
+	stale, err := db.GetStaleServers(2000)
+	if err != nil {
+		t.Fatalf("Unexpected error getting stale servers: %s", err)
+	}
+	if len(stale) != 2 || stale[0].ID+stale[1].ID != ids[old]+ids[moved] {
+		t.Fatalf("Expected the two aged servers to be stale, got: %+v", stale)
+	}
+	// seeing a server again makes it current
+	db.AddServersToDB(map[string]string{moved: "QuakeLive"})
+	if stale, _ = db.GetStaleServers(2000); len(stale) != 1 ||
+		stale[0].ID != ids[old] {
+		t.Fatalf("Expected a seen server to no longer be stale, got: %+v", stale)
+	}
+
+	if err := db.MergeServer(ids[moved], ids[active]); err != nil {
+		t.Fatalf("Unexpected error merging servers: %s", err)
+	}
+	host, _, err := db.getHostAndGame(strconv.FormatInt(ids[moved], 10))
+	if err != nil || host != active {
+		t.Fatalf("Expected a merged ID to resolve to %s, got: %s (%v)", active,
+			host, err)
+	}
+	if err := db.MergeServer(ids[moved], ids[active]); err != ErrServerNotFound {
+		t.Fatalf("Expected merging a retired server to fail, got: %v", err)
+	}
+
+	n, err := db.PruneServers(2000)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 server to be pruned, got: %d (%v)", n, err)
+	}
+	if host, _, _ = db.getHostAndGame(strconv.FormatInt(ids[old],
+		10)); host != "" {
+		t.Fatalf("Expected a retired ID to have no host, got: %s", host)
+	}
+	if n, _ = db.RetireServers([]int64{ids[old], ids[active]}); n != 1 {
+		t.Fatalf("Expected only the active server to be retired, got: %d", n)
+	}
+
+	// retired hosts that are seen again get new IDs, which are never re-used
+	db.AddServersToDB(map[string]string{active: "QuakeLive"})
+	db.GetIDsForServerList(c, map[string]string{active: "QuakeLive"})
+	readded := <-c
+	if readded[active] <= ids[active] {
+		t.Fatalf("Expected a new ID for a retired server, got: %d (was %d)",
+			readded[active], ids[active])
+	}
+}
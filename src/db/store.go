@@ -0,0 +1,119 @@
+package db
+
+// store.go - storage of the server IDs and the data that is kept with them
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// ServerStore is the storage of the server IDs, along with the master list
+// snapshots, webhook rules and server reliability that are kept with them. The
+// server IDs of a store that is shared by several a2sapi instances are the same
+// across the instances.
+type ServerStore interface {
+	Close()
+	// Size returns the storage used by the store's database, in bytes.
+	Size() (int64, error)
+	// Ping verifies that the store's database can still be reached.
+	Ping() error
+
+	// server IDs
+	AddServersToDB(hostsgames map[string]string)
+	GetIDsForServerList(result chan map[string]int64, hosts map[string]string)
+	GetIDsAPIQuery(result chan *models.DbServerID, hosts []string)
+	GetHostsAndGameFromIDAPIQuery(result chan map[string]string, ids []string)
+
+	// stale server IDs
+	GetStaleServers(before int64) ([]models.DbServer, error)
+	RetireServers(ids []int64) (int64, error)
+	MergeServer(id, into int64) error
+	PruneServers(before int64) (int64, error)
+
+	// master list snapshots
+	SaveSnapshot(game string, sl *models.APIServerList) error
+	GetLatestSnapshot(game string, maxAge time.Duration) (*models.APIServerList,
+		time.Time, error)
+
+	// webhooks
+	AddWebhook(rule models.WebhookRule) (int64, error)
+	UpdateWebhook(rule models.WebhookRule) (bool, error)
+	DeleteWebhook(id int64) (bool, error)
+	GetWebhooks(enabledOnly bool) ([]models.WebhookRule, error)
+	AddDeadLetter(dl models.WebhookDeadLetter) error
+	GetDeadLetters(limit int) ([]models.WebhookDeadLetter, error)
+
+	// server reliability
+	RecordResponses(game string, timestamp int64, responded map[int64]float64,
+		failed []string) error
+	GetReliability(ids []int64) (map[int64]models.ServerReliability, error)
+}
+
+// dialect is what differs between the database systems that the server store can
+// be kept in. The queries of the server store are otherwise written to be
+// understood by all of them, with numbered ($1) parameters.
+type dialect struct {
+	name       string
+	migrations []migration
+	// query for the number of tables with the name in the $1 parameter
+	countTables string
+	// statement that serializes the application of migrations by several
+	// a2sapi instances, if the database can be shared
+	lockMigrations string
+	// query for the size of the database in bytes
+	size string
+}
+
+var sqliteDialect = &dialect{
+	name:        "SQLite",
+	migrations:  sqliteMigrations,
+	countTables: "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1",
+	size: `SELECT page_count * page_size FROM pragma_page_count(),
+	pragma_page_size()`,
+}
+
+// sqliteOptions are the connection options of the SQLite databases. The timed
+// retrievals of several games write to the server database at once, so writers
+// wait for each other rather than failing with "database is locked", and the
+// write-ahead log keeps them from blocking the API's reads.
+const sqliteOptions = "?_busy_timeout=5000&_journal_mode=WAL"
+
+// openSQLite opens the SQLite database file with the connection options.
+func openSQLite(dbfile string) (*sql.DB, error) {
+	return sql.Open("sqlite3", dbfile+sqliteOptions)
+}
+
+// OpenServerStore opens the server store that is selected in the configuration.
+func OpenServerStore() (ServerStore, error) {
+	var sdb *SDB
+	var err error
+	switch cfg := config.Config.DBConfig; cfg.ServerStore {
+	case "", config.ServerStoreSQLite:
+		sdb, err = OpenServerDB()
+	case config.ServerStorePostgres:
+		sdb, err = OpenPostgresServerDB(cfg.PostgresURL)
+	default:
+		return nil, fmt.Errorf("Unknown server store: %s", cfg.ServerStore)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdb, nil
+}
+
+// numberedPlaceholders returns n numbered parameters for a query, starting with
+// the first.
+func numberedPlaceholders(first, n int) string {
+	s := ""
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			s += ","
+		}
+		s += fmt.Sprintf("$%d", first+i)
+	}
+	return s
+}
@@ -0,0 +1,387 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// postgresTestURLEnv is the environment variable with the URL of a PostgreSQL
+// database to run the server store tests against. Its tables are dropped.
+const postgresTestURLEnv = "A2SAPI_TEST_POSTGRES_URL"
+
+func TestMemStore(t *testing.T) {
+	testServerStore(t, func(t *testing.T) ServerStore {
+		return newMemStore()
+	})
+}
+
+func TestSQLiteServerStore(t *testing.T) {
+	testServerStore(t, func(t *testing.T) ServerStore {
+		dbfile := filepath.Join(t.TempDir(), "servers.sqlite")
+		if _, err := migrateServerDB(dbfile); err != nil {
+			t.Fatalf("Unable to create test database: %s", err)
+		}
+		conn, err := openSQLite(dbfile)
+		if err != nil {
+			t.Fatalf("Unable to open test database: %s", err)
+		}
+		return &SDB{db: conn, dialect: sqliteDialect}
+	})
+}
+
+func TestOpenSQLite(t *testing.T) {
+	conn, err := openSQLite(filepath.Join(t.TempDir(), "servers.sqlite"))
+	if err != nil {
+		t.Fatalf("Unable to open test database: %s", err)
+	}
+	defer conn.Close()
+	var timeout int
+	var mode string
+	if err := conn.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatalf("Unable to get busy timeout: %s", err)
+	}
+	if err := conn.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("Unable to get journal mode: %s", err)
+	}
+	if timeout != 5000 || mode != "wal" {
+		t.Fatalf("Expected busy timeout of 5000 in WAL mode, got: %d %s", timeout,
+			mode)
+	}
+}
+
+func TestPostgresServerStore(t *testing.T) {
+	url := os.Getenv(postgresTestURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", postgresTestURLEnv)
+	}
+	testServerStore(t, func(t *testing.T) ServerStore {
+		conn, err := openPostgres(url)
+		if err != nil {
+			t.Fatalf("Unable to connect to test database: %s", err)
+		}
+		_, err = conn.Exec(`DROP TABLE IF EXISTS schema_version, servers,
+		snapshots, webhooks, webhook_deadletters, server_reliability`)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("Unable to reset test database: %s", err)
+		}
+		sdb, err := OpenPostgresServerDB(url)
+		if err != nil {
+			t.Fatalf("Unable to open test database: %s", err)
+		}
+		return sdb
+	})
+}
+
+// testServerStore runs the tests that every server store must pass, each against
+// an empty store from open.
+func testServerStore(t *testing.T, open func(t *testing.T) ServerStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s ServerStore)
+	}{
+		{"ServerIDs", testStoreServerIDs},
+		{"StaleServers", testStoreStaleServers},
+		{"Snapshots", testStoreSnapshots},
+		{"Webhooks", testStoreWebhooks},
+		{"Reliability", testStoreReliability},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			tt.fn(t, s)
+		})
+	}
+}
+
+func storeIDs(s ServerStore, hosts map[string]string) map[string]int64 {
+	c := make(chan map[string]int64, 1)
+	s.GetIDsForServerList(c, hosts)
+	return <-c
+}
+
+func storeHosts(s ServerStore, ids ...int64) map[string]string {
+	c := make(chan map[string]string, 1)
+	sids := make([]string, 0, len(ids))
+	for _, id := range ids {
+		sids = append(sids, strconv.FormatInt(id, 10))
+	}
+	s.GetHostsAndGameFromIDAPIQuery(c, sids)
+	return <-c
+}
+
+func storeQuery(s ServerStore, hosts ...string) *models.DbServerID {
+	c := make(chan *models.DbServerID, 1)
+	s.GetIDsAPIQuery(c, hosts)
+	return <-c
+}
+
+func testStoreServerIDs(t *testing.T, s ServerStore) {
+	hosts := map[string]string{"10.9.3.1:27960": "QuakeLive",
+		"10.9.3.2:25797": "Reflex", "10.9.3.3:27015": "QuakeLive"}
+	s.AddServersToDB(hosts)
+	s.AddServersToDB(map[string]string{"10.9.3.4:27015": "Unspecified"})
+	ids := storeIDs(s, hosts)
+	seen := make(map[int64]bool)
+	if size, err := s.Size(); err != nil || size < 0 {
+		t.Fatalf("Unexpected size of the store: %d (%v)", size, err)
+	}
+	if err := s.Ping(); err != nil {
+		t.Fatalf("Unexpected error pinging the store: %s", err)
+	}
+	for host, id := range ids {
+		if id == 0 || seen[id] {
+			t.Fatalf("Expected a unique ID for %s, got: %v", host, ids)
+		}
+		seen[id] = true
+	}
+	// servers that are seen again keep their IDs
+	s.AddServersToDB(hosts)
+	if again := storeIDs(s, hosts); !reflect.DeepEqual(again, ids) {
+		t.Fatalf("Expected the IDs to be kept, got: %v (was %v)", again, ids)
+	}
+	unknown := storeIDs(s, map[string]string{"10.9.3.1:27960": "Reflex",
+		"10.9.3.4:27015": "Unspecified"})
+	if unknown["10.9.3.1:27960"] != 0 || unknown["10.9.3.4:27015"] != 0 {
+		t.Fatalf("Expected no IDs for unknown servers, got: %v", unknown)
+	}
+
+	m := storeQuery(s, "10.9.3.", "nomatch")
+	if m.ServerCount != 3 || len(m.Servers) != 3 {
+		t.Fatalf("Expected 3 servers to match, got: %+v", m)
+	}
+	for i, srv := range m.Servers {
+		if srv.ID != ids[srv.Host] || srv.Game != hosts[srv.Host] ||
+			srv.FirstSeen == 0 || srv.LastSeen < srv.FirstSeen {
+			t.Fatalf("Unexpected server: %+v", srv)
+		}
+		if i > 0 && srv.ID <= m.Servers[i-1].ID {
+			t.Fatalf("Expected servers to be ordered by ID, got: %+v", m.Servers)
+		}
+	}
+	if m = storeQuery(s, "10.9.3.2"); m.ServerCount != 1 ||
+		m.Servers[0].Host != "10.9.3.2:25797" {
+		t.Fatalf("Expected 1 server to match, got: %+v", m)
+	}
+
+	c := make(chan map[string]string, 1)
+	s.GetHostsAndGameFromIDAPIQuery(c, []string{
+		strconv.FormatInt(ids["10.9.3.1:27960"], 10),
+		strconv.FormatInt(ids["10.9.3.2:25797"], 10), "999999", "abc"})
+	expected := map[string]string{"10.9.3.1:27960": "QuakeLive",
+		"10.9.3.2:25797": "Reflex"}
+	if got := <-c; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected hosts %v, got: %v", expected, got)
+	}
+}
+
+func testStoreStaleServers(t *testing.T, s ServerStore) {
+	old, moved, active := "10.9.4.1:27960", "10.9.4.2:27960", "10.9.4.3:27960"
+	hosts := map[string]string{old: "QuakeLive", moved: "QuakeLive",
+		active: "QuakeLive"}
+	s.AddServersToDB(hosts)
+	ids := storeIDs(s, hosts)
+	if stale, err := s.GetStaleServers(time.Now().Unix() - 60); err != nil ||
+		len(stale) != 0 {
+		t.Fatalf("Expected no stale servers, got: %+v (%v)", stale, err)
+	}
+	stale, err := s.GetStaleServers(time.Now().Unix() + 60)
+	if err != nil || len(stale) != 3 {
+		t.Fatalf("Expected 3 stale servers, got: %+v (%v)", stale, err)
+	}
+
+	if err := s.MergeServer(ids[moved], ids[moved]); err == nil {
+		t.Fatalf("Expected merging a server into itself to fail")
+	}
+	if err := s.MergeServer(ids[old], ids[moved]); err != nil {
+		t.Fatalf("Unexpected error merging servers: %s", err)
+	}
+	// servers that were merged into a merged server follow it
+	if err := s.MergeServer(ids[moved], ids[active]); err != nil {
+		t.Fatalf("Unexpected error merging servers: %s", err)
+	}
+	expected := map[string]string{active: "QuakeLive"}
+	if got := storeHosts(s, ids[old], ids[moved]); !reflect.DeepEqual(got,
+		expected) {
+		t.Fatalf("Expected merged IDs to resolve to %v, got: %v", expected, got)
+	}
+	if err := s.MergeServer(ids[moved], ids[active]); err != ErrServerNotFound {
+		t.Fatalf("Expected merging a retired server to fail, got: %v", err)
+	}
+	if err := s.MergeServer(ids[active], 999999); err != ErrServerNotFound {
+		t.Fatalf("Expected merging into an unknown server to fail, got: %v", err)
+	}
+
+	n, err := s.RetireServers([]int64{ids[old], ids[active], 999999})
+	if err != nil || n != 1 {
+		t.Fatalf("Expected only the active server to be retired, got: %d (%v)", n,
+			err)
+	}
+	if got := storeHosts(s, ids[old], ids[active]); len(got) != 0 {
+		t.Fatalf("Expected retired IDs to have no hosts, got: %v", got)
+	}
+	if m := storeQuery(s, "10.9.4."); m.ServerCount != 0 {
+		t.Fatalf("Expected retired servers to be left out, got: %+v", m)
+	}
+	// retired hosts that are seen again get new IDs, which are never re-used
+	s.AddServersToDB(hosts)
+	readded := storeIDs(s, hosts)
+	for host, id := range readded {
+		if id <= ids[active] || id <= ids[old] || id <= ids[moved] {
+			t.Fatalf("Expected a new ID for %s, got: %v (was %v)", host, readded,
+				ids)
+		}
+	}
+	if n, err = s.PruneServers(time.Now().Unix() + 60); err != nil || n != 3 {
+		t.Fatalf("Expected 3 servers to be pruned, got: %d (%v)", n, err)
+	}
+	if stale, _ = s.GetStaleServers(time.Now().Unix() + 60); len(stale) != 0 {
+		t.Fatalf("Expected pruned servers to no longer be stale, got: %+v", stale)
+	}
+}
+
+func testStoreSnapshots(t *testing.T, s ServerStore) {
+	if sl, _, err := s.GetLatestSnapshot("QuakeLive", time.Hour); sl != nil ||
+		err != nil {
+		t.Fatalf("Expected no snapshot, got: %+v (%v)", sl, err)
+	}
+	now := time.Now().Unix()
+	for i := int64(maxSnapshotsPerGame); i >= 0; i-- {
+		sl := &models.APIServerList{RetrievedTimeStamp: now - i,
+			ServerCount: int(i)}
+		if err := s.SaveSnapshot("QuakeLive", sl); err != nil {
+			t.Fatalf("Unexpected error saving snapshot: %s", err)
+		}
+	}
+	if err := s.SaveSnapshot("Reflex", &models.APIServerList{
+		RetrievedTimeStamp: now - 7200, ServerCount: 5}); err != nil {
+		t.Fatalf("Unexpected error saving snapshot: %s", err)
+	}
+	sl, rt, err := s.GetLatestSnapshot("QuakeLive", time.Hour)
+	if err != nil || sl == nil || sl.ServerCount != 0 || rt.Unix() != now {
+		t.Fatalf("Expected the newest snapshot, got: %+v at %s (%v)", sl, rt, err)
+	}
+	sl, rt, err = s.GetLatestSnapshot("Reflex", time.Hour)
+	if err != nil || sl != nil || rt.Unix() != now-7200 {
+		t.Fatalf("Expected an expired snapshot, got: %+v at %s (%v)", sl, rt, err)
+	}
+	if sl, _, _ = s.GetLatestSnapshot("Reflex", 3*time.Hour); sl == nil ||
+		sl.ServerCount != 5 {
+		t.Fatalf("Expected the other game's snapshot to be kept, got: %+v", sl)
+	}
+}
+
+func testStoreWebhooks(t *testing.T, s ServerStore) {
+	rule := models.WebhookRule{Name: "busy", URL: "http://10.0.0.1/hook",
+		Secret: "s3cret", ServerIDs: []int64{42, 43}, MinPlayers: 6,
+		Filter: "games=QuakeLive", Enabled: true, CreatedAt: 1000}
+	id, err := s.AddWebhook(rule)
+	if err != nil {
+		t.Fatalf("Unexpected error adding webhook: %s", err)
+	}
+	rule.ID = id
+	disabled := models.WebhookRule{URL: "http://10.0.0.2/hook", Secret: "x",
+		ServerIDs: []int64{}, CreatedAt: 2000}
+	if disabled.ID, err = s.AddWebhook(disabled); err != nil ||
+		disabled.ID <= rule.ID {
+		t.Fatalf("Expected a new ID for the webhook, got: %d (%v)", disabled.ID,
+			err)
+	}
+	rules, err := s.GetWebhooks(true)
+	if err != nil || !reflect.DeepEqual(rules, []models.WebhookRule{rule}) {
+		t.Fatalf("Expected only the enabled rule, got: %+v (%v)", rules, err)
+	}
+	rules, _ = s.GetWebhooks(false)
+	if !reflect.DeepEqual(rules, []models.WebhookRule{rule, disabled}) {
+		t.Fatalf("Expected both rules, got: %+v", rules)
+	}
+
+	rule.MinPlayers, rule.Enabled, rule.CreatedAt = 8, false, 3000
+	if ok, err := s.UpdateWebhook(rule); !ok || err != nil {
+		t.Fatalf("Expected the rule to be updated, got: %v (%v)", ok, err)
+	}
+	rule.CreatedAt = 1000
+	if rules, _ = s.GetWebhooks(false); !reflect.DeepEqual(rules[0], rule) {
+		t.Fatalf("Expected the updated rule, got: %+v", rules[0])
+	}
+	if rules, _ = s.GetWebhooks(true); len(rules) != 0 {
+		t.Fatalf("Expected no enabled rules, got: %+v", rules)
+	}
+	if ok, _ := s.UpdateWebhook(models.WebhookRule{ID: 999999}); ok {
+		t.Fatalf("Expected an unknown rule to not be updated")
+	}
+	if ok, err := s.DeleteWebhook(rule.ID); !ok || err != nil {
+		t.Fatalf("Expected the rule to be deleted, got: %v (%v)", ok, err)
+	}
+	if ok, _ := s.DeleteWebhook(rule.ID); ok {
+		t.Fatalf("Expected a deleted rule to not be deleted again")
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := s.AddDeadLetter(models.WebhookDeadLetter{RuleID: disabled.ID,
+			URL: disabled.URL, Payload: "{}", Error: "timeout", Attempts: i,
+			FailedAt: int64(i)}); err != nil {
+			t.Fatalf("Unexpected error adding failed delivery: %s", err)
+		}
+	}
+	dls, err := s.GetDeadLetters(2)
+	if err != nil || len(dls) != 2 || dls[0].Attempts != 3 ||
+		dls[1].Attempts != 2 || dls[0].ID <= dls[1].ID ||
+		dls[0].RuleID != disabled.ID || dls[0].Error != "timeout" {
+		t.Fatalf("Expected the newest failed deliveries first, got: %+v (%v)", dls,
+			err)
+	}
+}
+
+func testStoreReliability(t *testing.T, s ServerStore) {
+	up, down := "10.9.5.1:27960", "10.9.5.2:27960"
+	hosts := map[string]string{up: "QuakeLive", down: "QuakeLive"}
+	s.AddServersToDB(hosts)
+	ids := storeIDs(s, hosts)
+	for i, ping := range []float64{20, 0, 40} {
+		err := s.RecordResponses("QuakeLive", int64(1000+i),
+			map[int64]float64{ids[up]: ping}, []string{down, "10.9.5.3:27960"})
+		if err != nil {
+			t.Fatalf("Unexpected error recording responses: %s", err)
+		}
+	}
+	// a host is only a failure of the game that it was added with
+	if err := s.RecordResponses("Reflex", 1003, nil, []string{up}); err != nil {
+		t.Fatalf("Unexpected error recording responses: %s", err)
+	}
+	rel, err := s.GetReliability([]int64{ids[up], ids[down], 999999})
+	if err != nil || len(rel) != 2 {
+		t.Fatalf("Expected the reliability of 2 servers, got: %+v (%v)", rel, err)
+	}
+	expected := models.ServerReliability{Checks: 3, Responses: 3,
+		Availability: 100, AvgResponseMs: 30, FirstSeen: 1000, LastSeen: 1002}
+	if rel[ids[up]] != expected {
+		t.Fatalf("Expected %+v, got: %+v", expected, rel[ids[up]])
+	}
+	expected = models.ServerReliability{Checks: 3, ConsecutiveFailures: 3}
+	if rel[ids[down]] != expected {
+		t.Fatalf("Expected %+v, got: %+v", expected, rel[ids[down]])
+	}
+	// responding resets the failures and sets the first response
+	if err := s.RecordResponses("QuakeLive", 1010,
+		map[int64]float64{ids[down]: 0}, nil); err != nil {
+		t.Fatalf("Unexpected error recording responses: %s", err)
+	}
+	rel, _ = s.GetReliability([]int64{ids[down]})
+	expected = models.ServerReliability{Checks: 4, Responses: 1,
+		Availability: 25, FirstSeen: 1010, LastSeen: 1010}
+	if rel[ids[down]] != expected {
+		t.Fatalf("Expected %+v, got: %+v", expected, rel[ids[down]])
+	}
+	if m := storeQuery(s, down); m.ServerCount != 1 ||
+		m.Servers[0].Reliability != expected {
+		t.Fatalf("Expected the server's reliability, got: %+v", m)
+	}
+}
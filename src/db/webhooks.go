@@ -0,0 +1,184 @@
+package db
+
+// webhooks.go - webhook rules and failed webhook deliveries
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// maxDeadLetters is the number of failed webhook deliveries that are kept.
+const maxDeadLetters = 1000
+
+func createWebhooksTables(tx *sql.Tx) error {
+	create := []string{`CREATE TABLE IF NOT EXISTS webhooks (
+	webhook_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	server_ids TEXT NOT NULL,
+	min_players INTEGER NOT NULL,
+	filter TEXT NOT NULL,
+	enabled INTEGER NOT NULL,
+	created INTEGER NOT NULL,
+	PRIMARY KEY(webhook_id)
+	)`, `CREATE TABLE IF NOT EXISTS webhook_deadletters (
+	deadletter_id INTEGER NOT NULL,
+	webhook_id INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	failed INTEGER NOT NULL,
+	PRIMARY KEY(deadletter_id)
+	)`}
+	for _, c := range create {
+		if _, err := tx.Exec(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ",")
+}
+
+func splitIDs(s string) []int64 {
+	ids := make([]int64, 0)
+	for _, v := range strings.Split(s, ",") {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// AddWebhook inserts the webhook rule into the server database and returns its
+// new ID.
+func (sdb *SDB) AddWebhook(rule models.WebhookRule) (int64, error) {
+	var id int64
+	err := sdb.db.QueryRow(`INSERT INTO webhooks (name, url, secret, server_ids,
+	min_players, filter, enabled, created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING webhook_id`, rule.Name, rule.URL, rule.Secret,
+		joinIDs(rule.ServerIDs), rule.MinPlayers, rule.Filter, rule.Enabled,
+		rule.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, logger.LogAppErrorf("AddWebhook exec error: %s", err)
+	}
+	return id, nil
+}
+
+// UpdateWebhook replaces the webhook rule with the same ID. Returns false if
+// there is no such rule.
+func (sdb *SDB) UpdateWebhook(rule models.WebhookRule) (bool, error) {
+	res, err := sdb.db.Exec(`UPDATE webhooks SET name = $1, url = $2, secret = $3,
+	server_ids = $4, min_players = $5, filter = $6, enabled = $7
+	WHERE webhook_id = $8`, rule.Name, rule.URL, rule.Secret,
+		joinIDs(rule.ServerIDs), rule.MinPlayers, rule.Filter, rule.Enabled, rule.ID)
+	if err != nil {
+		return false, logger.LogAppErrorf("UpdateWebhook exec error for id %d: %s",
+			rule.ID, err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteWebhook removes the webhook rule. Returns false if there is no such rule.
+func (sdb *SDB) DeleteWebhook(id int64) (bool, error) {
+	res, err := sdb.db.Exec("DELETE FROM webhooks WHERE webhook_id = $1", id)
+	if err != nil {
+		return false, logger.LogAppErrorf("DeleteWebhook exec error for id %d: %s",
+			id, err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetWebhooks retrieves all of the webhook rules, or only the enabled ones.
+func (sdb *SDB) GetWebhooks(enabledOnly bool) ([]models.WebhookRule, error) {
+	query := `SELECT webhook_id, name, url, secret, server_ids, min_players, filter,
+	enabled, created FROM webhooks`
+	args := []interface{}{}
+	if enabledOnly {
+		query += " WHERE enabled = $1"
+		args = append(args, true)
+	}
+	rows, err := sdb.db.Query(query+" ORDER BY webhook_id", args...)
+	if err != nil {
+		return nil, logger.LogAppErrorf("GetWebhooks: Error querying database: %s",
+			err)
+	}
+	defer rows.Close()
+	rules := make([]models.WebhookRule, 0)
+	for rows.Next() {
+		r := models.WebhookRule{}
+		var ids string
+		if err := rows.Scan(&r.ID, &r.Name, &r.URL, &r.Secret, &ids, &r.MinPlayers,
+			&r.Filter, &r.Enabled, &r.CreatedAt); err != nil {
+			return nil, logger.LogAppErrorf("GetWebhooks: Error reading rule: %s", err)
+		}
+		r.ServerIDs = splitIDs(ids)
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// AddDeadLetter records a failed webhook delivery and removes all but the most
+// recent failed deliveries.
+func (sdb *SDB) AddDeadLetter(dl models.WebhookDeadLetter) error {
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return logger.LogAppErrorf("AddDeadLetter error creating tx: %s", err)
+	}
+	_, err = tx.Exec(`INSERT INTO webhook_deadletters (webhook_id, url, payload,
+	error, attempts, failed) VALUES ($1, $2, $3, $4, $5, $6)`, dl.RuleID, dl.URL,
+		dl.Payload, dl.Error, dl.Attempts, dl.FailedAt)
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM webhook_deadletters WHERE deadletter_id NOT IN
+		(SELECT deadletter_id FROM webhook_deadletters
+		ORDER BY deadletter_id DESC LIMIT $1)`, maxDeadLetters)
+	}
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			logger.LogAppErrorf("AddDeadLetter error rolling back tx: %s", rerr)
+		}
+		return logger.LogAppErrorf("AddDeadLetter exec error: %s", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return logger.LogAppErrorf("AddDeadLetter error committing tx: %s", err)
+	}
+	return nil
+}
+
+// GetDeadLetters retrieves the most recent failed webhook deliveries, newest
+// first.
+func (sdb *SDB) GetDeadLetters(limit int) ([]models.WebhookDeadLetter, error) {
+	rows, err := sdb.db.Query(`SELECT deadletter_id, webhook_id, url, payload,
+	error, attempts, failed FROM webhook_deadletters
+	ORDER BY deadletter_id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, logger.LogAppErrorf("GetDeadLetters: Error querying database: %s",
+			err)
+	}
+	defer rows.Close()
+	dls := make([]models.WebhookDeadLetter, 0)
+	for rows.Next() {
+		dl := models.WebhookDeadLetter{}
+		if err := rows.Scan(&dl.ID, &dl.RuleID, &dl.URL, &dl.Payload, &dl.Error,
+			&dl.Attempts, &dl.FailedAt); err != nil {
+			return nil, logger.LogAppErrorf(
+				"GetDeadLetters: Error reading failed delivery: %s", err)
+		}
+		dls = append(dls, dl)
+	}
+	return dls, rows.Err()
+}
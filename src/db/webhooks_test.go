@@ -0,0 +1,67 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func TestWebhooks(t *testing.T) {
+	db, err := OpenServerDB()
+	if err != nil {
+		t.Fatalf("Unable to open test database: %s", err)
+	}
+	defer db.Close()
+
+	rule := models.WebhookRule{Name: "busy", URL: "http://10.0.0.1/hook",
+		Secret: "s3cret", ServerIDs: []int64{42, 43}, MinPlayers: 6,
+		Filter: "games=QuakeLive", Enabled: true, CreatedAt: 1000}
+	id, err := db.AddWebhook(rule)
+	if err != nil {
+		t.Fatalf("Unexpected error when adding webhook: %s", err)
+	}
+	rule.ID = id
+	disabled := models.WebhookRule{URL: "http://10.0.0.2/hook", Secret: "x"}
+	if disabled.ID, err = db.AddWebhook(disabled); err != nil {
+		t.Fatalf("Unexpected error when adding webhook: %s", err)
+	}
+	rules, err := db.GetWebhooks(true)
+	if err != nil {
+		t.Fatalf("Unexpected error when getting webhooks: %s", err)
+	}
+	if len(rules) != 1 || !reflect.DeepEqual(rules[0], rule) {
+		t.Fatalf("Expected only the enabled rule %+v, got: %+v", rule, rules)
+	}
+
+	rule.ServerIDs = nil
+	rule.MinPlayers = 2
+	if ok, err := db.UpdateWebhook(rule); !ok || err != nil {
+		t.Fatalf("Expected webhook to be updated, got: %v, %v", ok, err)
+	}
+	rules, _ = db.GetWebhooks(false)
+	if len(rules) != 2 || rules[0].MinPlayers != 2 || len(rules[0].ServerIDs) != 0 {
+		t.Fatalf("Expected updated rule and disabled rule, got: %+v", rules)
+	}
+	if ok, err := db.DeleteWebhook(disabled.ID); !ok || err != nil {
+		t.Fatalf("Expected webhook to be deleted, got: %v, %v", ok, err)
+	}
+	if ok, _ := db.DeleteWebhook(disabled.ID); ok {
+		t.Fatalf("Expected deleting a missing webhook to report false")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := db.AddDeadLetter(models.WebhookDeadLetter{RuleID: rule.ID,
+			URL: rule.URL, Payload: "{}", Error: "503", Attempts: i + 1,
+			FailedAt: 2000}); err != nil {
+			t.Fatalf("Unexpected error when adding dead letter: %s", err)
+		}
+	}
+	dls, err := db.GetDeadLetters(2)
+	if err != nil {
+		t.Fatalf("Unexpected error when getting dead letters: %s", err)
+	}
+	if len(dls) != 2 || dls[0].Attempts != 3 || dls[1].Attempts != 2 {
+		t.Fatalf("Expected the 2 most recent dead letters, got: %+v", dls)
+	}
+}
@@ -0,0 +1,98 @@
+package events
+
+// broker.go - delivery of events to the subscribed streams
+
+import "sync"
+
+// Broker delivers published events to each of its subscribers.
+type Broker struct {
+	mutex sync.Mutex
+	subs  map[*Subscription]struct{}
+}
+
+// Subscription represents a subscriber's stream of events, which receives the
+// events of each publication as one batch. C is closed when the subscription
+// ends, either because it was unsubscribed or because the subscriber fell too far
+// behind; in the latter case, Dropped returns true.
+type Subscription struct {
+	C       <-chan []Event
+	c       chan []Event
+	filter  func(Event) bool
+	dropped bool
+}
+
+// Stream is the broker of the events of the timed master server retrievals.
+var Stream = NewBroker()
+
+// NewBroker creates a broker without any subscribers.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe creates a subscription that buffers the events of up to buffer
+// publications, regardless of how many events each of them has. If filter is not
+// nil, then only the events for which it returns true are delivered.
+func (b *Broker) Subscribe(buffer int, filter func(Event) bool) *Subscription {
+	c := make(chan []Event, buffer)
+	s := &Subscription{C: c, c: c, filter: filter}
+	b.mutex.Lock()
+	b.subs[s] = struct{}{}
+	b.mutex.Unlock()
+	return s
+}
+
+// Unsubscribe ends the subscription.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.c)
+	}
+}
+
+// Publish delivers the events that match each subscriber's filter as one batch
+// without blocking. Subscribers whose buffers are full of earlier batches are
+// dropped, so every subscriber either receives all of its matching events or is
+// told that it fell behind.
+func (b *Broker) Publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.subs {
+		matching := events
+		if s.filter != nil {
+			matching = nil
+			for _, e := range events {
+				if s.filter(e) {
+					matching = append(matching, e)
+				}
+			}
+			if len(matching) == 0 {
+				continue
+			}
+		}
+		select {
+		case s.c <- matching:
+		default:
+			s.dropped = true
+			delete(b.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// Subscribers returns the number of current subscribers.
+func (b *Broker) Subscribers() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subs)
+}
+
+// Dropped determines whether the subscription was ended because its subscriber
+// fell behind. Only valid once C has been closed.
+func (s *Subscription) Dropped() bool {
+	return s.dropped
+}
@@ -0,0 +1,108 @@
+package events
+
+// events.go - events describing the changes between two retrievals of a game's
+// master server list
+
+import (
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// EventType is the type of change that an event describes.
+type EventType string
+
+// Event types
+const (
+	// server appeared in the list
+	ServerOnline EventType = "serverOnline"
+	// server is no longer in the list; the event's server is its last state
+	ServerOffline EventType = "serverOffline"
+	MapChanged    EventType = "mapChanged"
+	PlayerJoined  EventType = "playerJoined"
+	PlayerLeft    EventType = "playerLeft"
+	// server reached its maximum number of players
+	ServerFull EventType = "serverFull"
+)
+
+// Event represents a single change to a server between two retrievals of its
+// game's master server list.
+type Event struct {
+	Type        EventType               `json:"type"`
+	Game        string                  `json:"game"`
+	Timestamp   int64                   `json:"timestamp"`
+	Server      models.APIServer        `json:"server"`
+	Player      *models.SteamPlayerInfo `json:"player,omitempty"`
+	PreviousMap string                  `json:"previousMap,omitempty"`
+}
+
+// Diff compares the newly retrieved master server list of a game with the
+// previous one and returns the events that describe the changes, in the order
+// of the new list. No events are returned if there is no previous list.
+func Diff(game string, prev, cur *models.APIServerList) []Event {
+	if prev == nil || cur == nil {
+		return nil
+	}
+	previous := make(map[string]models.APIServer, len(prev.Servers))
+	for _, s := range prev.Servers {
+		previous[s.Host] = s
+	}
+	var events []Event
+	add := func(t EventType, s models.APIServer) *Event {
+		events = append(events, Event{Type: t, Game: game,
+			Timestamp: cur.RetrievedTimeStamp, Server: s})
+		return &events[len(events)-1]
+	}
+	current := make(map[string]bool, len(cur.Servers))
+	for _, s := range cur.Servers {
+		current[s.Host] = true
+		old, ok := previous[s.Host]
+		if !ok {
+			add(ServerOnline, s)
+			continue
+		}
+		if old.Info.Map != s.Info.Map {
+			add(MapChanged, s).PreviousMap = old.Info.Map
+		}
+		joined, left := diffPlayers(old.FilteredPlayers.FilteredPlayers,
+			s.FilteredPlayers.FilteredPlayers)
+		for i := range joined {
+			add(PlayerJoined, s).Player = &joined[i]
+		}
+		for i := range left {
+			add(PlayerLeft, s).Player = &left[i]
+		}
+		if s.Info.MaxPlayers > 0 && old.Info.Players < old.Info.MaxPlayers &&
+			s.Info.Players >= s.Info.MaxPlayers {
+			add(ServerFull, s)
+		}
+	}
+	for _, s := range prev.Servers {
+		if !current[s.Host] {
+			add(ServerOffline, s)
+		}
+	}
+	return events
+}
+
+// diffPlayers returns the players that are only in cur (joined) and those that
+// are only in prev (left), by name.
+func diffPlayers(prev, cur []models.SteamPlayerInfo) (joined,
+	left []models.SteamPlayerInfo) {
+	counts := make(map[string]int, len(prev))
+	for _, p := range prev {
+		counts[p.Name]++
+	}
+	for _, p := range cur {
+		if counts[p.Name] > 0 {
+			counts[p.Name]--
+			continue
+		}
+		joined = append(joined, p)
+	}
+	for i := len(prev) - 1; i >= 0; i-- {
+		if counts[prev[i].Name] > 0 {
+			counts[prev[i].Name]--
+			left = append([]models.SteamPlayerInfo{prev[i]}, left...)
+		}
+	}
+	return joined, left
+}
@@ -0,0 +1,133 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func testServer(host, mapname string, maxplayers int16,
+	players ...string) models.APIServer {
+	s := models.APIServer{Host: host, Info: models.SteamServerInfo{Map: mapname,
+		Players: int16(len(players)), MaxPlayers: maxplayers}}
+	for _, p := range players {
+		s.FilteredPlayers.FilteredPlayers = append(s.FilteredPlayers.FilteredPlayers,
+			models.SteamPlayerInfo{Name: p})
+	}
+	return s
+}
+
+func testList(servers ...models.APIServer) *models.APIServerList {
+	sl := models.GetDefaultServerList()
+	sl.Servers = servers
+	return sl
+}
+
+func TestDiff(t *testing.T) {
+	prev := testList(
+		testServer("10.0.0.1:27960", "campgrounds", 2, "rapha"),
+		testServer("10.0.0.2:27960", "toxicity", 8, "cypher", "k1llsen", "k1llsen"),
+		testServer("10.0.0.3:27960", "bloodrun", 8))
+	cur := testList(
+		testServer("10.0.0.1:27960", "campgrounds", 2, "rapha", "evil"),
+		testServer("10.0.0.2:27960", "aerowalk", 8, "k1llsen", "clawz"),
+		testServer("10.0.0.4:27960", "furiousheights", 8))
+	if e := Diff("QuakeLive", nil, cur); e != nil {
+		t.Fatalf("Expected no events without a previous list, got: %v", e)
+	}
+	expected := []struct {
+		t      EventType
+		host   string
+		player string
+	}{
+		{PlayerJoined, "10.0.0.1:27960", "evil"},
+		{ServerFull, "10.0.0.1:27960", ""},
+		{MapChanged, "10.0.0.2:27960", ""},
+		{PlayerJoined, "10.0.0.2:27960", "clawz"},
+		{PlayerLeft, "10.0.0.2:27960", "cypher"},
+		{PlayerLeft, "10.0.0.2:27960", "k1llsen"},
+		{ServerOnline, "10.0.0.4:27960", ""},
+		{ServerOffline, "10.0.0.3:27960", ""},
+	}
+	events := Diff("QuakeLive", prev, cur)
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got: %d: %+v", len(expected), len(events),
+			events)
+	}
+	for i, x := range expected {
+		e := events[i]
+		if e.Type != x.t || e.Server.Host != x.host || e.Game != "QuakeLive" {
+			t.Fatalf("Expected %s for %s at %d, got: %+v", x.t, x.host, i, e)
+		}
+		if x.player != "" && (e.Player == nil || e.Player.Name != x.player) {
+			t.Fatalf("Expected player %s at %d, got: %+v", x.player, i, e.Player)
+		}
+	}
+	if events[2].PreviousMap != "toxicity" || events[2].Server.Info.Map != "aerowalk" {
+		t.Fatalf("Expected map change from toxicity to aerowalk, got: %+v", events[2])
+	}
+}
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	fast, slow := b.Subscribe(2, nil), b.Subscribe(1, nil)
+	b.Publish([]Event{{Type: ServerOnline}, {Type: ServerOffline}})
+	b.Publish([]Event{{Type: MapChanged}})
+	if b.Subscribers() != 1 {
+		t.Fatalf("Expected the slow subscriber to be dropped, got %d subscribers",
+			b.Subscribers())
+	}
+	if batch := <-fast.C; len(batch) != 2 || batch[0].Type != ServerOnline ||
+		batch[1].Type != ServerOffline {
+		t.Fatalf("Expected %s and %s, got: %+v", ServerOnline, ServerOffline, batch)
+	}
+	if batch := <-fast.C; len(batch) != 1 || batch[0].Type != MapChanged {
+		t.Fatalf("Expected %s, got: %+v", MapChanged, batch)
+	}
+	// the slow subscriber gets the batch it had room for, but not the next one
+	if batch := <-slow.C; len(batch) != 2 {
+		t.Fatalf("Expected the first batch, got: %+v", batch)
+	}
+	if _, ok := <-slow.C; ok || !slow.Dropped() {
+		t.Fatalf("Expected the slow subscription to be closed as dropped")
+	}
+	b.Unsubscribe(fast)
+	b.Unsubscribe(slow)
+	if _, ok := <-fast.C; ok || fast.Dropped() {
+		t.Fatalf("Expected the fast subscription to be closed, but not dropped")
+	}
+}
+
+func TestBrokerLargeBatch(t *testing.T) {
+	b := NewBroker()
+	all := b.Subscribe(1, nil)
+	defer b.Unsubscribe(all)
+	filtered := b.Subscribe(1, func(e Event) bool {
+		return e.Server.Host == "10.0.0.2:27960"
+	})
+	defer b.Unsubscribe(filtered)
+	// the changes of a busy retrieval outnumber the batches that are buffered
+	burst := make([]Event, 0, 5001)
+	for i := 0; i < 5000; i++ {
+		burst = append(burst, Event{Type: PlayerJoined,
+			Server: models.APIServer{Host: "10.0.0.1:27960"}})
+	}
+	// nothing matches the filtered subscriber, so its buffer stays empty
+	b.Publish(burst)
+	if len(filtered.C) != 0 {
+		t.Fatalf("Expected no batch for the filtered subscriber")
+	}
+	<-all.C
+	b.Publish(append(burst, Event{Type: MapChanged,
+		Server: models.APIServer{Host: "10.0.0.2:27960"}}))
+	if b.Subscribers() != 2 {
+		t.Fatalf("Expected no subscriber to be dropped, got %d subscribers",
+			b.Subscribers())
+	}
+	if batch := <-all.C; len(batch) != 5001 {
+		t.Fatalf("Expected all 5001 events, got: %d", len(batch))
+	}
+	if batch := <-filtered.C; len(batch) != 1 || batch[0].Type != MapChanged {
+		t.Fatalf("Expected only the matching event, got: %+v", batch)
+	}
+}
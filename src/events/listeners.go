@@ -0,0 +1,35 @@
+package events
+
+// listeners.go - notification of each newly stored master server list
+
+import (
+	"sync"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// ListListener is called with the previous and newly stored master server list
+// of a game. prev is nil if the game had no list.
+type ListListener func(game string, prev, cur *models.APIServerList)
+
+var (
+	listenersMutex sync.RWMutex
+	listeners      []ListListener
+)
+
+// AddListListener registers the listener to be called after each timed retrieval.
+func AddListListener(l ListListener) {
+	listenersMutex.Lock()
+	listeners = append(listeners, l)
+	listenersMutex.Unlock()
+}
+
+// NotifyListListeners calls each of the registered listeners with the game's
+// previous and newly stored lists.
+func NotifyListListeners(game string, prev, cur *models.APIServerList) {
+	listenersMutex.RLock()
+	defer listenersMutex.RUnlock()
+	for _, l := range listeners {
+		l(game, prev, cur)
+	}
+}
@@ -0,0 +1,106 @@
+package logger
+
+// format.go - JSON and logfmt encoding of log records
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+)
+
+// formatRecord encodes the record as a line in the format, which is logfmt
+// unless JSON is specified.
+func formatRecord(r Record, format string) []byte {
+	if format == config.LogFormatJSON {
+		return formatJSON(r)
+	}
+	return formatLogfmt(r)
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldValue returns the value of a field as it is encoded; errors are encoded as
+// their messages.
+func fieldValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+func formatJSON(r Record) []byte {
+	var b bytes.Buffer
+	write := func(k string, v interface{}) {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		} else {
+			b.WriteByte('{')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		val, err := json.Marshal(fieldValue(v))
+		if err != nil {
+			val, _ = json.Marshal(fmt.Sprint(v))
+		}
+		b.Write(val)
+	}
+	write("time", r.Time.Format(time.RFC3339Nano))
+	write("level", r.Level.String())
+	write("log", r.Log.String())
+	write("msg", r.Msg)
+	for _, k := range sortedKeys(r.Fields) {
+		write(k, r.Fields[k])
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// logfmtValue quotes the value if it is empty or contains spaces, quotes, equals
+// signs or control characters.
+func logfmtValue(v interface{}) string {
+	s := fmt.Sprint(fieldValue(v))
+	if s == "" || strings.IndexFunc(s, func(c rune) bool {
+		return c <= ' ' || c == '=' || c == '"' || c == 0x7f
+	}) != -1 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func formatLogfmt(r Record) []byte {
+	var b bytes.Buffer
+	write := func(k string, v interface{}) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(v))
+	}
+	write("time", r.Time.Format(time.RFC3339Nano))
+	write("level", r.Level.String())
+	write("log", r.Log.String())
+	write("msg", r.Msg)
+	for _, k := range sortedKeys(r.Fields) {
+		write(k, r.Fields[k])
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
@@ -1,360 +1,502 @@
 package logger
 
+// logger.go - structured logging of the application, Steam, web and debug logs
+// to pluggable sinks
+
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
-	"path"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/syncore/a2sapi/src/config"
 	"github.com/syncore/a2sapi/src/constants"
-	"github.com/syncore/a2sapi/src/util"
 )
 
-type logLevel int
+// Level is the severity of a log record.
+type Level int32
 
 const (
-	lDebug logLevel = iota
-	lError
-	lInfo
+	// LevelDebug is the level of messages that are only useful for debugging.
+	LevelDebug Level = iota
+	// LevelInfo is the level of informational messages.
+	LevelInfo
+	// LevelWarn is the level of problems that a2sapi can recover from.
+	LevelWarn
+	// LevelError is the level of errors.
+	LevelError
 )
 
-func getLogPath(lt constants.LogType) string {
-	switch lt {
-	case constants.LTypeApp:
-		return constants.AppLogFilePath
-	case constants.LTypeSteam:
-		return constants.SteamLogFilePath
-	case constants.LTypeWeb:
-		return constants.WebLogFilePath
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
 	default:
-		return constants.AppLogFilePath
+		return ""
 	}
 }
 
-func getLogFilenameFromType(lt constants.LogType) string {
-	switch lt {
-	case constants.LTypeApp:
-		return constants.AppLogFilename
-	case constants.LTypeSteam:
-		return constants.SteamLogFilename
-	case constants.LTypeWeb:
-		return constants.WebLogFilename
-	default:
-		return constants.AppLogFilename
+// ParseLevel returns the level with the name; an empty name is the info level.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
 	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", name)
 }
 
-func deleteLogs(lt constants.LogType) error {
-	logfiles, err := getLogFiles(lt)
-	if err != nil {
-		return err
+// The names of the fields that are common to several log records.
+const (
+	FieldHost       = "host"
+	FieldGame       = "game"
+	FieldQueryType  = "queryType"
+	FieldErrorClass = "errorClass"
+	FieldRequestID  = "requestID"
+)
+
+// Fields are the structured fields of a log record.
+type Fields map[string]interface{}
+
+// Record is a log record.
+type Record struct {
+	Time   time.Time
+	Level  Level
+	Log    constants.LogType
+	Msg    string
+	Fields Fields
+}
+
+// Logger writes records to one of the logs, along with its fields.
+type Logger struct {
+	lt     constants.LogType
+	fields Fields
+}
+
+var (
+	// App is the logger of the application log.
+	App = &Logger{lt: constants.LTypeApp}
+	// Steam is the logger of the Steam log.
+	Steam = &Logger{lt: constants.LTypeSteam}
+	// Web is the logger of the web log.
+	Web      = &Logger{lt: constants.LTypeWeb}
+	debugLog = &Logger{lt: constants.LTypeDebug}
+)
+
+// With returns a logger that adds the field to the logger's fields.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	return l.WithFields(Fields{key: value})
+}
+
+// WithFields returns a logger that adds the fields to the logger's fields.
+func (l *Logger) WithFields(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
 	}
-	for _, f := range logfiles {
-		if err := os.Remove(path.Join(constants.LogDirectory, f)); err != nil {
-			return err
-		}
+	for k, v := range fields {
+		merged[k] = v
 	}
-	return nil
+	return &Logger{lt: l.lt, fields: merged}
 }
 
-func isMaxLogSizeExceeded(lt constants.LogType) bool {
-	f, err := os.Stat(getLogPath(lt))
-	if err != nil {
-		return false
+// Debug logs the formatted message at the debug level.
+func (l *Logger) Debug(msg string, a ...interface{}) {
+	l.log(LevelDebug, sprintf(msg, a))
+}
+
+// Info logs the formatted message at the info level.
+func (l *Logger) Info(msg string, a ...interface{}) {
+	l.log(LevelInfo, sprintf(msg, a))
+}
+
+// Warn logs the formatted message at the warn level.
+func (l *Logger) Warn(msg string, a ...interface{}) {
+	l.log(LevelWarn, sprintf(msg, a))
+}
+
+// Error logs the formatted message at the error level and returns it as an
+// error.
+func (l *Logger) Error(msg string, a ...interface{}) error {
+	text := sprintf(msg, a)
+	l.log(LevelError, text)
+	return errors.New(text)
+}
+
+func sprintf(msg string, a []interface{}) string {
+	if len(a) == 0 {
+		return msg
 	}
-	return f.Size() > config.Config.LogConfig.MaximumLogSize*1024
+	return fmt.Sprintf(msg, a...)
 }
 
-func logDirNeedsCleaning(lt constants.LogType) bool {
-	files, err := ioutil.ReadDir(constants.LogDirectory)
-	if err != nil {
-		return false
+func (l *Logger) log(level Level, msg string) {
+	if level < GetLevel() {
+		return
 	}
+	withOutput(func(o *output) {
+		o.write(Record{Time: time.Now(), Level: level, Log: l.lt, Msg: msg,
+			Fields: l.fields})
+	})
+}
 
-	re := regexp.MustCompile(fmt.Sprintf("(?i)%s*.*", getLogFilenameFromType(lt)))
-	logCount := 0
-	for _, f := range files {
-		match := re.FindStringSubmatch(f.Name())
-		if f.IsDir() {
+// sinkEntry is a sink along with the logs and minimum level of the records that
+// are written to it.
+type sinkEntry struct {
+	sink Sink
+	// nil for all logs
+	logs  map[constants.LogType]bool
+	level Level
+}
+
+type output struct {
+	format string
+	sinks  []sinkEntry
+}
+
+func (o *output) write(r Record) {
+	var line []byte
+	for _, s := range o.sinks {
+		if r.Level < s.level || (s.logs != nil && !s.logs[r.Log]) {
 			continue
 		}
-		if len(match) != 1 {
-			continue
+		if line == nil {
+			line = formatRecord(r, o.format)
+		}
+		if err := s.sink.Write(r, line); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write %s log record: %s\n", r.Log, err)
 		}
-		logCount++
 	}
-	return logCount > config.Config.LogConfig.MaximumLogCount
 }
 
-func getLogFiles(lt constants.LogType) ([]string, error) {
-	files, err := ioutil.ReadDir(constants.LogDirectory)
-	if err != nil {
-		return nil, err
+func (o *output) close() {
+	for _, s := range o.sinks {
+		s.sink.Close()
 	}
-	re := regexp.MustCompile(fmt.Sprintf("(?i)(%s.)(\\d+)",
-		getLogFilenameFromType(lt)))
-	var logfiles []string
-	for _, f := range files {
-		if f.IsDir() {
-			continue
+}
+
+var (
+	level     = int32(LevelInfo)
+	outMutex  sync.RWMutex
+	out       *output
+	outLoaded bool
+)
+
+// SetLevel sets the minimum level of the records that are logged.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+// GetLevel returns the minimum level of the records that are logged.
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&level))
+}
+
+// withOutput calls fn with the output while it cannot be replaced. The output is
+// created from the application-wide configuration when it is first needed.
+func withOutput(fn func(o *output)) {
+	outMutex.RLock()
+	if outLoaded {
+		defer outMutex.RUnlock()
+		if out != nil {
+			fn(out)
 		}
-		result := re.FindStringSubmatch(f.Name())
-		if len(result) != 3 {
-			continue
+		return
+	}
+	outMutex.RUnlock()
+	if config.Config == nil {
+		return
+	}
+	outMutex.Lock()
+	if !outLoaded {
+		if err := configure(config.Config); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to configure logging: %s\n", err)
+			outLoaded = true
 		}
-		logfiles = append(logfiles, result[0])
 	}
-	return logfiles, nil
+	outMutex.Unlock()
+	withOutput(fn)
+}
+
+// Configure replaces the log sinks, format and level with those in the
+// configuration.
+func Configure(cfg *config.Cfg) error {
+	outMutex.Lock()
+	defer outMutex.Unlock()
+	return configure(cfg)
 }
 
-func getLatestAndEarliestLogNum(lt constants.LogType) (latest int, earliest int,
-	err error) {
-	logfiles, err := getLogFiles(lt)
+func configure(cfg *config.Cfg) error {
+	o, lvl, err := newOutput(cfg)
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
-	re := regexp.MustCompile(fmt.Sprintf("(?i)(%s.)(\\d+)",
-		getLogFilenameFromType(lt)))
-	for i, f := range logfiles {
-		result := re.FindStringSubmatch(f)
-		if len(result) != 3 {
-			continue
-		}
-		num, err := strconv.Atoi(result[2])
-		if err != nil {
-			continue
-		}
-		if i == 0 {
-			earliest = num
-			latest = num
-		}
-		if num > latest {
-			latest = num
-		}
-		if num < earliest {
-			earliest = num
-		}
+	if out != nil {
+		out.close()
 	}
-	return latest, earliest, nil
+	out, outLoaded = o, true
+	SetLevel(lvl)
+	return nil
 }
 
-func getLatestAndEarliestLog(lt constants.LogType) (latestlogfile string,
-	earliestlogfile string, err error) {
-	latestlognum, earliestlognum, err := getLatestAndEarliestLogNum(lt)
-	if err != nil {
-		return "", "", err
+// SetSinks replaces the log sinks with the sink for all logs, i.e. in tests.
+func SetSinks(format string, sinks ...Sink) {
+	o := &output{format: format}
+	for _, s := range sinks {
+		o.sinks = append(o.sinks, sinkEntry{sink: s})
 	}
-	if earliestlognum == 0 {
-		earliestlogfile = getLogFilenameFromType(lt)
-	} else {
-		earliestlogfile = fmt.Sprintf("%s.%d", getLogFilenameFromType(lt),
-			earliestlognum)
+	outMutex.Lock()
+	defer outMutex.Unlock()
+	if out != nil {
+		out.close()
 	}
-	if latestlognum == 0 {
-		latestlogfile = getLogFilenameFromType(lt)
-	} else {
-		latestlogfile = fmt.Sprintf("%s.%d", getLogFilenameFromType(lt),
-			latestlognum)
-	}
-	return latestlogfile, earliestlogfile, nil
-
+	out, outLoaded = o, true
 }
 
-func verifyLogPaths(lt constants.LogType) error {
-	if err := util.CreateDirectory(constants.LogDirectory); err != nil {
-		return err
+func newOutput(cfg *config.Cfg) (*output, Level, error) {
+	lc := cfg.LogConfig
+	lvl, err := ParseLevel(lc.Level)
+	if err != nil {
+		return nil, lvl, err
 	}
-	if !util.FileExists(getLogPath(lt)) {
-		if err := util.CreateEmptyFile(getLogPath(lt), false); err != nil {
-			return fmt.Errorf("verifyLogPaths error: %s", err)
+	if cfg.DebugConfig.EnableDebugMessages {
+		lvl = LevelDebug
+	}
+	o := &output{format: lc.Format}
+	if len(lc.Sinks) == 0 {
+		err = o.addDefaultSinks(cfg)
+	} else {
+		for _, sc := range lc.Sinks {
+			if err = o.addSink(sc, lc); err != nil {
+				break
+			}
 		}
 	}
-	return nil
+	if err != nil {
+		o.close()
+		return nil, lvl, err
+	}
+	return o, lvl, nil
 }
 
-func verifyLogSettings(lt constants.LogType) error {
-	// too many stale logs
-	if logDirNeedsCleaning(lt) {
-		// delete stale logs
-		if err := deleteLogs(lt); err != nil {
-			return fmt.Errorf("verifyLogSettings error: %s\n", err)
-		}
-		// re-create default logfile
-		if err := util.CreateEmptyFile(getLogPath(lt), true); err != nil {
-			return fmt.Errorf("verifyLogSettings error: %s\n", err)
-		}
+// addDefaultSinks adds the sinks of configurations without any: a file in the
+// logs directory for each enabled log and stdout for the debug messages.
+func (o *output) addDefaultSinks(cfg *config.Cfg) error {
+	lc := cfg.LogConfig
+	files := []struct {
+		enabled bool
+		lt      constants.LogType
+		path    string
+	}{
+		{lc.EnableAppLogging, constants.LTypeApp, constants.AppLogFilePath},
+		{lc.EnableSteamLogging, constants.LTypeSteam, constants.SteamLogFilePath},
+		{lc.EnableWebLogging, constants.LTypeWeb, constants.WebLogFilePath},
 	}
-	// log file to be written to is too large
-	if isMaxLogSizeExceeded(lt) {
-		latestlog, _, err := getLatestAndEarliestLog(lt)
-		if err != nil {
-			return fmt.Errorf("verifyLogSettings error: %s\n", err)
+	for _, f := range files {
+		if !f.enabled {
+			continue
 		}
-		// only app|web.log exists, rename it to app|web.log.1 & re-create
-		if strings.EqualFold(latestlog, getLogFilenameFromType(lt)) {
-			if err := os.Rename(getLogPath(lt), path.Join(constants.LogDirectory,
-				fmt.Sprintf("%s.1", getLogFilenameFromType(lt)))); err != nil {
-				return fmt.Errorf("verifyLogSettings error: %s\n", err)
-			}
-			// re-create default app|web.log
-			if err := util.CreateEmptyFile(getLogPath(lt), true); err != nil {
-				return fmt.Errorf("verifyLogSettings error: %s\n", err)
-			}
-		} else {
-			// other logs exist, rename current as app|web.log.largestnum+1 & re-create
-			latestlognum, _, err := getLatestAndEarliestLogNum(lt)
-			if err != nil {
-				return fmt.Errorf("verifyLogSettings error: %s\n", err)
-			}
-			if err := os.Rename(getLogPath(lt), path.Join(constants.LogDirectory,
-				fmt.Sprintf("%s.%d", getLogFilenameFromType(lt),
-					latestlognum+1))); err != nil {
-				return fmt.Errorf("verifyLogSettings error: %s\n", err)
-			}
-			// re-create
-			if err := util.CreateEmptyFile(getLogPath(lt), true); err != nil {
-				return fmt.Errorf("verifyLogSettings error: %s\n", err)
-			}
+		s, err := NewFileSink(f.path, lc.MaximumLogSize*1024, lc.MaximumLogCount)
+		if err != nil {
+			return err
 		}
+		o.sinks = append(o.sinks, sinkEntry{sink: s,
+			logs: map[constants.LogType]bool{f.lt: true}})
+	}
+	if cfg.DebugConfig.EnableDebugMessages {
+		o.sinks = append(o.sinks, sinkEntry{sink: NewWriterSink(os.Stdout),
+			logs: map[constants.LogType]bool{constants.LTypeDebug: true}})
 	}
 	return nil
 }
 
-func writeLogEntry(lt constants.LogType, loglevel logLevel, msg string,
-	text ...interface{}) error {
-	if lt == constants.LTypeApp && !config.Config.LogConfig.EnableAppLogging {
-		return nil
-	} else if lt == constants.LTypeDebug && !config.Config.DebugConfig.EnableDebugMessages {
-		return nil
-	} else if lt == constants.LTypeSteam && !config.Config.LogConfig.EnableSteamLogging {
-		return nil
-	} else if lt == constants.LTypeWeb && !config.Config.LogConfig.EnableWebLogging {
-		return nil
-	}
-
-	if lt == constants.LTypeDebug {
-		fmt.Printf(fmt.Sprintf("[%s] %s - %s\n",
-			loglevel, time.Now().Format("Mon Jan 2 15:04:05 2006 EST"),
-			fmt.Sprintf(msg, text...)))
-		return nil
-	}
-
-	if err := verifyLogPaths(lt); err != nil {
+func (o *output) addSink(sc config.CfgLogSink, lc config.CfgLog) error {
+	e := sinkEntry{}
+	var err error
+	if e.level, err = ParseLevel(sc.Level); err != nil {
 		return err
 	}
-	if err := verifyLogSettings(lt); err != nil {
-		return err
+	if sc.Level == "" {
+		e.level = LevelDebug
 	}
-	f, err := os.OpenFile(getLogPath(lt), os.O_RDWR|os.O_APPEND, 0666)
-	if err != nil {
-		return fmt.Errorf("Log entry write error, unable to open log file '%s': %s\n",
-			getLogPath(lt), err)
+	if len(sc.Logs) != 0 {
+		e.logs = make(map[constants.LogType]bool, len(sc.Logs))
+		for _, name := range sc.Logs {
+			lt, ok := parseLogType(name)
+			if !ok {
+				return fmt.Errorf("unknown log in %s sink: %s", sc.Type, name)
+			}
+			e.logs[lt] = true
+		}
+	}
+	switch sc.Type {
+	case config.LogSinkFile:
+		if sc.Path == "" {
+			return errors.New("file sink has no path")
+		}
+		e.sink, err = NewFileSink(sc.Path, lc.MaximumLogSize*1024, lc.MaximumLogCount)
+	case config.LogSinkStdout:
+		e.sink = NewWriterSink(os.Stdout)
+	case config.LogSinkSyslog:
+		network, address, tag := sc.Network, sc.Address, sc.Tag
+		if network == "" && address == "" {
+			network, address = "unixgram", "/dev/log"
+		}
+		if tag == "" {
+			tag = "a2sapi"
+		}
+		e.sink, err = NewSyslogSink(network, address, tag)
+	default:
+		return fmt.Errorf("unknown log sink type: %s", sc.Type)
 	}
-	defer f.Close()
-	_, err = f.WriteString(fmt.Sprintf("[%s] %s - %s\n",
-		loglevel, time.Now().Format("Mon Jan _2 15:04:05 2006 EST"),
-		fmt.Sprintf(msg, text...)))
 	if err != nil {
-		return fmt.Errorf("Unable to write log entry '%s': %s\n", text, err)
+		return fmt.Errorf("unable to open %s sink: %s", sc.Type, err)
 	}
-	f.Sync()
+	o.sinks = append(o.sinks, e)
 	return nil
 }
 
-func (l logLevel) String() string {
-	switch l {
-	case lDebug:
-		return "Debug"
-	case lError:
-		return "Error"
-	case lInfo:
-		return "Info"
-	default:
-		return ""
+func parseLogType(name string) (constants.LogType, bool) {
+	for _, lt := range []constants.LogType{constants.LTypeApp,
+		constants.LTypeDebug, constants.LTypeSteam, constants.LTypeWeb} {
+		if strings.EqualFold(name, lt.String()) {
+			return lt, true
+		}
 	}
+	return 0, false
 }
 
-// WriteDebug writes the specified debug message to to stdout, if enabled.
+// WriteDebug writes the specified debug message to the debug log, which is
+// written to stdout if debug messages are enabled.
 func WriteDebug(msg string, input ...interface{}) {
-	if err := writeLogEntry(constants.LTypeDebug, lDebug, msg, input...); err != nil {
-		fmt.Print(err)
-	}
+	debugLog.Debug(msg, input...)
 }
 
-// LogAppError logs application-related errors, if enabled, to the app log file.
+// LogAppError logs application-related errors, if enabled, to the app log.
 func LogAppError(e error, input ...interface{}) error {
-	_ = writeLogEntry(constants.LTypeApp, lError, e.Error(), input...)
-	return fmt.Errorf(e.Error(), input...)
+	return App.Error(e.Error(), input...)
 }
 
-// LogAppErrorf logs formatted application-related errors, if enabled, to the app log file.
+// LogAppErrorf logs formatted application-related errors, if enabled, to the app
+// log.
 func LogAppErrorf(msg string, input ...interface{}) error {
-	_ = writeLogEntry(constants.LTypeApp, lError, msg, input...)
-	return fmt.Errorf(msg, input...)
+	return App.Error(msg, input...)
 }
 
-// LogAppInfo logs application-related info messages, if enabled, to the app log file.
+// LogAppInfo logs application-related info messages, if enabled, to the app log.
 func LogAppInfo(msg string, input ...interface{}) {
-	_ = writeLogEntry(constants.LTypeApp, lInfo, msg, input...)
+	App.Info(msg, input...)
 }
 
-// LogSteamInfo logs Steam-related info messages, if enabled, to the Steam log file.
+// LogSteamInfo logs Steam-related info messages, if enabled, to the Steam log.
 func LogSteamInfo(msg string, input ...interface{}) {
-	_ = writeLogEntry(constants.LTypeSteam, lInfo, msg, input...)
+	Steam.Info(msg, input...)
 }
 
-// LogSteamError logs Steam-related errors, if enabled, to the Steam log file.
+// LogSteamError logs Steam-related errors, if enabled, to the Steam log.
 func LogSteamError(e error, input ...interface{}) error {
-	_ = writeLogEntry(constants.LTypeSteam, lError, e.Error(), input...)
-	return fmt.Errorf(e.Error(), input...)
+	return Steam.Error(e.Error(), input...)
 }
 
-// LogSteamErrorf logs formatted Steam-related errors, if enabled, to the Steam log file.
+// LogSteamErrorf logs formatted Steam-related errors, if enabled, to the Steam
+// log.
 func LogSteamErrorf(msg string, input ...interface{}) error {
-	_ = writeLogEntry(constants.LTypeSteam, lError, msg, input...)
-	return fmt.Errorf(msg, input...)
+	return Steam.Error(msg, input...)
 }
 
-// LogWebError logs API-related web errors, if enabled, to the web log file.
+// LogWebError logs API-related web errors, if enabled, to the web log.
 func LogWebError(e error, input ...interface{}) error {
-	_ = writeLogEntry(constants.LTypeWeb, lError, e.Error(), input...)
-	return fmt.Errorf(e.Error(), input...)
+	return Web.Error(e.Error(), input...)
 }
 
-// LogWebErrorf logs formatted API-related web errors, if enabled, to the web log file.
+// LogWebErrorf logs formatted API-related web errors, if enabled, to the web log.
 func LogWebErrorf(msg string, input ...interface{}) error {
-	if err := writeLogEntry(constants.LTypeWeb, lError, msg, input...); err != nil {
-		fmt.Print(err)
+	return Web.Error(msg, input...)
+}
+
+// RequestIDHeader is the header with the ID of a web request. The ID is taken
+// from the request if it has a valid one, and is always set in the response.
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestIDKey contextKey = 0
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the ID of the web request.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// FromRequest returns the web logger with the ID of the web request.
+func FromRequest(r *http.Request) *Logger {
+	if id := RequestID(r); id != "" {
+		return Web.With(FieldRequestID, id)
 	}
-	return fmt.Errorf(msg, input...)
+	return Web
 }
 
-// LogWebRequest logs web requests as debug messages, if enabled to stdout, as well
-// as logging web requests as info messages to the web log file.
+// LogWebRequest assigns an ID to web requests and logs them as debug messages,
+// as well as logging them as info messages to the web log.
 func LogWebRequest(inner http.Handler, name string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+		start := time.Now()
 		inner.ServeHTTP(w, r)
 		u, err := url.QueryUnescape(r.URL.String())
 		if err != nil {
 			u = fmt.Sprintf("Invalid URL [missing 2 chars after percent sign]: %s",
 				r.URL.String())
 		}
-		if err := writeLogEntry(constants.LTypeDebug, lDebug, fmt.Sprintf(
-			"URL: %s\tPATH: %s\tQUERY:%v", u, r.URL.Path,
-			r.URL.Query())); err != nil {
-			fmt.Print(err)
-		}
-
-		if err := writeLogEntry(constants.LTypeWeb, lInfo, fmt.Sprintf("%s\t%s\t%s\t%s",
-			r.Method, u, r.RemoteAddr, name)); err != nil {
-			fmt.Print(err)
-		}
+		debugLog.With(FieldRequestID, id).Debug("URL: %s\tPATH: %s\tQUERY:%v", u,
+			r.URL.Path, r.URL.Query())
+		Web.WithFields(Fields{FieldRequestID: id, "route": name, "method": r.Method,
+			"url": u, "remoteAddr": r.RemoteAddr,
+			"durationMs": time.Since(start).Milliseconds()}).Info("Web request")
 	})
 }
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/constants"
+)
+
+var testRecord = Record{
+	Time:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	Level: LevelWarn,
+	Log:   constants.LTypeSteam,
+	Msg:   "Query failed",
+	Fields: Fields{FieldHost: "10.0.0.1:27960", FieldGame: "Quake Live",
+		FieldErrorClass: errors.New("timeout")},
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	expected := `time=2026-01-02T03:04:05Z level=warn log=steam msg="Query failed" ` +
+		`errorClass=timeout game="Quake Live" host=10.0.0.1:27960` + "\n"
+	if line := string(formatRecord(testRecord, config.LogFormatLogfmt)); line !=
+		expected {
+		t.Fatalf("Expected logfmt line:\n%s got:\n%s", expected, line)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	line := formatRecord(testRecord, config.LogFormatJSON)
+	if !bytes.HasPrefix(line, []byte(`{"time":"2026-01-02T03:04:05Z","level":"warn"`)) {
+		t.Fatalf("Expected time and level first, got: %s", line)
+	}
+	var m map[string]string
+	if err := json.Unmarshal(line, &m); err != nil {
+		t.Fatalf("Unexpected error decoding JSON line: %s", err)
+	}
+	if m["log"] != "steam" || m["msg"] != "Query failed" ||
+		m[FieldGame] != "Quake Live" || m[FieldErrorClass] != "timeout" {
+		t.Fatalf("Unexpected JSON record: %v", m)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	SetSinks(config.LogFormatLogfmt, NewWriterSink(&buf))
+	defer SetLevel(LevelInfo)
+	SetLevel(LevelWarn)
+	App.Info("not logged")
+	log := Steam.With(FieldHost, "10.0.0.1:27960")
+	log.Warn("logged %d", 1)
+	if err := log.Error("logged %d", 2); err == nil || err.Error() != "logged 2" {
+		t.Fatalf("Expected error to be returned, got: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `level=warn log=steam`) ||
+		!strings.Contains(lines[0], `msg="logged 1" host=10.0.0.1:27960`) ||
+		!strings.Contains(lines[1], "level=error") {
+		t.Fatalf("Expected warn and error lines, got:\n%s", buf.String())
+	}
+	if l, err := ParseLevel("WARNING"); err != nil || l != LevelWarn {
+		t.Fatalf("Expected warn level, got: %s %v", l, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatalf("Expected unknown level to be refused")
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "test.log")
+	s, err := NewFileSink(path, 100, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error opening file sink: %s", err)
+	}
+	defer s.Close()
+	line := []byte(strings.Repeat("x", 39) + "\n")
+	for i := 0; i < 10; i++ {
+		if err := s.Write(testRecord, line); err != nil {
+			t.Fatalf("Unexpected error writing to file sink: %s", err)
+		}
+	}
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Expected log file %s: %s", p, err)
+		}
+		if fi.Size() > 100 {
+			t.Fatalf("Expected %s to be rotated at 100 bytes, got: %d", p, fi.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected at most 3 log files")
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error listening: %s", err)
+	}
+	defer pc.Close()
+	s, err := NewSyslogSink("udp", pc.LocalAddr().String(), "a2sapi")
+	if err != nil {
+		t.Fatalf("Unexpected error opening syslog sink: %s", err)
+	}
+	defer s.Close()
+	if err := s.Write(testRecord, []byte("msg=test\n")); err != nil {
+		t.Fatalf("Unexpected error writing to syslog sink: %s", err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("Unexpected error reading syslog message: %s", err)
+	}
+	// daemon facility, warning severity
+	msg := string(b[:n])
+	if !strings.HasPrefix(msg, "<28>Jan  2 03:04:05 a2sapi[") ||
+		!strings.HasSuffix(msg, "]: msg=test") {
+		t.Fatalf("Unexpected syslog message: %q", msg)
+	}
+}
+
+func TestLogWebRequest(t *testing.T) {
+	var id string
+	h := LogWebRequest(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		id = RequestID(r)
+	}), "Test")
+	for sent, keep := range map[string]bool{"abc-123": true, "": false,
+		"not valid!": false} {
+		req := httptest.NewRequest("GET", "/servers", nil)
+		req.Header.Set(RequestIDHeader, sent)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if id == "" || rec.Header().Get(RequestIDHeader) != id || (id == sent) != keep {
+			t.Fatalf("Unexpected request ID for %q: %q, response: %q", sent, id,
+				rec.Header().Get(RequestIDHeader))
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package logger
+
+// sinks.go - destinations of the log records
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sink is a destination of encoded log records.
+type Sink interface {
+	// Write writes the record, which is encoded as line.
+	Write(r Record, line []byte) error
+	Close() error
+}
+
+// writerSink writes log records to a writer, i.e. stdout.
+type writerSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// NewWriterSink creates a sink that writes log records to the writer.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(r Record, line []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// fileSink writes log records to a file. Once the file would grow beyond its
+// maximum size, it is rotated: the file is renamed with the suffix .1, the
+// previous .1 file to .2 and so on, keeping at most maxCount files.
+type fileSink struct {
+	mutex    sync.Mutex
+	path     string
+	maxSize  int64
+	maxCount int
+	f        *os.File
+	size     int64
+}
+
+// NewFileSink creates a sink that writes log records to the file at the path,
+// rotating it once it would exceed maxSize bytes and keeping at most maxCount
+// files, including the current one. A maxSize of zero or less disables rotation.
+func NewFileSink(path string, maxSize int64, maxCount int) (Sink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &fileSink{path: path, maxSize: maxSize, maxCount: maxCount}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, fi.Size()
+	return nil
+}
+
+func (s *fileSink) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if s.maxCount > 1 {
+		os.Remove(s.rotatedPath(s.maxCount - 1))
+		for n := s.maxCount - 2; n >= 1; n-- {
+			if _, err := os.Stat(s.rotatedPath(n)); err == nil {
+				if err := os.Rename(s.rotatedPath(n), s.rotatedPath(n+1)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := os.Rename(s.path, s.rotatedPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *fileSink) Write(r Record, line []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.f == nil {
+		return fmt.Errorf("log file %s is closed", s.path)
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("unable to rotate log file %s: %s", s.path, err)
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// syslog facility of the log records
+const syslogFacilityDaemon = 3
+
+// syslogSink sends log records to a syslog socket in the BSD syslog format. The
+// connection is re-established if a send fails.
+type syslogSink struct {
+	mutex   sync.Mutex
+	network string
+	address string
+	tag     string
+	conn    net.Conn
+}
+
+// NewSyslogSink creates a sink that sends log records with the tag to the
+// syslog socket at the address on the network (unixgram, unix, udp or tcp).
+func NewSyslogSink(network, address, tag string) (Sink, error) {
+	s := &syslogSink{network: network, address: address, tag: tag}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogSink) connect() error {
+	conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func syslogSeverity(l Level) int {
+	switch l {
+	case LevelDebug:
+		return 7
+	case LevelInfo:
+		return 6
+	case LevelWarn:
+		return 4
+	default:
+		return 3
+	}
+}
+
+func (s *syslogSink) Write(r Record, line []byte) error {
+	msg := []byte(fmt.Sprintf("<%d>%s %s[%d]: %s",
+		syslogFacilityDaemon*8+syslogSeverity(r.Level),
+		r.Time.Format(time.Stamp), s.tag, os.Getpid(),
+		bytes.TrimRight(line, "\n")))
+	// stream sockets need a delimiter between messages
+	if s.network == "tcp" || s.network == "unix" {
+		msg = append(msg, '\n')
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn != nil {
+		if _, err := s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
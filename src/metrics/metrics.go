@@ -0,0 +1,261 @@
+package metrics
+
+// metrics.go - counters, gauges and histograms that are exposed in the
+// Prometheus text format
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of the histogram buckets for durations in
+// seconds that are not expected to be long, i.e. HTTP requests.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	mutex      sync.Mutex
+	families   []*family
+	collectors []func()
+)
+
+// family is a metric along with its values for each combination of label values.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	values map[string]*value
+}
+
+// value is the value of a metric for one combination of label values.
+type value struct {
+	labelValues []string
+	v           float64
+	// histograms only
+	counts []uint64
+	count  uint64
+}
+
+func register(name, help, kind string, buckets []float64,
+	labels []string) *family {
+	f := &family{name: name, help: help, kind: kind, labels: labels,
+		buckets: buckets, values: make(map[string]*value)}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, e := range families {
+		if e.name == name {
+			panic(fmt.Sprintf("metric %s is already registered", name))
+		}
+	}
+	families = append(families, f)
+	return f
+}
+
+// get returns the value for the label values, which must be given in the order
+// of the family's labels. Must be called with the family's mutex held.
+func (f *family) get(labelValues []string) *value {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name,
+			len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v, ok := f.values[key]
+	if !ok {
+		v = &value{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == "histogram" {
+			v.counts = make([]uint64, len(f.buckets))
+		}
+		f.values[key] = v
+	}
+	return v
+}
+
+// Counter is a metric whose values only ever increase.
+type Counter struct {
+	f *family
+}
+
+// NewCounter registers a counter with the labels.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{f: register(name, help, "counter", nil, labels)}
+}
+
+// Inc adds one to the counter's value for the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter's value for the
+// label values.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.f.name))
+	}
+	c.f.mutex.Lock()
+	c.f.get(labelValues).v += delta
+	c.f.mutex.Unlock()
+}
+
+// Gauge is a metric whose values can go up and down.
+type Gauge struct {
+	f *family
+}
+
+// NewGauge registers a gauge with the labels.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{f: register(name, help, "gauge", nil, labels)}
+}
+
+// Set sets the gauge's value for the label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mutex.Lock()
+	g.f.get(labelValues).v = v
+	g.f.mutex.Unlock()
+}
+
+// Reset removes the gauge's values for all label values, i.e. before setting
+// the values of a set of labels that can shrink.
+func (g *Gauge) Reset() {
+	g.f.mutex.Lock()
+	g.f.values = make(map[string]*value)
+	g.f.mutex.Unlock()
+}
+
+// Histogram is a metric that counts observations in buckets.
+type Histogram struct {
+	f *family
+}
+
+// NewHistogram registers a histogram with the upper bounds of its buckets, in
+// increasing order, and the labels. A bucket for all observations is added.
+func NewHistogram(name, help string, buckets []float64,
+	labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s are not sorted", name))
+	}
+	return &Histogram{f: register(name, help, "histogram", buckets, labels)}
+}
+
+// Observe adds the observation to the histogram's buckets for the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mutex.Lock()
+	defer h.f.mutex.Unlock()
+	hv := h.f.get(labelValues)
+	hv.v += v
+	hv.count++
+	for i, le := range h.f.buckets {
+		if v <= le {
+			hv.counts[i]++
+		}
+	}
+}
+
+// OnCollect registers a function that is called before the metrics are written,
+// i.e. to set the gauges whose values are only known at that time.
+func OnCollect(fn func()) {
+	mutex.Lock()
+	collectors = append(collectors, fn)
+	mutex.Unlock()
+}
+
+// Write writes all of the metrics in the Prometheus text format.
+func Write(w io.Writer) error {
+	mutex.Lock()
+	fams := append([]*family(nil), families...)
+	collect := append([]func(){}, collectors...)
+	mutex.Unlock()
+	for _, fn := range collect {
+		fn()
+	}
+	for _, f := range fams {
+		if _, err := io.WriteString(w, f.text()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *family) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help),
+		f.name, f.kind)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	keys := make([]string, 0, len(f.values))
+	for k := range f.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := f.values[k]
+		if f.kind != "histogram" {
+			fmt.Fprintf(&b, "%s%s %s\n", f.name, f.labelText(v.labelValues, ""),
+				formatFloat(v.v))
+			continue
+		}
+		for i, le := range f.buckets {
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name,
+				f.labelText(v.labelValues, formatFloat(le)), v.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name,
+			f.labelText(v.labelValues, "+Inf"), v.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, f.labelText(v.labelValues, ""),
+			formatFloat(v.v))
+		fmt.Fprintf(&b, "%s_count%s %d\n", f.name, f.labelText(v.labelValues, ""),
+			v.count)
+	}
+	return b.String()
+}
+
+// labelText returns the labels with their values, along with the upper bound of
+// a histogram bucket if le is set.
+func (f *family) labelText(labelValues []string, le string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, l := range f.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", l,
+			escapeLabelValue(labelValues[i])))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
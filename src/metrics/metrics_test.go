@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func write(t *testing.T) string {
+	var b bytes.Buffer
+	if err := Write(&b); err != nil {
+		t.Fatalf("Unexpected error writing metrics: %s", err)
+	}
+	return b.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests by \\ route.", "route",
+		"code")
+	c.Inc("GetServers", "200")
+	c.Add(2, "GetServers", "200")
+	c.Inc("GetPlayers", "404")
+	g := NewGauge("test_list_age_seconds", "Age of the lists.", "game")
+	OnCollect(func() {
+		g.Reset()
+		g.Set(1.5, "Quake\"Live")
+	})
+	out := write(t)
+	for _, line := range []string{
+		"# HELP test_requests_total Requests by \\\\ route.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{route="GetPlayers",code="404"} 1`,
+		`test_requests_total{route="GetServers",code="200"} 3`,
+		"# TYPE test_list_age_seconds gauge",
+		`test_list_age_seconds{game="Quake\"Live"} 1.5`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("Expected line %q in output:\n%s", line, out)
+		}
+	}
+	if strings.Index(out, "GetPlayers") > strings.Index(out, "GetServers") {
+		t.Fatalf("Expected values to be sorted by label values:\n%s", out)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected a panic for a counter that decreases")
+		}
+	}()
+	c.Add(-1, "GetServers", "200")
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1},
+		"type")
+	for _, v := range []float64{0.05, 0.5, 0.5, 3} {
+		h.Observe(v, "info")
+	}
+	out := write(t)
+	for _, line := range []string{
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{type="info",le="0.1"} 1`,
+		`test_duration_seconds_bucket{type="info",le="1"} 3`,
+		`test_duration_seconds_bucket{type="info",le="+Inf"} 4`,
+		`test_duration_seconds_sum{type="info"} 4.05`,
+		`test_duration_seconds_count{type="info"} 4`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("Expected line %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	NewGauge("test_registered_twice", "Registered twice.")
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected a panic for a metric that is registered twice")
+		}
+	}()
+	NewCounter("test_registered_twice", "Registered twice.")
+}
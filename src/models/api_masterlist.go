@@ -0,0 +1,160 @@
+package models
+
+// api_masterlist.go - Versioned store for the master server lists
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// MasterListEntry represents a game's master server list in the store, along
+// with the store generation at which it was set and the time it was set.
+type MasterListEntry struct {
+	Game       string
+	List       *APIServerList
+	Generation uint64
+	UpdatedAt  time.Time
+}
+
+// Age returns the time that has passed since the entry's list was set.
+func (e MasterListEntry) Age() time.Duration {
+	return time.Since(e.UpdatedAt)
+}
+
+// MasterListStore contains the lists of all servers returned from the master
+// server for each game retrieved at timed intervals. Lists are swapped in as a
+// whole and are never modified once stored, so they can be safely read while a
+// newer list is being set. Each list that is set increments the generation of
+// the store.
+type MasterListStore struct {
+	mutex      sync.RWMutex
+	generation uint64
+	lists      map[string]MasterListEntry
+}
+
+// MasterLists is the store of the master lists that are directly exposed to the
+// user via queries if timed auto queries are enabled.
+var MasterLists = NewMasterListStore()
+
+// NewMasterListStore creates an empty master list store.
+func NewMasterListStore() *MasterListStore {
+	return &MasterListStore{lists: make(map[string]MasterListEntry)}
+}
+
+// Set replaces the list of all servers for the specified game and returns the
+// new generation. If the list is nil (i.e. the retrieval failed), then the last
+// good list for the game is kept and false is returned.
+func (s *MasterListStore) Set(game string, sl *APIServerList) (uint64, bool) {
+	return s.SetAt(game, sl, time.Now())
+}
+
+// SetAt sets the list like Set, but as if it had been set at the specified time
+// (i.e. a list that was restored from a snapshot).
+func (s *MasterListStore) SetAt(game string, sl *APIServerList,
+	updatedAt time.Time) (uint64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if sl == nil {
+		return s.generation, false
+	}
+	s.generation++
+	s.lists[game] = MasterListEntry{
+		Game:       game,
+		List:       sl,
+		Generation: s.generation,
+		UpdatedAt:  updatedAt,
+	}
+	return s.generation, true
+}
+
+// Swap replaces the list of all servers for the specified game like Set and
+// also returns the list that it replaced, which is nil if the game had no list.
+// Since both happen at once, concurrent swaps for the same game each get the
+// list that was stored right before their own.
+func (s *MasterListStore) Swap(game string, sl *APIServerList) (*APIServerList,
+	uint64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if sl == nil {
+		return nil, s.generation, false
+	}
+	prev := s.lists[game].List
+	s.generation++
+	s.lists[game] = MasterListEntry{
+		Game:       game,
+		List:       sl,
+		Generation: s.generation,
+		UpdatedAt:  time.Now(),
+	}
+	return prev, s.generation, true
+}
+
+// Remove removes the list for the specified game.
+func (s *MasterListStore) Remove(game string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.lists, game)
+}
+
+// Generation returns the current generation of the store.
+func (s *MasterListStore) Generation() uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.generation
+}
+
+// Get returns the entries for the specified games. If no games are specified,
+// then the entries for all games are returned. Games whose list has not yet been
+// retrieved are omitted.
+func (s *MasterListStore) Get(games []string) []MasterListEntry {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var entries []MasterListEntry
+	for game, e := range s.lists {
+		if len(games) == 0 {
+			entries = append(entries, e)
+			continue
+		}
+		for _, g := range games {
+			if strings.EqualFold(game, g) {
+				entries = append(entries, e)
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// MergeMasterLists combines the lists of multiple entries into a single new list.
+// The retrieval date of the combined list is that of the most recently retrieved
+// list, its generation is the newest generation and its data age is that of the
+// oldest list. Returns nil if there are no entries to combine.
+func MergeMasterLists(entries []MasterListEntry) *APIServerList {
+	if len(entries) == 0 {
+		return nil
+	}
+	merged := &APIServerList{
+		Servers:       make([]APIServer, 0),
+		FailedServers: make([]string, 0),
+	}
+	for _, e := range entries {
+		sl := e.List
+		if sl.RetrievedTimeStamp > merged.RetrievedTimeStamp {
+			merged.RetrievedAt = sl.RetrievedAt
+			merged.RetrievedTimeStamp = sl.RetrievedTimeStamp
+		}
+		if e.Generation > merged.Generation {
+			merged.Generation = e.Generation
+		}
+		if age := int64(e.Age().Seconds()); age > merged.DataAge {
+			merged.DataAge = age
+		}
+		merged.Servers = append(merged.Servers, sl.Servers...)
+		merged.FailedServers = append(merged.FailedServers, sl.FailedServers...)
+	}
+	merged.ServerCount = len(merged.Servers)
+	merged.TotalCount = merged.ServerCount
+	merged.FailedCount = len(merged.FailedServers)
+	return merged
+}
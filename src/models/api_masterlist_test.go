@@ -0,0 +1,52 @@
+package models
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMasterListStoreSwap(t *testing.T) {
+	s := NewMasterListStore()
+	if prev, _, ok := s.Swap("QuakeLive", nil); ok || prev != nil {
+		t.Fatalf("Expected nil list not to be stored")
+	}
+	first := GetDefaultServerList()
+	prev, gen, ok := s.Swap("QuakeLive", first)
+	if !ok || prev != nil || gen != 1 {
+		t.Fatalf("Expected first list with no previous list, got: %v %d %v",
+			prev, gen, ok)
+	}
+	// every concurrently swapped list must be replaced exactly once, otherwise
+	// the changes between two of the lists would be lost or reported twice
+	const swaps = 100
+	lists := make([]*APIServerList, swaps)
+	prevs := make([]*APIServerList, swaps)
+	var wg sync.WaitGroup
+	for i := range lists {
+		lists[i] = GetDefaultServerList()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			prevs[i], _, _ = s.Swap("QuakeLive", lists[i])
+		}(i)
+	}
+	wg.Wait()
+	replaced := make(map[*APIServerList]int)
+	for _, p := range prevs {
+		replaced[p]++
+	}
+	last := s.Get([]string{"QuakeLive"})[0].List
+	for _, l := range append(lists, first) {
+		if l == last {
+			continue
+		}
+		if replaced[l] != 1 {
+			t.Fatalf("Expected each list to be replaced once, got: %d",
+				replaced[l])
+		}
+	}
+	if replaced[last] != 0 || s.Generation() != swaps+1 {
+		t.Fatalf("Expected last list not to be replaced at generation %d, got: %d",
+			swaps+1, s.Generation())
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+// api_ping.go - Model for the latency of servers as measured from the API host
+
+import (
+	"time"
+)
+
+// APIServerPing represents the round-trip times of the A2S_INFO queries sent to a
+// server from the API host, in milliseconds.
+type APIServerPing struct {
+	ID          int64     `json:"serverID"`
+	Host        string    `json:"address"`
+	Game        string    `json:"game"`
+	Ping        float64   `json:"ping"`
+	PingSamples []float64 `json:"pingSamples"`
+}
+
+// APIPingList represents the servers that were pinged in response to a user's
+// API request, from the lowest to the highest ping.
+type APIPingList struct {
+	RetrievedAt        string          `json:"retrievalDate"`
+	RetrievedTimeStamp int64           `json:"timestamp"`
+	ServerCount        int             `json:"serverCount"`
+	Servers            []APIServerPing `json:"servers"`
+	FailedCount        int             `json:"failedCount"`
+	FailedServers      []string        `json:"failedServers"`
+}
+
+// GetDefaultPingList returns a default, empty, ping list with the current date
+// and time.
+func GetDefaultPingList() *APIPingList {
+	return &APIPingList{
+		RetrievedAt:        time.Now().Format("Mon Jan 2 15:04:05 2006 EST"),
+		RetrievedTimeStamp: time.Now().Unix(),
+		Servers:            make([]APIServerPing, 0),
+		FailedServers:      make([]string, 0),
+	}
+}
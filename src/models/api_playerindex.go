@@ -0,0 +1,274 @@
+package models
+
+// api_playerindex.go - Index of the players on the servers in the master lists
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// number of a player's most recent sessions that are kept
+	maxPlayerSessions = 10
+	// sessions that ended longer ago than this are removed
+	playerSessionRetention = 24 * time.Hour
+	// PlayerMatchSubstring is the match type of a player whose name contains the
+	// searched name.
+	PlayerMatchSubstring = "substring"
+	// PlayerMatchFuzzy is the match type of a player whose name is within a few
+	// edits of the searched name.
+	PlayerMatchFuzzy = "fuzzy"
+)
+
+// PlayerSession represents a period of time during which a player was seen on a
+// server.
+type PlayerSession struct {
+	ServerID int64  `json:"serverID"`
+	Host     string `json:"address"`
+	Game     string `json:"game"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Ongoing  bool   `json:"ongoing"`
+}
+
+// APIPlayer represents a player that matched a user's player search along with
+// the server that the player is currently on.
+type APIPlayer struct {
+	Name              string          `json:"name"`
+	MatchType         string          `json:"matchType"`
+	Score             int32           `json:"score"`
+	TimeConnectedSecs float32         `json:"secsConnected"`
+	ServerID          int64           `json:"serverID"`
+	Host              string          `json:"address"`
+	Game              string          `json:"game"`
+	ServerName        string          `json:"serverName"`
+	Map               string          `json:"map"`
+	CountryInfo       DbCountry       `json:"location"`
+	Sessions          []PlayerSession `json:"sessions,omitempty"`
+}
+
+// APIPlayerList represents the players returned in response to a user's player
+// search from the API.
+type APIPlayerList struct {
+	IndexedTimeStamp int64       `json:"indexedTimestamp"`
+	PlayerCount      int         `json:"playerCount"`
+	Players          []APIPlayer `json:"players"`
+}
+
+// GetDefaultPlayerList returns a default, empty, player list in response to a
+// player search that failed or had no matches.
+func GetDefaultPlayerList() *APIPlayerList {
+	return &APIPlayerList{
+		PlayerCount: 0,
+		Players:     make([]APIPlayer, 0),
+	}
+}
+
+type indexedPlayer struct {
+	key    string
+	player APIPlayer
+}
+
+// PlayerIndexStore is an index of the players that are currently on the servers
+// in the master lists, along with the recent sessions of each player name.
+type PlayerIndexStore struct {
+	mutex    sync.RWMutex
+	builtAt  time.Time
+	players  []indexedPlayer
+	sessions map[string][]PlayerSession
+}
+
+// PlayerIndex is the index of the players in the master lists that is rebuilt
+// after each timed retrieval.
+var PlayerIndex = NewPlayerIndexStore()
+
+// NewPlayerIndexStore creates an empty player index.
+func NewPlayerIndexStore() *PlayerIndexStore {
+	return &PlayerIndexStore{sessions: make(map[string][]PlayerSession)}
+}
+
+// normalizePlayerName lower-cases the name and removes its color codes (i.e. ^1)
+// and surrounding whitespace.
+func normalizePlayerName(name string) string {
+	r := []rune(strings.ToLower(name))
+	n := make([]rune, 0, len(r))
+	for i := 0; i < len(r); i++ {
+		if r[i] == '^' && i+1 < len(r) && unicode.IsDigit(r[i+1]) {
+			i++
+			continue
+		}
+		n = append(n, r[i])
+	}
+	return strings.TrimSpace(string(n))
+}
+
+// Rebuild replaces the index with the players on the servers of the master list
+// entries. Sessions are continued for players that are still on the same server
+// and ended for players that are no longer seen on it.
+func (s *PlayerIndexStore) Rebuild(entries []MasterListEntry, now time.Time) {
+	var players []indexedPlayer
+	seen := make(map[string]map[string]int64)
+	for _, e := range entries {
+		for _, srv := range e.List.Servers {
+			for _, p := range srv.FilteredPlayers.FilteredPlayers {
+				key := normalizePlayerName(p.Name)
+				if key == "" {
+					continue
+				}
+				players = append(players, indexedPlayer{key: key, player: APIPlayer{
+					Name:              p.Name,
+					Score:             p.Score,
+					TimeConnectedSecs: p.TimeConnectedSecs,
+					ServerID:          srv.ID,
+					Host:              srv.Host,
+					Game:              srv.Game,
+					ServerName:        srv.Info.Name,
+					Map:               srv.Info.Map,
+					CountryInfo:       srv.CountryInfo,
+				}})
+				if seen[key] == nil {
+					seen[key] = make(map[string]int64)
+				}
+				seen[key][srv.Host] = e.List.RetrievedTimeStamp
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, ip := range players {
+		p := ip.player
+		seenAt := seen[ip.key][p.Host]
+		sessions := s.sessions[ip.key]
+		continued := false
+		for i := range sessions {
+			if sessions[i].Ongoing && sessions[i].Host == p.Host {
+				sessions[i].End = seenAt
+				continued = true
+				break
+			}
+		}
+		if !continued {
+			s.sessions[ip.key] = append(sessions, PlayerSession{
+				ServerID: p.ServerID,
+				Host:     p.Host,
+				Game:     p.Game,
+				Start:    seenAt - int64(p.TimeConnectedSecs),
+				End:      seenAt,
+				Ongoing:  true,
+			})
+		}
+	}
+	cutoff := now.Add(-playerSessionRetention).Unix()
+	for key, sessions := range s.sessions {
+		kept := sessions[:0]
+		for _, ps := range sessions {
+			if _, ok := seen[key][ps.Host]; !ok {
+				ps.Ongoing = false
+			}
+			if ps.Ongoing || ps.End >= cutoff {
+				kept = append(kept, ps)
+			}
+		}
+		if len(kept) > maxPlayerSessions {
+			kept = kept[len(kept)-maxPlayerSessions:]
+		}
+		if len(kept) == 0 {
+			delete(s.sessions, key)
+			continue
+		}
+		s.sessions[key] = kept
+	}
+	s.players = players
+	s.builtAt = now
+}
+
+// Search returns the players whose names contain any of the names, ignoring case
+// and color codes. If fuzzy is set, players whose names are within a few edits of
+// a name are also returned. If withSessions is set, each player's recent sessions
+// are included.
+func (s *PlayerIndexStore) Search(names []string, fuzzy,
+	withSessions bool) *APIPlayerList {
+	queries := make([]string, 0, len(names))
+	for _, n := range names {
+		if q := normalizePlayerName(n); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	pl := GetDefaultPlayerList()
+	pl.IndexedTimeStamp = s.builtAt.Unix()
+	for _, ip := range s.players {
+		match := ""
+		for _, q := range queries {
+			if strings.Contains(ip.key, q) {
+				match = PlayerMatchSubstring
+				break
+			}
+			if fuzzy && isFuzzyMatch(ip.key, q) {
+				match = PlayerMatchFuzzy
+			}
+		}
+		if match == "" {
+			continue
+		}
+		p := ip.player
+		p.MatchType = match
+		if withSessions {
+			p.Sessions = append([]PlayerSession(nil), s.sessions[ip.key]...)
+		}
+		pl.Players = append(pl.Players, p)
+	}
+	// substring matches first
+	sort.SliceStable(pl.Players, func(i, j int) bool {
+		return pl.Players[i].MatchType == PlayerMatchSubstring &&
+			pl.Players[j].MatchType != PlayerMatchSubstring
+	})
+	pl.PlayerCount = len(pl.Players)
+	return pl
+}
+
+// isFuzzyMatch determines whether the name is within one edit for every three
+// characters of the query, rounded down, and at least one.
+func isFuzzyMatch(name, query string) bool {
+	max := len([]rune(query)) / 3
+	if max < 1 {
+		max = 1
+	}
+	return editDistance([]rune(name), []rune(query)) <= max
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -8,12 +8,19 @@ import "time"
 // building the master list or in response to building the list of server details
 // via a user's API request.
 type APIServerList struct {
-	RetrievedAt        string      `json:"retrievalDate"`
-	RetrievedTimeStamp int64       `json:"timestamp"`
-	ServerCount        int         `json:"serverCount"`
-	Servers            []APIServer `json:"servers"`
-	FailedCount        int         `json:"failedCount"`
-	FailedServers      []string    `json:"failedServers"`
+	RetrievedAt        string `json:"retrievalDate"`
+	RetrievedTimeStamp int64  `json:"timestamp"`
+	Generation         uint64 `json:"generation"`
+	DataAge            int64  `json:"dataAgeSecs"`
+	ServerCount        int    `json:"serverCount"`
+	// number of servers before the list was paged
+	TotalCount int `json:"totalCount"`
+	// offset and cursor of the next page, if there is one
+	NextOffset    int         `json:"nextOffset,omitempty"`
+	NextCursor    string      `json:"nextCursor,omitempty"`
+	Servers       []APIServer `json:"servers"`
+	FailedCount   int         `json:"failedCount"`
+	FailedServers []string    `json:"failedServers"`
 }
 
 // APIServer represents an individual game server's information, including its
@@ -29,12 +36,16 @@ type APIServer struct {
 	Players         []SteamPlayerInfo  `json:"players"`
 	FilteredPlayers FilteredPlayerInfo `json:"filteredPlayers"`
 	Rules           map[string]string  `json:"rules"`
+	QueryAttempts   int                `json:"queryAttempts"`
+	// median and individual round-trip times of the queries, in milliseconds
+	Ping        float64   `json:"ping"`
+	PingSamples []float64 `json:"pingSamples"`
+	// response history as of the retrieval of the list
+	Reliability ServerReliability `json:"reliability"`
+	// distance from the location of a /servers?near= request
+	DistanceKm float64 `json:"distanceKm,omitempty"`
 }
 
-// MasterList represents the list of all servers returned from the master server
-// and directly exposed to the user via queries if timed auto queries are enabled.
-var MasterList *APIServerList
-
 // GetDefaultServerList Returns a default, empty, server list with the current
 // date and time in response to a server detail list request that failed for
 // whatever reason.
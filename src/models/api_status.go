@@ -0,0 +1,26 @@
+package models
+
+// api_status.go - Status of the API and of the timed retrievals
+
+// APIRetrievalStatus represents the outcome of the last timed retrieval of a
+// game's servers. The server counts are those of the last successful retrieval.
+type APIRetrievalStatus struct {
+	Game                      string  `json:"game"`
+	LastRetrievalTimeStamp    int64   `json:"lastRetrievalTimeStamp"`
+	LastRetrievalDurationSecs float64 `json:"lastRetrievalDurationSecs"`
+	LastRetrievalSucceeded    bool    `json:"lastRetrievalSucceeded"`
+	LastSuccessTimeStamp      int64   `json:"lastSuccessTimeStamp"`
+	ServerCount               int     `json:"serverCount"`
+	FailedCount               int     `json:"failedCount"`
+}
+
+// APIStatus represents the status of the API, along with its effective
+// configuration without any secrets.
+type APIStatus struct {
+	Version          string               `json:"version"`
+	StartedTimeStamp int64                `json:"startedTimeStamp"`
+	Uptime           string               `json:"uptime"`
+	UptimeSecs       int64                `json:"uptimeSecs"`
+	Games            []APIRetrievalStatus `json:"games"`
+	Config           interface{}          `json:"config"`
+}
@@ -8,4 +8,10 @@ type DbCountry struct {
 	CountryCode string `json:"countryCode"`
 	Continent   string `json:"region"`
 	State       string `json:"state"`
+	City        string `json:"city"`
+	TimeZone    string `json:"timeZone"`
+	// false if the coordinates are not known
+	HasCoordinates bool    `json:"hasCoordinates"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
 }
@@ -0,0 +1,39 @@
+package models
+
+// db_history.go - Model for the server history returned by database
+
+// HistoryPoint represents the average player and bot counts of a server, or the
+// total of a game's or country's servers, within one time bucket.
+type HistoryPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Players   float64 `json:"players"`
+	Bots      float64 `json:"bots"`
+	Map       string  `json:"map,omitempty"`
+}
+
+// HistorySeries represents the history of a single server, game, or country.
+type HistorySeries struct {
+	ServerID    int64          `json:"serverID,omitempty"`
+	Game        string         `json:"game,omitempty"`
+	CountryCode string         `json:"countryCode,omitempty"`
+	Points      []HistoryPoint `json:"points"`
+}
+
+// HistoryList represents the history returned in response to a user's history
+// query from the API.
+type HistoryList struct {
+	From        int64           `json:"from"`
+	To          int64           `json:"to"`
+	Resolution  int64           `json:"resolution"`
+	SeriesCount int             `json:"seriesCount"`
+	Series      []HistorySeries `json:"series"`
+}
+
+// GetDefaultHistoryList returns a default, empty, history list in response to a
+// history request that failed for whatever reason.
+func GetDefaultHistoryList() *HistoryList {
+	return &HistoryList{
+		SeriesCount: 0,
+		Series:      make([]HistorySeries, 0),
+	}
+}
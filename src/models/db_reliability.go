@@ -0,0 +1,20 @@
+package models
+
+// db_reliability.go - Model for the response history of a server across the
+// timed retrievals
+
+// ServerReliability represents how reliably a server has responded to the
+// queries of the timed master server retrievals.
+type ServerReliability struct {
+	// number of retrievals that queried the server and that it responded to
+	Checks    int `json:"checks"`
+	Responses int `json:"responses"`
+	// percentage of the checks that the server responded to
+	Availability float64 `json:"availability"`
+	// average ping of the responses, in milliseconds
+	AvgResponseMs       float64 `json:"avgResponseMs"`
+	ConsecutiveFailures int     `json:"consecutiveFailures"`
+	// unix timestamps of the first and last responses
+	FirstSeen int64 `json:"firstSeen"`
+	LastSeen  int64 `json:"lastSeen"`
+}
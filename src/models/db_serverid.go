@@ -7,6 +7,11 @@ type DbServer struct {
 	ID   int64  `json:"serverID"`
 	Game string `json:"game"`
 	Host string `json:"host"`
+	// unix timestamps of when the server was added and last responded to a query
+	FirstSeen int64 `json:"firstSeen"`
+	LastSeen  int64 `json:"lastSeen"`
+	// response history of the timed retrievals
+	Reliability ServerReliability `json:"reliability"`
 }
 
 // DbServerID represents the outer struct that is retrieved from the server ID
@@ -0,0 +1,43 @@
+package models
+
+// db_webhook.go - Models for the webhook rules and failed deliveries stored in
+// the database
+
+// WebhookRule represents a rule that fires when a server starts to match it.
+// A server matches when it is one of the ServerIDs (if any are specified), has
+// at least MinPlayers players and matches Filter, which takes the same query
+// string parameters as the /servers endpoint (i.e. games=QuakeLive&gametypes=CA).
+// The Secret is only returned by the API when the rule is created.
+type WebhookRule struct {
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	Secret     string  `json:"secret,omitempty"`
+	ServerIDs  []int64 `json:"serverIDs"`
+	MinPlayers int     `json:"minPlayers"`
+	Filter     string  `json:"filter"`
+	Enabled    bool    `json:"enabled"`
+	CreatedAt  int64   `json:"createdAt"`
+}
+
+// WebhookPayload represents the JSON body that is posted to a rule's URL when
+// the rule fires.
+type WebhookPayload struct {
+	RuleID    int64     `json:"ruleID"`
+	RuleName  string    `json:"ruleName"`
+	Game      string    `json:"game"`
+	Timestamp int64     `json:"timestamp"`
+	Server    APIServer `json:"server"`
+}
+
+// WebhookDeadLetter represents a webhook delivery that failed after all of its
+// attempts.
+type WebhookDeadLetter struct {
+	ID       int64  `json:"id"`
+	RuleID   int64  `json:"ruleID"`
+	URL      string `json:"url"`
+	Payload  string `json:"payload"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+	FailedAt int64  `json:"failedAt"`
+}
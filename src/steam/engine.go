@@ -0,0 +1,343 @@
+package steam
+
+// engine.go - query engine that sends and receives all A2S traffic through a
+// small pool of shared UDP sockets
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/logger"
+)
+
+const (
+	// maxQueuedPackets is the number of received packets that are buffered for a
+	// host; enough for the largest split response
+	maxQueuedPackets = maxSplitPackets + 1
+	// maximum wait between attempts to reopen a shared socket
+	maxReopenDelay = 10 * time.Second
+)
+
+var (
+	engine     *queryEngine
+	engineErr  error
+	engineOnce sync.Once
+
+	errEngineClosed = errors.New("query engine closed")
+)
+
+// queryTimeoutError is the error returned when a read from an engineConn times
+// out.
+type queryTimeoutError struct{}
+
+func (queryTimeoutError) Error() string   { return "i/o timeout" }
+func (queryTimeoutError) Timeout() bool   { return true }
+func (queryTimeoutError) Temporary() bool { return true }
+
+// queryEngine multiplexes the A2S queries for any number of hosts over a pool of
+// shared UDP sockets, matching replies to queries by their source address. Only
+// one query per host is in flight at a time, the number of hosts being queried
+// at once is capped and outgoing packets are rate limited.
+type queryEngine struct {
+	next uint32
+
+	// protects the sockets, which are replaced when they fail, and the hosts
+	mutex   sync.Mutex
+	sockets []net.PacketConn
+	hosts   map[string]*engineConn
+
+	sem chan struct{}
+
+	rateMutex sync.Mutex
+	interval  time.Duration
+	nextSend  time.Time
+
+	closed chan struct{}
+}
+
+// engineConn is a net.Conn for a single host's queries that is backed by one of
+// the query engine's shared sockets.
+type engineConn struct {
+	engine *queryEngine
+	socket net.PacketConn
+	addr   *net.UDPAddr
+	recv   chan []byte
+	done   chan struct{}
+	once   sync.Once
+
+	deadlineMutex sync.Mutex
+	readDeadline  time.Time
+}
+
+// newQueryEngine opens the specified number of shared sockets and starts reading
+// from them. A rate of zero or less disables rate limiting.
+func newQueryEngine(sockets, rate, concurrency int) (*queryEngine, error) {
+	if sockets <= 0 || concurrency <= 0 {
+		return nil, errors.New(
+			"query engine needs at least one socket and one concurrent query")
+	}
+	e := &queryEngine{
+		hosts:  make(map[string]*engineConn),
+		sem:    make(chan struct{}, concurrency),
+		closed: make(chan struct{}),
+	}
+	if rate > 0 {
+		e.interval = time.Second / time.Duration(rate)
+	}
+	for i := 0; i < sockets; i++ {
+		pc, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			e.close()
+			return nil, err
+		}
+		e.sockets = append(e.sockets, pc)
+		go e.read(i, pc)
+	}
+	return e, nil
+}
+
+// getQueryEngine returns the application-wide query engine, creating it with the
+// configured options on first use.
+func getQueryEngine() (*queryEngine, error) {
+	engineOnce.Do(func() {
+		if config.Config == nil {
+			engineErr = errors.New("query engine needs the configuration")
+			return
+		}
+		cfg := config.Config.SteamConfig
+		engine, engineErr = newQueryEngine(cfg.QuerySocketCount,
+			cfg.MaxQueriesPerSecond, cfg.MaxConcurrentQueries)
+	})
+	return engine, engineErr
+}
+
+// dialHost returns a connection for querying the host through the query engine.
+func dialHost(host string) (net.Conn, error) {
+	e, err := getQueryEngine()
+	if err != nil {
+		return nil, err
+	}
+	c, err := e.dial(host)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// read dispatches the packets received on the shared socket at the index to the
+// connection of the host that sent them. Packets from hosts that are not being
+// queried are dropped. The socket is replaced if it can no longer be read from.
+func (e *queryEngine) read(i int, pc net.PacketConn) {
+	var buf [maxPacketSize]byte
+	for {
+		numread, addr, err := pc.ReadFrom(buf[:])
+		if err != nil {
+			select {
+			case <-e.closed:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			logger.Steam.With("socket", pc.LocalAddr().String()).Error(
+				"Unable to read from query socket; reopening it: %s", err)
+			pc.Close()
+			e.reopen(i)
+			return
+		}
+		e.mutex.Lock()
+		c, ok := e.hosts[addr.String()]
+		e.mutex.Unlock()
+		if !ok || c.socket != pc {
+			continue
+		}
+		packet := make([]byte, numread)
+		copy(packet, buf[:numread])
+		select {
+		case c.recv <- packet:
+		default:
+		}
+	}
+}
+
+// reopen replaces the shared socket at the index with a new one and starts
+// reading from it, re-trying until it succeeds or the engine is closed. The
+// queries of the hosts that were using the old socket time out.
+func (e *queryEngine) reopen(i int) {
+	for delay := 100 * time.Millisecond; ; delay *= 2 {
+		pc, err := net.ListenPacket("udp", ":0")
+		if err == nil {
+			e.mutex.Lock()
+			defer e.mutex.Unlock()
+			select {
+			case <-e.closed:
+				pc.Close()
+				return
+			default:
+			}
+			e.sockets[i] = pc
+			go e.read(i, pc)
+			return
+		}
+		logger.Steam.Error("Unable to reopen query socket: %s", err)
+		if delay > maxReopenDelay {
+			delay = maxReopenDelay
+		}
+		select {
+		case <-time.After(delay):
+		case <-e.closed:
+			return
+		}
+	}
+}
+
+// dial waits until the host is not being queried and a query slot is available,
+// then returns a connection for the host on the next shared socket.
+func (e *queryEngine) dial(host string) (*engineConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case e.sem <- struct{}{}:
+	case <-e.closed:
+		return nil, errEngineClosed
+	}
+	key := addr.String()
+	for {
+		e.mutex.Lock()
+		existing, ok := e.hosts[key]
+		if !ok {
+			c := &engineConn{
+				engine: e,
+				socket: e.sockets[atomic.AddUint32(&e.next, 1)%uint32(len(e.sockets))],
+				addr:   addr,
+				recv:   make(chan []byte, maxQueuedPackets),
+				done:   make(chan struct{}),
+			}
+			e.hosts[key] = c
+			e.mutex.Unlock()
+			return c, nil
+		}
+		e.mutex.Unlock()
+		select {
+		case <-existing.done:
+		case <-e.closed:
+			<-e.sem
+			return nil, errEngineClosed
+		}
+	}
+}
+
+// wait blocks until the next packet may be sent under the engine's rate limit.
+func (e *queryEngine) wait() {
+	if e.interval == 0 {
+		return
+	}
+	e.rateMutex.Lock()
+	now := time.Now()
+	if e.nextSend.Before(now) {
+		e.nextSend = now
+	}
+	sendAt := e.nextSend
+	e.nextSend = e.nextSend.Add(e.interval)
+	e.rateMutex.Unlock()
+	time.Sleep(sendAt.Sub(now))
+}
+
+func (e *queryEngine) close() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	select {
+	case <-e.closed:
+		return
+	default:
+	}
+	close(e.closed)
+	for _, pc := range e.sockets {
+		pc.Close()
+	}
+}
+
+// Read reads the next packet received from the host.
+func (c *engineConn) Read(b []byte) (int, error) {
+	c.deadlineMutex.Lock()
+	deadline := c.readDeadline
+	c.deadlineMutex.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(deadline.Sub(time.Now()))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p := <-c.recv:
+		return copy(b, p), nil
+	case <-timeout:
+		return 0, &net.OpError{Op: "read", Net: "udp", Addr: c.addr,
+			Err: queryTimeoutError{}}
+	case <-c.done:
+		return 0, &net.OpError{Op: "read", Net: "udp", Addr: c.addr,
+			Err: errEngineClosed}
+	case <-c.engine.closed:
+		return 0, &net.OpError{Op: "read", Net: "udp", Addr: c.addr,
+			Err: errEngineClosed}
+	}
+}
+
+// Write sends a packet to the host once the engine's rate limit allows it. Any
+// packets that are still queued are discarded first, since they are late replies
+// to earlier requests (i.e. attempts that timed out) rather than to this one.
+func (c *engineConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, &net.OpError{Op: "write", Net: "udp", Addr: c.addr,
+			Err: errEngineClosed}
+	default:
+	}
+	for drained := false; !drained; {
+		select {
+		case <-c.recv:
+		default:
+			drained = true
+		}
+	}
+	c.engine.wait()
+	return c.socket.WriteTo(b, c.addr)
+}
+
+// Close releases the host and its query slot.
+func (c *engineConn) Close() error {
+	c.once.Do(func() {
+		c.engine.mutex.Lock()
+		delete(c.engine.hosts, c.addr.String())
+		c.engine.mutex.Unlock()
+		close(c.done)
+		<-c.engine.sem
+	})
+	return nil
+}
+
+func (c *engineConn) LocalAddr() net.Addr  { return c.socket.LocalAddr() }
+func (c *engineConn) RemoteAddr() net.Addr { return c.addr }
+
+// SetDeadline sets the read deadline; writes to the shared sockets do not block.
+func (c *engineConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *engineConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMutex.Lock()
+	c.readDeadline = t
+	c.deadlineMutex.Unlock()
+	return nil
+}
+
+func (c *engineConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
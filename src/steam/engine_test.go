@@ -0,0 +1,181 @@
+package steam
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueryEngine(t *testing.T) {
+	e, err := newQueryEngine(2, 0, 3)
+	if err != nil {
+		t.Fatalf("Unable to start query engine: %s", err)
+	}
+	defer e.close()
+
+	stubs := make([]*a2sStub, 6)
+	for i := range stubs {
+		stubs[i] = newA2SStubWithInfo(t, i%2 == 0,
+			testInfoResponse("stub server", string('a'+rune(i))))
+		defer stubs[i].close()
+	}
+	// six hosts with a cap of three concurrent queries over two sockets; every
+	// reply must be matched to the host that sent it
+	var wg sync.WaitGroup
+	errs := make(chan error, len(stubs))
+	for _, s := range stubs {
+		wg.Add(1)
+		go func(s *a2sStub) {
+			defer wg.Done()
+			c, err := e.dial(s.addr())
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer c.Close()
+			c.SetDeadline(time.Now().Add(2 * time.Second))
+			reply, err := sendChallengeRequest(c, infoChallengeReq, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(reply, s.info) {
+				t.Errorf("Reply for %s was not matched to its host", s.addr())
+			}
+		}(s)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Unexpected error when querying through the engine: %s", err)
+	}
+	if len(e.hosts) != 0 {
+		t.Fatalf("Expected no hosts to be in flight, got: %d", len(e.hosts))
+	}
+	if len(e.sem) != 0 {
+		t.Fatalf("Expected all query slots to be released, got: %d", len(e.sem))
+	}
+}
+
+func TestQueryEngineHostLock(t *testing.T) {
+	e, err := newQueryEngine(1, 0, 2)
+	if err != nil {
+		t.Fatalf("Unable to start query engine: %s", err)
+	}
+	defer e.close()
+	stub := newA2SStub(t, false)
+	defer stub.close()
+
+	first, err := e.dial(stub.addr())
+	if err != nil {
+		t.Fatalf("Unexpected error when dialing: %s", err)
+	}
+	dialed := make(chan *engineConn)
+	go func() {
+		c, _ := e.dial(stub.addr())
+		dialed <- c
+	}()
+	select {
+	case <-dialed:
+		t.Fatalf("Expected second query for the same host to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+	first.Close()
+	select {
+	case c := <-dialed:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("Expected second query to proceed after the first was closed")
+	}
+}
+
+func TestQueryEngineReopensSocket(t *testing.T) {
+	e, err := newQueryEngine(1, 0, 1)
+	if err != nil {
+		t.Fatalf("Unable to start query engine: %s", err)
+	}
+	defer e.close()
+	socket := func() net.PacketConn {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		return e.sockets[0]
+	}
+	// reads from a closed socket fail permanently
+	old := socket()
+	old.Close()
+	for start := time.Now(); socket() == old; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatalf("Expected the failed socket to be reopened")
+		}
+	}
+	stub := newA2SStubWithInfo(t, false, testInfoResponse("stub server", "a"))
+	defer stub.close()
+	c, err := e.dial(stub.addr())
+	if err != nil {
+		t.Fatalf("Unexpected error when dialing: %s", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := sendChallengeRequest(c, infoChallengeReq, nil); err != nil {
+		t.Fatalf("Unexpected error when querying through the reopened socket: %s",
+			err)
+	}
+}
+
+func TestQueryEngineRateLimit(t *testing.T) {
+	e, err := newQueryEngine(1, 50, 1)
+	if err != nil {
+		t.Fatalf("Unable to start query engine: %s", err)
+	}
+	defer e.close()
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		e.wait()
+	}
+	// first packet is sent right away, then one every 20ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Expected 6 packets at 50/s to take at least 100ms, took: %s",
+			elapsed)
+	}
+}
+
+func TestQueryEngineLateReply(t *testing.T) {
+	e, err := newQueryEngine(1, 0, 1)
+	if err != nil {
+		t.Fatalf("Unable to start query engine: %s", err)
+	}
+	defer e.close()
+	stub := newA2SStub(t, false)
+	defer stub.close()
+	// the reply to the first A2S_INFO request arrives after it was re-tried
+	atomic.StoreInt32(&stub.late, 1)
+	c, err := e.dial(stub.addr())
+	if err != nil {
+		t.Fatalf("Unexpected error when dialing: %s", err)
+	}
+	defer c.Close()
+	start := time.Now()
+	c.SetDeadline(start.Add(100 * time.Millisecond))
+	if _, err := sendChallengeRequest(c, infoChallengeReq, nil); err == nil {
+		t.Fatalf("Expected the first attempt to time out")
+	}
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := sendChallengeRequest(c, infoChallengeReq, nil); err != nil {
+		t.Fatalf("Unexpected error when re-trying: %s", err)
+	}
+	// the late reply is queued by the time of the next request
+	time.Sleep(time.Until(start.Add(lateReplyDelay + 100*time.Millisecond)))
+	if len(c.recv) != 1 {
+		t.Fatalf("Expected the late reply to be queued, got: %d", len(c.recv))
+	}
+	reply, err := sendChallengeRequest(c, playerChallengeReq, stub.challenge)
+	if err != nil {
+		t.Fatalf("Unexpected error when requesting players: %s", err)
+	}
+	if !bytes.Equal(reply, stub.players) {
+		t.Fatalf("Expected the players reply, got: %v", reply)
+	}
+}
@@ -6,6 +6,8 @@ package filters
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 // SrvRegion represents a Master server region code filter
@@ -115,22 +117,63 @@ var (
 	}
 )
 
+// regionNames maps the region names that are used in the configuration file to
+// their Master server region codes.
+var regionNames = map[string]SrvRegion{
+	"useast":       SrUsEastCoast,
+	"uswest":       SrUsWestCoast,
+	"southamerica": SrSouthAmerica,
+	"europe":       SrEurope,
+	"asia":         SrAsia,
+	"australia":    SrAustralia,
+	"middleeast":   SrMiddleEast,
+	"africa":       SrAfrica,
+	"all":          SrAll,
+}
+
+// DefaultRegionName is the name of the region that is used when no region is
+// specified for a game.
+const DefaultRegionName = "all"
+
+// GetRegionByName returns the Master server region code for the region with the
+// specified name. An empty name returns the region for all servers.
+func GetRegionByName(name string) (SrvRegion, error) {
+	if name == "" {
+		return SrAll, nil
+	}
+	r, ok := regionNames[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Invalid region '%s'. Valid regions: %s", name,
+			strings.Join(GetRegionNames(), ", "))
+	}
+	return r, nil
+}
+
+// GetRegionNames returns the names of all of the Master server regions.
+func GetRegionNames() []string {
+	names := make([]string, 0, len(regionNames))
+	for n := range regionNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // NewFilter creates a new filter for use with a master server query based on
 // a game to query, its region code, and any other additional master server filters
 // that should be sent with the request to the master server.
 func NewFilter(game Game, region SrvRegion, filters []SrvFilter) Filter {
-	if filters != nil {
-		for i, f := range filters {
-			if bytes.HasPrefix(f, []byte("\\appid\\")) {
-				filters[i] = AppIDFilter(fmt.Sprintf("%d", game.AppID))
-				break
-			} else {
-				filters = append(filters, AppIDFilter(fmt.Sprintf("%d", game.AppID)))
-				break
-			}
+	appIDFilter := AppIDFilter(fmt.Sprintf("%d", game.AppID))
+	replaced := false
+	for i, f := range filters {
+		if bytes.HasPrefix(f, []byte("\\appid\\")) {
+			filters[i] = appIDFilter
+			replaced = true
+			break
 		}
-	} else {
-		filters = append(filters, AppIDFilter(fmt.Sprintf("%d", game.AppID)))
+	}
+	if !replaced {
+		filters = append(filters, appIDFilter)
 	}
 	return Filter{
 		Game:    game,
@@ -0,0 +1,133 @@
+package steam
+
+// latency.go - round-trip time measurement of the A2S queries
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/syncore/a2sapi/src/logger"
+)
+
+// pingSampleCount is the number of A2S_INFO requests sent to each host to
+// measure its latency on demand.
+const pingSampleCount = 3
+
+// rttConn records the time between each write to the connection and the first
+// read that follows it. Writes that are not answered (i.e. time out) are not
+// recorded, and neither are the re-tries of a write that timed out until a reply
+// is read, since a late reply to the earlier write would be timed from the
+// re-try.
+type rttConn struct {
+	net.Conn
+	sent     time.Time
+	timedOut bool
+	rtts     []time.Duration
+}
+
+func (c *rttConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err == nil && !c.timedOut {
+		c.sent = time.Now()
+	}
+	return n, err
+}
+
+func (c *rttConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			c.timedOut = true
+		}
+		c.sent = time.Time{}
+		return n, err
+	}
+	if !c.sent.IsZero() {
+		c.rtts = append(c.rtts, time.Since(c.sent))
+	}
+	c.sent, c.timedOut = time.Time{}, false
+	return n, err
+}
+
+// medianRTT returns the median of the round-trip times, or zero if there are
+// none.
+func medianRTT(rtts []time.Duration) time.Duration {
+	if len(rtts) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(rtts))
+	copy(sorted, rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// RTTMillis converts the round-trip times to milliseconds.
+func RTTMillis(rtts []time.Duration) []float64 {
+	ms := make([]float64, len(rtts))
+	for i, d := range rtts {
+		ms[i] = durationMillis(d)
+	}
+	return ms
+}
+
+// MedianRTTMillis returns the median of the round-trip times in milliseconds.
+func MedianRTTMillis(rtts []time.Duration) float64 {
+	return durationMillis(medianRTT(rtts))
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// pingHost measures the round-trip times of a number of A2S_INFO requests to the
+// host. The requests are sent through the query engine, so they are subject to
+// its rate and concurrency limits. Returns the times of the requests that were
+// answered before one failed after being re-tried.
+func pingHost(host string, policy RetryPolicy) []time.Duration {
+	log := logger.Steam.With(logger.FieldHost, host)
+	conn, err := dialHost(host)
+	if err != nil {
+		log.With(logger.FieldErrorClass, ErrClassConnection).Error(
+			ErrHostConnection(err.Error()).Error())
+		return nil
+	}
+	defer conn.Close()
+	rc := &rttConn{Conn: conn}
+	s := &session{conn: rc, policy: policy, log: log}
+	for i := 0; i < pingSampleCount; i++ {
+		if _, err := s.request(queryTypeInfo, infoChallengeReq, false); err != nil {
+			break
+		}
+	}
+	return rc.rtts
+}
+
+// Ping measures the latency of each of the hosts from the API host, returning a
+// host to round-trip times mapping for the hosts that replied.
+func Ping(hosts []string) map[string][]time.Duration {
+	m := make(map[string][]time.Duration, len(hosts))
+	policy := getRetryPolicy()
+	var wg sync.WaitGroup
+	var mut sync.Mutex
+	wg.Add(len(hosts))
+	for _, host := range hosts {
+		go func(h string) {
+			defer wg.Done()
+			rtts := pingHost(h, policy)
+			if len(rtts) == 0 {
+				return
+			}
+			mut.Lock()
+			defer mut.Unlock()
+			m[h] = rtts
+		}(host)
+	}
+	wg.Wait()
+	return m
+}
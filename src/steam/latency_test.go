@@ -0,0 +1,119 @@
+package steam
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMedianRTT(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		rtts   []time.Duration
+		median time.Duration
+	}{
+		{nil, 0},
+		{[]time.Duration{5 * ms}, 5 * ms},
+		{[]time.Duration{30 * ms, 10 * ms, 20 * ms}, 20 * ms},
+		{[]time.Duration{40 * ms, 10 * ms, 20 * ms, 900 * ms}, 30 * ms},
+	}
+	for _, tt := range tests {
+		if m := medianRTT(tt.rtts); m != tt.median {
+			t.Errorf("Expected median of %v to be %v, got: %v", tt.rtts, tt.median, m)
+		}
+	}
+	rtts := []time.Duration{1500 * time.Microsecond, 20 * ms}
+	if ms := RTTMillis(rtts); !reflect.DeepEqual(ms, []float64{1.5, 20}) {
+		t.Fatalf("Expected round-trip times of [1.5 20] ms, got: %v", ms)
+	}
+	if m := MedianRTTMillis(rtts); m != 10.75 {
+		t.Fatalf("Expected median round-trip time of 10.75 ms, got: %v", m)
+	}
+}
+
+func TestPingHost(t *testing.T) {
+	stub := newA2SStub(t, true)
+	defer stub.close()
+	// info, then info w/ challenge for each sample
+	rtts := pingHost(stub.addr(), testRetryPolicy)
+	if len(rtts) != pingSampleCount+1 {
+		t.Fatalf("Expected %d round-trip times, got: %d", pingSampleCount+1,
+			len(rtts))
+	}
+	for _, d := range rtts {
+		if d <= 0 || d > time.Second {
+			t.Fatalf("Unexpected round-trip time: %v", d)
+		}
+	}
+	// nothing listening
+	if rtts = pingHost("127.0.0.1:1", testRetryPolicy); len(rtts) != 0 {
+		t.Fatalf("Expected no round-trip times for an unreachable host, got: %v",
+			rtts)
+	}
+}
+
+// timeoutConn is a net.Conn whose first read times out and whose later reads
+// return a reply.
+type timeoutConn struct {
+	net.Conn
+	reads int
+}
+
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	c.reads++
+	if c.reads == 1 {
+		return 0, &net.OpError{Op: "read", Net: "udp", Err: queryTimeoutError{}}
+	}
+	return copy(b, expectedInfoRespHeader), nil
+}
+
+func TestRTTConnRetry(t *testing.T) {
+	rc := &rttConn{Conn: &timeoutConn{}}
+	var buf [maxPacketSize]byte
+	rc.Write(infoChallengeReq)
+	if _, err := rc.Read(buf[:]); err == nil {
+		t.Fatalf("Expected the first read to time out")
+	}
+	// the reply to the re-try could be a late reply to the first write
+	rc.Write(infoChallengeReq)
+	rc.Read(buf[:])
+	if len(rc.rtts) != 0 {
+		t.Fatalf("Expected no round-trip time for the re-try, got: %v", rc.rtts)
+	}
+	rc.Write(infoChallengeReq)
+	rc.Read(buf[:])
+	if len(rc.rtts) != 1 {
+		t.Fatalf("Expected a round-trip time for the next request, got: %v",
+			rc.rtts)
+	}
+}
+
+func TestPingHostUsesQueryEngine(t *testing.T) {
+	stub := newA2SStub(t, false)
+	defer stub.close()
+	e, err := getQueryEngine()
+	if err != nil {
+		t.Fatalf("Unable to start query engine: %s", err)
+	}
+	// the engine queries each host once at a time, so the ping has to wait
+	c, err := e.dial(stub.addr())
+	if err != nil {
+		t.Fatalf("Unexpected error when dialing: %s", err)
+	}
+	pinged := make(chan []time.Duration)
+	go func() { pinged <- pingHost(stub.addr(), testRetryPolicy) }()
+	select {
+	case <-pinged:
+		t.Fatalf("Expected the ping to wait for the engine")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.Close()
+	if rtts := <-pinged; len(rtts) != pingSampleCount {
+		t.Fatalf("Expected %d round-trip times, got: %v", pingSampleCount, rtts)
+	}
+}
@@ -16,102 +16,105 @@ import (
 	"github.com/syncore/a2sapi/src/steam/filters"
 )
 
-func buildServerList(data a2sData, addtoServerDB bool) (*models.APIServerList,
-	error) {
-	// Cannot ignore all three requests
-	for _, g := range data.HostsGames {
-		if g.IgnoreInfo && g.IgnorePlayers && g.IgnoreRules {
-			return nil, logger.LogAppErrorf("Cannot ignore all three A2S_ requests!")
-		}
-	}
-	successcount := 0
-	var success bool
-	srvDBhosts := make(map[string]string, len(data.HostsGames))
-	sl := &models.APIServerList{
-		Servers:       make([]models.APIServer, 0),
-		FailedServers: make([]string, 0),
+// listBuilder incrementally builds the list of servers as the results of the
+// hosts' query sessions arrive.
+type listBuilder struct {
+	list         *models.APIServerList
+	srvDBhosts   map[string]string
+	total        int
+	successcount int
+}
+
+func newListBuilder() *listBuilder {
+	return &listBuilder{
+		list: &models.APIServerList{
+			Servers:       make([]models.APIServer, 0),
+			FailedServers: make([]string, 0),
+		},
+		srvDBhosts: make(map[string]string),
 	}
+}
 
-	for host, game := range data.HostsGames {
-		info, iok := data.Info[host]
-		players, pok := data.Players[host]
-		if players == nil {
-			// return empty array instead of nil pointers (null) in json
-			players = make([]models.SteamPlayerInfo, 0)
-		}
-		rules, rok := data.Rules[host]
-		success = iok && rok && pok
+// add adds a host's result to the list, either as a server or as a failed host.
+func (lb *listBuilder) add(r hostResult) {
+	lb.total++
+	if !r.success() {
+		lb.list.FailedServers = append(lb.list.FailedServers, r.Host)
+		return
+	}
+	game := r.Game
+	players := r.Players
+	if players == nil {
+		// return empty array instead of nil pointers (null) in json
+		players = make([]models.SteamPlayerInfo, 0)
+	}
+	rules := r.Rules
+	if game.IgnoreRules {
+		rules = make(map[string]string, 0)
+	}
+	srv := models.APIServer{
+		Game:            game.Name,
+		Players:         players,
+		FilteredPlayers: removeBuggedPlayers(players),
+		Rules:           rules,
+		Info:            r.Info,
+		QueryAttempts:   r.Attempts,
+		Ping:            MedianRTTMillis(r.RTTs),
+		PingSamples:     RTTMillis(r.RTTs),
+	}
+	// Gametype support: gametype can be found in rules, info, or not
+	// at all depending on the game (currently just for QuakeLive & Reflex)
+	srv.Info.GameTypeShort, srv.Info.GameTypeFull = getGameType(game, srv)
 
-		if game.IgnoreInfo {
-			success = pok && rok
-		}
-		if game.IgnorePlayers {
-			success = iok && rok
+	ip, port, serr := net.SplitHostPort(r.Host)
+	if serr == nil {
+		srv.IP = ip
+		srv.Host = r.Host
+		p, perr := strconv.Atoi(port)
+		if perr == nil {
+			srv.Port = p
 		}
-		if game.IgnoreRules {
-			rules = make(map[string]string, 0)
-			success = iok && pok
-		}
-		if game.IgnoreInfo && game.IgnorePlayers {
-			success = rok
-		}
-		if game.IgnoreInfo && game.IgnoreRules {
-			success = pok
-		}
-		if game.IgnorePlayers && game.IgnoreRules {
-			success = iok
-		}
-
-		if success {
-			srv := models.APIServer{
-				Game:            game.Name,
-				Players:         players,
-				FilteredPlayers: removeBuggedPlayers(players),
-				Rules:           rules,
-				Info:            info,
-			}
-			// Gametype support: gametype can be found in rules, info, or not
-			// at all depending on the game (currently just for QuakeLive & Reflex)
-			srv.Info.GameTypeShort, srv.Info.GameTypeFull = getGameType(game, srv)
-
-			ip, port, serr := net.SplitHostPort(host)
-			if serr == nil {
-				srv.IP = ip
-				srv.Host = host
-				p, perr := strconv.Atoi(port)
-				if perr == nil {
-					srv.Port = p
-				}
-				if !strings.EqualFold(game.Name, filters.GameUnspecified.String()) {
-					srvDBhosts[host] = game.Name
-				}
-				loc := make(chan models.DbCountry, 1)
-				go db.CountryDB.GetCountryInfo(loc, ip)
-				srv.CountryInfo = <-loc
-			}
-			sl.Servers = append(sl.Servers, srv)
-			successcount++
-		} else {
-			sl.FailedServers = append(sl.FailedServers, host)
+		if !strings.EqualFold(game.Name, filters.GameUnspecified.String()) {
+			lb.srvDBhosts[r.Host] = game.Name
 		}
+		loc := make(chan models.DbCountry, 1)
+		go db.CountryDB.GetCountryInfo(loc, ip)
+		srv.CountryInfo = <-loc
 	}
+	lb.list.Servers = append(lb.list.Servers, srv)
+	lb.successcount++
+}
 
+// finish completes the list once every host's result has been added.
+func (lb *listBuilder) finish() *models.APIServerList {
+	sl := lb.list
 	sl.RetrievedAt = time.Now().Format("Mon Jan 2 15:04:05 2006 EST")
 	sl.RetrievedTimeStamp = time.Now().Unix()
 	sl.ServerCount = len(sl.Servers)
+	sl.TotalCount = sl.ServerCount
 	sl.FailedCount = len(sl.FailedServers)
 
-	if len(srvDBhosts) != 0 {
-		go db.ServerDB.AddServersToDB(srvDBhosts)
+	if len(lb.srvDBhosts) != 0 {
+		go db.ServerDB.AddServersToDB(lb.srvDBhosts)
 		sl.Servers = setServerIDsForList(sl.Servers)
 	}
 
 	logger.LogAppInfo(
 		"Successfully queried (%d/%d) servers. %d timed out or otherwise failed.",
-		successcount, len(data.HostsGames), sl.FailedCount)
+		lb.successcount, lb.total, sl.FailedCount)
 	logger.WriteDebug("Server Queries: Successful: (%d/%d) servers\tFailed: %d servers",
-		successcount, len(data.HostsGames), sl.FailedCount)
-	return sl, nil
+		lb.successcount, lb.total, sl.FailedCount)
+	return sl
+}
+
+// buildList builds the list of servers from the results of the hosts' query
+// sessions as they arrive.
+func buildList(results <-chan hostResult) *models.APIServerList {
+	lb := newListBuilder()
+	for r := range results {
+		lb.add(r)
+	}
+	return lb.finish()
 }
 
 // removeBuggedPlayers filters the players to remove "bugged" or stuck players
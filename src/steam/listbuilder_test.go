@@ -10,7 +10,11 @@ import (
 	"github.com/syncore/a2sapi/src/test"
 )
 
-var testData a2sData
+var (
+	// query session results of two servers and a host that did not reply
+	testResults []hostResult
+	testPlayers map[string][]models.SteamPlayerInfo
+)
 
 func init() {
 	test.SetupEnvironment()
@@ -150,22 +154,31 @@ func init() {
 		},
 	}
 	players["192.211.62.11:27960"] = nil
-	testData = a2sData{
-		HostsGames: hostsgames,
-		Info:       info,
-		Rules:      rules,
-		Players:    players,
+	testPlayers = players
+	for host, game := range hostsgames {
+		r := hostResult{Host: host, Game: game}
+		r.Info, r.InfoOK = info[host]
+		r.Players, r.PlyrOK = players[host]
+		r.Rules, r.RulesOK = rules[host]
+		testResults = append(testResults, r)
 	}
+	testResults = append(testResults, hostResult{Host: "10.9.9.9:27960",
+		Game: filters.GameQuakeLive})
 }
 
-func TestBuildServerList(t *testing.T) {
-	asl, err := buildServerList(testData, false)
-	if err != nil {
-		t.Fatalf("Unexpected error occurred when building server list.")
+func TestBuildList(t *testing.T) {
+	results := make(chan hostResult, len(testResults))
+	for _, r := range testResults {
+		results <- r
 	}
-	if len(asl.Servers) != 2 {
+	close(results)
+	asl := buildList(results)
+	if len(asl.Servers) != 2 || asl.ServerCount != 2 {
 		t.Fatalf("Expected 2 servers, got: %d", len(asl.Servers))
 	}
+	if asl.FailedCount != 1 || asl.FailedServers[0] != "10.9.9.9:27960" {
+		t.Fatalf("Expected 1 failed server, got: %v", asl.FailedServers)
+	}
 	// Slice not guaranteed to be in order
 	var reflexServer models.APIServer
 	var qlServer models.APIServer
@@ -191,7 +204,7 @@ func TestBuildServerList(t *testing.T) {
 }
 
 func TestRemoveBuggedPlayers(t *testing.T) {
-	buggedRemoved := removeBuggedPlayers(testData.Players["54.172.5.67:25801"])
+	buggedRemoved := removeBuggedPlayers(testPlayers["54.172.5.67:25801"])
 	if len(buggedRemoved.FilteredPlayers) != 5 {
 		t.Fatalf("Expected 5 players after bugged player removal, got: %d",
 			len(buggedRemoved.FilteredPlayers))
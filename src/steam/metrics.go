@@ -0,0 +1,66 @@
+package steam
+
+// metrics.go - metrics of the timed retrievals and the A2S queries
+
+import (
+	"time"
+
+	"github.com/syncore/a2sapi/src/metrics"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// names of the A2S query types in the metrics
+const (
+	queryTypeInfo    = "info"
+	queryTypePlayers = "players"
+	queryTypeRules   = "rules"
+)
+
+var (
+	retrievalDuration = metrics.NewHistogram("a2sapi_retrieval_duration_seconds",
+		"Duration of the timed master server retrievals, including the queries of every server.",
+		[]float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300}, "game")
+	retrievals = metrics.NewCounter("a2sapi_retrievals_total",
+		"Timed master server retrievals by result (success or failure).",
+		"game", "result")
+	retrievalServers = metrics.NewGauge("a2sapi_retrieval_servers",
+		"Servers of the last successful retrieval by result (success or failure).",
+		"game", "result")
+	queryDuration = metrics.NewHistogram("a2sapi_query_duration_seconds",
+		"Latency of the A2S query attempts that were answered, by query type.",
+		[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5}, "type")
+	queries = metrics.NewCounter("a2sapi_queries_total",
+		"A2S queries by query type and result (success or failure), after any retries.",
+		"type", "result")
+	queryRetries = metrics.NewCounter("a2sapi_query_retries_total",
+		"Re-tried A2S query attempts by query type.", "type")
+)
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// recordRetrieval records the duration and outcome of a timed retrieval of the
+// game's servers.
+func recordRetrieval(game string, took time.Duration, sl *models.APIServerList,
+	err error) {
+	retrievalDuration.Observe(took.Seconds(), game)
+	retrievals.Inc(game, resultLabel(err))
+	if err != nil {
+		return
+	}
+	retrievalServers.Set(float64(sl.ServerCount), game, "success")
+	retrievalServers.Set(float64(sl.FailedCount), game, "failure")
+}
+
+// recordQuery records the outcome of an A2S query that took the number of
+// attempts.
+func recordQuery(qtype string, attempts int, err error) {
+	queries.Inc(qtype, resultLabel(err))
+	if attempts > 1 {
+		queryRetries.Add(float64(attempts-1), qtype)
+	}
+}
@@ -0,0 +1,104 @@
+package steam
+
+// retry.go - policy for re-trying failed A2S queries
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+)
+
+// RetryPolicy determines how many times a failed A2S query is re-tried, the
+// timeout of each attempt, and the backoff between attempts. Both the timeout and
+// the backoff grow exponentially with each attempt.
+type RetryPolicy struct {
+	MaxAttempts       int
+	InitialTimeout    time.Duration
+	MaxTimeout        time.Duration
+	TimeoutMultiplier float64
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	Jitter            float64
+}
+
+// NewRetryPolicy creates a retry policy from its configuration.
+func NewRetryPolicy(cfg config.CfgRetry) RetryPolicy {
+	if cfg.MaxAttempts <= 0 {
+		// older configuration files
+		cfg = config.NewDefaultRetry()
+	}
+	return RetryPolicy{
+		MaxAttempts:       cfg.MaxAttempts,
+		InitialTimeout:    time.Duration(cfg.InitialTimeout) * time.Millisecond,
+		MaxTimeout:        time.Duration(cfg.MaxTimeout) * time.Millisecond,
+		TimeoutMultiplier: cfg.TimeoutMultiplier,
+		InitialBackoff:    time.Duration(cfg.InitialBackoff) * time.Millisecond,
+		MaxBackoff:        time.Duration(cfg.MaxBackoff) * time.Millisecond,
+		BackoffMultiplier: cfg.BackoffMultiplier,
+		Jitter:            cfg.Jitter,
+	}
+}
+
+// getRetryPolicy returns the configured retry policy.
+func getRetryPolicy() RetryPolicy {
+	if config.Config == nil {
+		return NewRetryPolicy(config.NewDefaultRetry())
+	}
+	return NewRetryPolicy(config.Config.SteamConfig.Retry)
+}
+
+func grow(initial, max time.Duration, multiplier float64, attempt int) time.Duration {
+	d := time.Duration(float64(initial) * math.Pow(multiplier, float64(attempt)))
+	if max > 0 && (d > max || d < 0) {
+		return max
+	}
+	return d
+}
+
+// Timeout returns the timeout of the attempt, starting at zero.
+func (p RetryPolicy) Timeout(attempt int) time.Duration {
+	return grow(p.InitialTimeout, p.MaxTimeout, p.TimeoutMultiplier, attempt)
+}
+
+// Backoff returns the time to wait after the failed attempt, starting at zero,
+// before making the next attempt.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := grow(p.InitialBackoff, p.MaxBackoff, p.BackoffMultiplier, attempt)
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// ShouldRetry determines whether a query that failed with the error should be
+// re-tried. Replies that are malformed or empty will not change on another
+// attempt.
+func (p RetryPolicy) ShouldRetry(err error) bool {
+	switch GetErrorClass(err) {
+	case ErrClassMalformed, ErrClassEmpty:
+		return false
+	}
+	return true
+}
+
+// Do calls query until it succeeds, fails with an error that should not be
+// re-tried, or the policy's attempts are exhausted. query is passed the timeout
+// of the attempt. Returns the number of attempts made and the last error.
+func (p RetryPolicy) Do(query func(timeout time.Duration) error) (int, error) {
+	var err error
+	attempt := 0
+	for attempt < p.MaxAttempts {
+		err = query(p.Timeout(attempt))
+		attempt++
+		if err == nil || !p.ShouldRetry(err) {
+			break
+		}
+		if attempt < p.MaxAttempts {
+			time.Sleep(p.Backoff(attempt - 1))
+		}
+	}
+	return attempt, err
+}
@@ -0,0 +1,84 @@
+package steam
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:       3,
+	InitialTimeout:    500 * time.Millisecond,
+	MaxTimeout:        2 * time.Second,
+	TimeoutMultiplier: 2,
+	InitialBackoff:    10 * time.Millisecond,
+	MaxBackoff:        30 * time.Millisecond,
+	BackoffMultiplier: 2,
+	Jitter:            0.5,
+}
+
+func TestRetryPolicyTimeout(t *testing.T) {
+	expected := []time.Duration{500 * time.Millisecond, time.Second,
+		2 * time.Second, 2 * time.Second}
+	for i, e := range expected {
+		if testRetryPolicy.Timeout(i) != e {
+			t.Fatalf("Expected timeout of attempt %d to be %s, got: %s", i, e,
+				testRetryPolicy.Timeout(i))
+		}
+	}
+	for i, e := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond,
+		30 * time.Millisecond} {
+		b := testRetryPolicy.Backoff(i)
+		if b < e/2 || b > e+e/2 {
+			t.Fatalf("Expected backoff of attempt %d to be %s +/- 50%%, got: %s",
+				i, e, b)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	if !testRetryPolicy.ShouldRetry(ErrDataTransmit("timeout")) {
+		t.Fatalf("Expected data transmission errors to be re-tried")
+	}
+	if !testRetryPolicy.ShouldRetry(ErrMultiPacketIDMismatch) {
+		t.Fatalf("Expected multi-packet ID mismatches to be re-tried")
+	}
+	if testRetryPolicy.ShouldRetry(ErrPacketHeader) {
+		t.Fatalf("Expected packet header errors not to be re-tried")
+	}
+	if testRetryPolicy.ShouldRetry(ErrNoRules) {
+		t.Fatalf("Expected empty replies not to be re-tried")
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	var timeouts []time.Duration
+	attempts, err := testRetryPolicy.Do(func(timeout time.Duration) error {
+		timeouts = append(timeouts, timeout)
+		return ErrDataTransmit("timeout")
+	})
+	if attempts != 3 || err == nil {
+		t.Fatalf("Expected 3 failed attempts, got: %d, %v", attempts, err)
+	}
+	if timeouts[2] != 2*time.Second {
+		t.Fatalf("Expected timeout of third attempt to be 2s, got: %s", timeouts[2])
+	}
+	attempts, err = testRetryPolicy.Do(func(timeout time.Duration) error {
+		return ErrPacketHeader
+	})
+	if attempts != 1 || err != ErrPacketHeader {
+		t.Fatalf("Expected 1 attempt with packet header error, got: %d, %v",
+			attempts, err)
+	}
+	calls := 0
+	attempts, err = testRetryPolicy.Do(func(timeout time.Duration) error {
+		calls++
+		if calls < 2 {
+			return errors.New("lost packet")
+		}
+		return nil
+	})
+	if attempts != 2 || err != nil {
+		t.Fatalf("Expected success on attempt 2, got: %d, %v", attempts, err)
+	}
+}
@@ -0,0 +1,170 @@
+package steam
+
+// session.go - per-host query sessions that retrieve a server's info, players
+// and rules over one connection and stream the results as hosts complete
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+	"github.com/syncore/a2sapi/src/steam/filters"
+)
+
+// hostResult represents the outcome of a host's query session.
+type hostResult struct {
+	Host    string
+	Game    filters.Game
+	Info    models.SteamServerInfo
+	Players []models.SteamPlayerInfo
+	Rules   map[string]string
+	InfoOK  bool
+	PlyrOK  bool
+	RulesOK bool
+	// total number of attempts made for all of the host's requests
+	Attempts int
+	// round-trip times of the requests that were answered
+	RTTs []time.Duration
+}
+
+// success determines whether every A2S query that the host's game supports was
+// successful.
+func (r hostResult) success() bool {
+	return (r.InfoOK || r.Game.IgnoreInfo) && (r.PlyrOK || r.Game.IgnorePlayers) &&
+		(r.RulesOK || r.Game.IgnoreRules)
+}
+
+// session represents a single host's query session. The challenge number that
+// the server sends in reply to the first request is re-used for the rest of the
+// session's requests.
+type session struct {
+	conn      net.Conn
+	policy    RetryPolicy
+	challenge []byte
+	attempts  int
+	log       *logger.Logger
+}
+
+// request sends the A2S request of the query type, re-trying it on failure
+// according to the session's retry policy.
+func (s *session) request(qtype string, request []byte,
+	needsChallenge bool) ([]byte, error) {
+	challenge := s.challenge
+	if challenge == nil && needsChallenge {
+		challenge = emptyChallenge
+	}
+	var reply []byte
+	n, err := s.policy.Do(func(timeout time.Duration) error {
+		var qerr error
+		start := time.Now()
+		s.conn.SetDeadline(start.Add(timeout))
+		reply, challenge, qerr = challengeRequest(s.conn, request, challenge)
+		if qerr == nil {
+			queryDuration.Observe(time.Since(start).Seconds(), qtype)
+		}
+		return qerr
+	})
+	s.attempts += n
+	recordQuery(qtype, n, err)
+	if err != nil {
+		s.log.WithFields(logger.Fields{logger.FieldQueryType: qtype,
+			logger.FieldErrorClass: GetErrorClass(err), "attempts": n}).Warn(
+			"Query failed: %s", err)
+	}
+	if challenge != nil && !bytes.Equal(challenge, emptyChallenge) {
+		s.challenge = challenge
+	}
+	return reply, err
+}
+
+// querySession retrieves the info, players and rules that the game supports for
+// the host in one session. If detectGame is set, the game is determined from the
+// server's A2S_INFO reply instead. The session ends early if a request still
+// fails after being re-tried, since the host is then most likely unreachable.
+func querySession(host string, game filters.Game, detectGame bool,
+	policy RetryPolicy) (r hostResult) {
+	r = hostResult{Host: host, Game: game}
+	log := logger.Steam.With(logger.FieldHost, host)
+	if !detectGame {
+		log = log.With(logger.FieldGame, game.Name)
+	}
+	conn, err := dialHost(host)
+	if err != nil {
+		log.With(logger.FieldErrorClass, ErrClassConnection).Error(
+			ErrHostConnection(err.Error()).Error())
+		return r
+	}
+	defer conn.Close()
+	rc := &rttConn{Conn: conn}
+	s := &session{conn: rc, policy: policy, log: log}
+	defer func() {
+		r.Attempts = s.attempts
+		r.RTTs = rc.rtts
+		logger.WriteDebug("%s: %d attempt(s) for all requests", host, s.attempts)
+	}()
+
+	if !game.IgnoreInfo || detectGame {
+		// servers that have been updated since Valve's late 2020 change reply
+		// with the challenge number that is then used for players and rules
+		si, err := s.request(queryTypeInfo, infoChallengeReq, false)
+		if err != nil {
+			return r
+		}
+		info, err := parseServerInfo(si)
+		r.Info, r.InfoOK = info, err == nil || err == ErrNoInfo
+	}
+	if detectGame {
+		if !r.InfoOK {
+			logger.WriteDebug("A2S_INFO failed for %s. game will be unspecified", host)
+			r.Game = filters.GameUnspecified
+			return r
+		}
+		r.Game = filters.GetGameByAppID(r.Info.ExtraData.GameID)
+		s.log = s.log.With(logger.FieldGame, r.Game.Name)
+		logger.WriteDebug("direct query for %s. got gameid: %d, game: %s", host,
+			r.Info.ExtraData.GameID, r.Game.Name)
+	}
+	if !r.Game.IgnorePlayers {
+		pi, err := s.request(queryTypePlayers, playerChallengeReq, true)
+		if err != nil {
+			return r
+		}
+		players, err := parsePlayerInfo(pi)
+		// server could just be empty
+		r.Players, r.PlyrOK = players, err == nil || err == ErrNoPlayers
+	}
+	if !r.Game.IgnoreRules {
+		ri, err := s.request(queryTypeRules, rulesChallengeReq, true)
+		if err != nil {
+			return r
+		}
+		rules, err := parseRuleInfo(ri)
+		// server might have no rules
+		r.Rules, r.RulesOK = rules, err == nil || err == ErrNoRules
+	}
+	return r
+}
+
+// queryHosts starts a query session for each of the hosts and streams each
+// host's result as soon as its session completes. The channel is closed once
+// every host has been queried.
+func queryHosts(hostsgames map[string]filters.Game, detectGame bool) <-chan hostResult {
+	results := make(chan hostResult, len(hostsgames))
+	policy := getRetryPolicy()
+	var wg sync.WaitGroup
+	wg.Add(len(hostsgames))
+	for host, game := range hostsgames {
+		go func(h string, g filters.Game) {
+			defer wg.Done()
+			results <- querySession(h, g, detectGame, policy)
+		}(host, game)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
@@ -0,0 +1,99 @@
+package steam
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syncore/a2sapi/src/steam/filters"
+)
+
+func TestQuerySession(t *testing.T) {
+	stub := newA2SStub(t, true)
+	defer stub.close()
+	r := querySession(stub.addr(), filters.GameQuakeLive, false, testRetryPolicy)
+	if !r.success() {
+		t.Fatalf("Expected session to succeed, got: %+v", r)
+	}
+	if r.Info.Map != "campgrounds" {
+		t.Fatalf("Expected map to be campgrounds, got: %s", r.Info.Map)
+	}
+	if len(r.Players) != 1 {
+		t.Fatalf("Expected 1 player, got: %d", len(r.Players))
+	}
+	if r.Rules["g_gametype"] != "4" {
+		t.Fatalf("Expected g_gametype to be 4, got: %s", r.Rules["g_gametype"])
+	}
+	// challenge received for A2S_INFO is re-used: info, info w/ challenge,
+	// players, rules
+	if stub.requestCount() != 4 {
+		t.Fatalf("Expected 4 requests in the session, got: %d", stub.requestCount())
+	}
+	if r.Attempts != 3 {
+		t.Fatalf("Expected 3 attempts for 3 requests, got: %d", r.Attempts)
+	}
+	if len(r.RTTs) != 4 {
+		t.Fatalf("Expected a round-trip time for each of the 4 requests, got: %d",
+			len(r.RTTs))
+	}
+}
+
+func TestQuerySessionRetry(t *testing.T) {
+	stub := newA2SStub(t, false)
+	defer stub.close()
+	// the first A2S_INFO request is lost
+	atomic.StoreInt32(&stub.drop, 1)
+	policy := RetryPolicy{MaxAttempts: 2, InitialTimeout: 200 * time.Millisecond,
+		TimeoutMultiplier: 1}
+	r := querySession(stub.addr(), filters.GameQuakeLive, false, policy)
+	if !r.success() {
+		t.Fatalf("Expected session to succeed after a retry, got: %+v", r)
+	}
+	// info twice, then players and rules once each
+	if r.Attempts != 4 {
+		t.Fatalf("Expected 4 attempts, got: %d", r.Attempts)
+	}
+	// nothing listening: the session ends once A2S_INFO has used every attempt
+	r = querySession("127.0.0.1:1", filters.GameQuakeLive, false, policy)
+	if r.success() || r.InfoOK {
+		t.Fatalf("Expected session to fail, got: %+v", r)
+	}
+	if r.Attempts != 2 {
+		t.Fatalf("Expected 2 attempts, got: %d", r.Attempts)
+	}
+}
+
+func TestQuerySessionIgnored(t *testing.T) {
+	stub := newA2SStub(t, false)
+	defer stub.close()
+	game := filters.NewGame("NoRules", 1, true, false, false)
+	r := querySession(stub.addr(), game, false, testRetryPolicy)
+	if !r.success() {
+		t.Fatalf("Expected session to succeed, got: %+v", r)
+	}
+	if r.RulesOK {
+		t.Fatalf("Expected rules not to be requested")
+	}
+	// info, players w/o challenge, players w/ challenge
+	if stub.requestCount() != 3 {
+		t.Fatalf("Expected 3 requests in the session, got: %d", stub.requestCount())
+	}
+}
+
+func TestQueryHosts(t *testing.T) {
+	stubs := []*a2sStub{newA2SStub(t, true), newA2SStub(t, false)}
+	hg := make(map[string]filters.Game, len(stubs)+1)
+	for _, s := range stubs {
+		defer s.close()
+		hg[s.addr()] = filters.GameQuakeLive
+	}
+	// nothing listening
+	hg["127.0.0.1:1"] = filters.GameQuakeLive
+	sl := buildList(queryHosts(hg, false))
+	if sl.ServerCount != 2 {
+		t.Fatalf("Expected 2 servers, got: %d", sl.ServerCount)
+	}
+	if sl.FailedCount != 1 || sl.FailedServers[0] != "127.0.0.1:1" {
+		t.Fatalf("Expected 127.0.0.1:1 to fail, got: %v", sl.FailedServers)
+	}
+}
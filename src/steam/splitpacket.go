@@ -0,0 +1,246 @@
+package steam
+
+// splitpacket.go - reassembly of split (multi-packet) responses for all A2S
+// queries
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/syncore/a2sapi/src/logger"
+)
+
+// splitFormat represents the header format of a server's split packets.
+type splitFormat int
+
+const (
+	// Source engine, Orange Box and newer (includes the size field)
+	splitSource splitFormat = iota
+	// Source engine without the size field (appids 215, 17550, 17700 and 240
+	// with protocol 7)
+	splitSourceNoSize
+	// GoldSrc (Half-Life 1) engine
+	splitGoldSrc
+)
+
+const (
+	// maxSplitPackets is the maximum number of packets in a split response.
+	maxSplitPackets = 255
+	// compressedSplitFlag is set in the ID of a bzip2 compressed Source response.
+	compressedSplitFlag = 0x80000000
+	// maxDecompressedSize is the maximum size of a decompressed response; real
+	// A2S responses are much smaller.
+	maxDecompressedSize = 1 << 20
+)
+
+// bzip2 stream signature
+var bzip2Signature = []byte("BZh")
+
+// splitResponse represents a split (multi-packet) response that is being
+// reassembled.
+type splitResponse struct {
+	format     splitFormat
+	id         int32
+	total      int
+	compressed bool
+	packets    map[int][]byte
+}
+
+// detectSplitFormat determines the header format of a split response from its
+// first packet (packet #0), whose payload always begins with the single packet
+// response header or, for compressed responses, with the size and CRC32 sum of
+// the decompressed data followed by the bzip2 stream. Returns false if the
+// packet is not the first packet of a split response.
+func detectSplitFormat(p []byte) (splitFormat, bool) {
+	header := []byte(headerStr)
+	if len(p) < 10 {
+		return 0, false
+	}
+	compressed := binary.LittleEndian.Uint32(p[4:8])&compressedSplitFlag != 0
+	switch {
+	// GoldSrc: packet # in upper 4 bits of byte 8, payload starts at byte 9
+	case len(p) >= 13 && p[8]>>4 == 0 && bytes.Equal(p[9:13], header):
+		return splitGoldSrc, true
+	case p[9] != 0:
+		return 0, false
+	case len(p) >= 16 && bytes.Equal(p[12:16], header):
+		return splitSource, true
+	case len(p) >= 14 && bytes.Equal(p[10:14], header):
+		return splitSourceNoSize, true
+	case compressed && len(p) >= 23 && bytes.Equal(p[20:23], bzip2Signature):
+		return splitSource, true
+	case compressed && len(p) >= 21 && bytes.Equal(p[18:21], bzip2Signature):
+		return splitSourceNoSize, true
+	}
+	return 0, false
+}
+
+// parseSplitHeader parses the header of a split packet p that uses the header
+// format f, returning the response ID, the total number of packets, the packet
+// number and the packet's payload.
+func parseSplitHeader(f splitFormat, p []byte) (id int32, total, number int,
+	payload []byte, err error) {
+	// Source header:
+	// header: 4 bytes, 0xFFFFFFFE
+	// ID: 4 bytes, signed; most significant bit is set if compressed w/ bzip2
+	// total # of packets: 1 byte, unsigned
+	// current packet #, starts at zero: 1 byte, unsigned
+	// size: 2 bytes, only for Orange Box Engine and Newer, signed
+	// GoldSrc header:
+	// header: 4 bytes, 0xFFFFFFFE
+	// ID: 4 bytes, signed
+	// packet #: upper 4 bits, total # of packets: lower 4 bits of 1 byte
+	headerlen := map[splitFormat]int{splitSource: 12, splitSourceNoSize: 10,
+		splitGoldSrc: 9}[f]
+	if len(p) < headerlen || !bytes.HasPrefix(p, multiPacketRespHeader) {
+		return 0, 0, 0, nil, ErrMultiPacketHeader
+	}
+	id = int32(binary.LittleEndian.Uint32(p[4:8]))
+	if f == splitGoldSrc {
+		total, number = int(p[8]&0x0F), int(p[8]>>4)
+	} else {
+		total, number = int(p[8]), int(p[9])
+	}
+	payload = make([]byte, len(p)-headerlen)
+	copy(payload, p[headerlen:])
+	return id, total, number, payload, nil
+}
+
+func newSplitResponse(f splitFormat, first []byte) (*splitResponse, error) {
+	id, total, _, _, err := parseSplitHeader(f, first)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, ErrMultiPacketHeader
+	}
+	return &splitResponse{
+		format:     f,
+		id:         id,
+		total:      total,
+		compressed: f != splitGoldSrc && uint32(id)&compressedSplitFlag != 0,
+		packets:    make(map[int][]byte, total),
+	}, nil
+}
+
+// add adds the split packet p to the response.
+func (sr *splitResponse) add(p []byte) error {
+	id, _, number, payload, err := parseSplitHeader(sr.format, p)
+	if err != nil {
+		return err
+	}
+	if id != sr.id {
+		return ErrMultiPacketIDMismatch
+	}
+	if number >= sr.total {
+		return ErrMultiPacketNumExceeded
+	}
+	if _, ok := sr.packets[number]; ok {
+		return ErrMultiPacketDuplicate
+	}
+	sr.packets[number] = payload
+	return nil
+}
+
+func (sr *splitResponse) complete() bool {
+	return len(sr.packets) == sr.total
+}
+
+// payload returns the payloads of all of the response's packets in order,
+// decompressing and verifying them if the response is compressed.
+func (sr *splitResponse) payload() ([]byte, error) {
+	var data []byte
+	for i := 0; i < sr.total; i++ {
+		data = append(data, sr.packets[i]...)
+	}
+	if !sr.compressed {
+		return data, nil
+	}
+	// decompressed size: 4 bytes, CRC32 sum: 4 bytes (first packet only)
+	if len(data) < 8 {
+		return nil, ErrMultiPacketDecompress
+	}
+	size := binary.LittleEndian.Uint32(data[0:4])
+	sum := binary.LittleEndian.Uint32(data[4:8])
+	if size > maxDecompressedSize {
+		return nil, ErrMultiPacketDecompress
+	}
+	// never decompress more than the declared size, which a malicious server
+	// could have set far below the size of the decompressed stream
+	decompressed, err := ioutil.ReadAll(io.LimitReader(
+		bzip2.NewReader(bytes.NewReader(data[8:])), int64(size)+1))
+	if err != nil || uint32(len(decompressed)) > size {
+		return nil, ErrMultiPacketDecompress
+	}
+	if uint32(len(decompressed)) != size || crc32.ChecksumIEEE(decompressed) != sum {
+		return nil, ErrMultiPacketChecksum
+	}
+	return decompressed, nil
+}
+
+// Handle multi-packet (split) responses for Source and GoldSrc engine games.
+func handleMultiPacketResponse(c net.Conn, firstReceived []byte) ([]byte,
+	error) {
+	// first 4 bytes [0:4] determine if split; we've already determined that it is.
+	// The header format can only be determined from the first packet (#0), which
+	// might not arrive first, so hold on to any packets received before it.
+	pending := [][]byte{firstReceived}
+	var sr *splitResponse
+	var buf [maxPacketSize]byte
+	for {
+		if sr == nil {
+			for _, p := range pending {
+				if f, ok := detectSplitFormat(p); ok {
+					var err error
+					if sr, err = newSplitResponse(f, p); err != nil {
+						logger.LogSteamError(err)
+						return nil, err
+					}
+					break
+				}
+			}
+			if sr != nil {
+				for _, p := range pending {
+					if err := sr.add(p); err != nil {
+						logger.LogSteamError(err)
+						return nil, err
+					}
+				}
+				pending = nil
+			}
+		}
+		if sr != nil && sr.complete() {
+			break
+		}
+		if len(pending) > maxSplitPackets {
+			logger.LogSteamError(ErrMultiPacketHeader)
+			return nil, ErrMultiPacketHeader
+		}
+		numread, err := c.Read(buf[:maxPacketSize])
+		if err != nil {
+			logger.LogSteamError(ErrMultiPacketTransmit(err.Error()))
+			return nil, ErrMultiPacketTransmit(err.Error())
+		}
+		packet := make([]byte, numread)
+		copy(packet, buf[:numread])
+		if sr == nil {
+			pending = append(pending, packet)
+			continue
+		}
+		if err := sr.add(packet); err != nil {
+			logger.LogSteamError(err)
+			return nil, err
+		}
+	}
+	rules, err := sr.payload()
+	if err != nil {
+		logger.LogSteamError(err)
+		return nil, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,195 @@
+package steam
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"net"
+	"testing"
+)
+
+// testRules is an uncompressed A2S_RULES response with two rules.
+var testRules = []byte("\xFF\xFF\xFF\xFF\x45\x02\x00g_gametype\x004\x00" +
+	"mapname\x00campgrounds\x00")
+
+// testRulesBzip2 is testRules compressed with bzip2.
+var testRulesBzip2 = []byte{
+	0x42, 0x5A, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x0B, 0xB4,
+	0x32, 0x2E, 0x00, 0x00, 0x14, 0x4F, 0x80, 0xD0, 0x00, 0x04, 0x00, 0x02,
+	0x00, 0x00, 0x00, 0xAE, 0x83, 0xDE, 0x20, 0x00, 0x00, 0xA0, 0x00, 0x22,
+	0xB4, 0xC4, 0xD0, 0x1A, 0x30, 0x85, 0x30, 0x9A, 0x68, 0x0D, 0x31, 0x31,
+	0x35, 0x23, 0x64, 0x4A, 0x6D, 0x6B, 0xB5, 0x33, 0xF1, 0x50, 0xB8, 0x42,
+	0xA0, 0x30, 0xF3, 0x7B, 0x69, 0xDA, 0x26, 0x43, 0x9F, 0x17, 0x72, 0x45,
+	0x38, 0x50, 0x90, 0x0B, 0xB4, 0x32, 0x2E}
+
+// splitConn is a net.Conn that returns queued packets from Read.
+type splitConn struct {
+	net.Conn
+	packets [][]byte
+}
+
+func (c *splitConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *splitConn) Read(b []byte) (int, error) {
+	if len(c.packets) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.packets[0])
+	c.packets = c.packets[1:]
+	return n, nil
+}
+
+// splitPackets splits data into total Source (or GoldSrc, if goldsrc is set)
+// split packets with the given ID.
+func splitPackets(data []byte, id uint32, total int, goldsrc bool) [][]byte {
+	var packets [][]byte
+	chunk := (len(data) + total - 1) / total
+	for i := 0; i < total; i++ {
+		end := (i + 1) * chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		p := append([]byte{}, multiPacketRespHeader...)
+		p = append(p, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(p[4:8], id)
+		if goldsrc {
+			p = append(p, byte(i<<4|total))
+		} else {
+			p = append(p, byte(total), byte(i), 0xE0, 0x04)
+		}
+		packets = append(packets, append(p, data[i*chunk:end]...))
+	}
+	return packets
+}
+
+// bzip2Bomb returns 1 GiB of zeros compressed with bzip2 into 785 bytes: the
+// stream header, 23 identical blocks and the last block with the stream trailer.
+func bzip2Bomb() []byte {
+	block, _ := hex.DecodeString(
+		"3141592653590e09e2df015f8e4000c0000008200030804d4642a025a90a8097")
+	last, _ := hex.DecodeString("314159265359487c5fc9008a52c800c00000040008" +
+		"200030cc0529a69122436144890f177245385090f688e402")
+	b := []byte("BZh9")
+	for i := 0; i < 23; i++ {
+		b = append(b, block...)
+	}
+	return append(b, last...)
+}
+
+// compressedPayload returns the payload of a compressed split response: the
+// decompressed size, the CRC32 sum and the bzip2 data.
+func compressedPayload(size int, sum uint32, data []byte) []byte {
+	p := make([]byte, 8)
+	binary.LittleEndian.PutUint32(p[0:4], uint32(size))
+	binary.LittleEndian.PutUint32(p[4:8], sum)
+	return append(p, data...)
+}
+
+func testMultiPacketResponse(packets [][]byte) (map[string]string, error) {
+	c := &splitConn{packets: packets[1:]}
+	data, err := handleMultiPacketResponse(c, packets[0])
+	if err != nil {
+		return nil, err
+	}
+	return parseRuleInfo(data)
+}
+
+func TestHandleMultiPacketResponse(t *testing.T) {
+	// Source, received out of order
+	packets := splitPackets(testRules, 0x1F2, 3, false)
+	packets[0], packets[2] = packets[2], packets[0]
+	rules, err := testMultiPacketResponse(packets)
+	if err != nil {
+		t.Fatalf("Unexpected error with out of order Source packets: %s", err)
+	}
+	if rules["mapname"] != "campgrounds" {
+		t.Fatalf("Expected mapname to be campgrounds, got: %s", rules["mapname"])
+	}
+	// GoldSrc
+	rules, err = testMultiPacketResponse(splitPackets(testRules, 0x1F2, 2, true))
+	if err != nil {
+		t.Fatalf("Unexpected error with GoldSrc packets: %s", err)
+	}
+	if rules["g_gametype"] != "4" {
+		t.Fatalf("Expected g_gametype to be 4, got: %s", rules["g_gametype"])
+	}
+	// Source, bzip2 compressed
+	compressed := compressedPayload(len(testRules), crc32.ChecksumIEEE(testRules),
+		testRulesBzip2)
+	rules, err = testMultiPacketResponse(splitPackets(compressed,
+		compressedSplitFlag|0x1F2, 2, false))
+	if err != nil {
+		t.Fatalf("Unexpected error with compressed packets: %s", err)
+	}
+	if rules["mapname"] != "campgrounds" {
+		t.Fatalf("Expected mapname to be campgrounds, got: %s", rules["mapname"])
+	}
+	// Source, bzip2 compressed with bad checksum
+	compressed = compressedPayload(len(testRules), 0xDEADBEEF, testRulesBzip2)
+	_, err = testMultiPacketResponse(splitPackets(compressed,
+		compressedSplitFlag|0x1F2, 2, false))
+	if err != ErrMultiPacketChecksum {
+		t.Fatalf("Expected checksum error, got: %v", err)
+	}
+	// Source, bzip2 compressed beyond the declared size
+	compressed = compressedPayload(len(testRules), 0, bzip2Bomb())
+	_, err = testMultiPacketResponse(splitPackets(compressed,
+		compressedSplitFlag|0x1F2, 2, false))
+	if err != ErrMultiPacketDecompress {
+		t.Fatalf("Expected decompression error beyond declared size, got: %v", err)
+	}
+	// Source, bzip2 compressed with an unreasonable declared size
+	compressed = compressedPayload(1<<30, 0, bzip2Bomb())
+	_, err = testMultiPacketResponse(splitPackets(compressed,
+		compressedSplitFlag|0x1F2, 2, false))
+	if err != ErrMultiPacketDecompress {
+		t.Fatalf("Expected decompression error for declared size, got: %v", err)
+	}
+	// duplicate packet
+	packets = splitPackets(testRules, 0x1F2, 3, false)
+	packets = append(packets[:2], packets[1])
+	_, err = testMultiPacketResponse(packets)
+	if err != ErrMultiPacketDuplicate {
+		t.Fatalf("Expected duplicate packet error, got: %v", err)
+	}
+	// ID mismatch
+	packets = splitPackets(testRules, 0x1F2, 2, false)
+	packets[1] = splitPackets(testRules, 0x1F3, 2, false)[1]
+	_, err = testMultiPacketResponse(packets)
+	if err != ErrMultiPacketIDMismatch {
+		t.Fatalf("Expected ID mismatch error, got: %v", err)
+	}
+}
+
+func TestSendChallengeRequestSplit(t *testing.T) {
+	// A2S_PLAYER reply with 64 players, split into 3 packets and received after
+	// a challenge
+	players := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x44, 0x40}
+	for i := 0; i < 64; i++ {
+		players = append(players, byte(i))
+		players = append(players, bytes.Repeat([]byte("x"), 30)...)
+		players = append(players, 0x00, 0x05, 0x00, 0x00, 0x00, 0xEC, 0x37,
+			0x92, 0x45)
+	}
+	c := &splitConn{packets: append([][]byte{{0xFF, 0xFF, 0xFF, 0xFF, 0x41,
+		0x4B, 0xA1, 0x31, 0x07}}, splitPackets(players, 0x2A, 3, false)...)}
+	reply, err := sendChallengeRequest(c, playerChallengeReq, emptyChallenge)
+	if err != nil {
+		t.Fatalf("Unexpected error when sending request: %s", err)
+	}
+	if !bytes.Equal(reply, players) {
+		t.Fatalf("Expected reassembled reply of %d bytes, got %d bytes",
+			len(players), len(reply))
+	}
+	parsed, err := parsePlayerInfo(reply)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing players: %s", err)
+	}
+	if len(parsed) != 64 {
+		t.Fatalf("Expected 64 players, got: %d", len(parsed))
+	}
+}
@@ -0,0 +1,49 @@
+package steam
+
+// status.go - status of the last timed retrieval of each game
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+var retrievalStatuses = struct {
+	sync.RWMutex
+	games map[string]models.APIRetrievalStatus
+}{games: make(map[string]models.APIRetrievalStatus)}
+
+// setRetrievalStatus records the outcome of a timed retrieval of the game's
+// servers that started at the specified time.
+func setRetrievalStatus(game string, start time.Time, took time.Duration,
+	sl *models.APIServerList, err error) {
+	retrievalStatuses.Lock()
+	defer retrievalStatuses.Unlock()
+	s := retrievalStatuses.games[game]
+	s.Game = game
+	s.LastRetrievalTimeStamp = start.Unix()
+	s.LastRetrievalDurationSecs = took.Seconds()
+	s.LastRetrievalSucceeded = err == nil
+	if err == nil {
+		s.LastSuccessTimeStamp = start.Unix()
+		s.ServerCount, s.FailedCount = sl.ServerCount, sl.FailedCount
+	}
+	retrievalStatuses.games[game] = s
+}
+
+// GetRetrievalStatuses returns the status of the last timed retrieval of each
+// game that has been retrieved, sorted by game.
+func GetRetrievalStatuses() []models.APIRetrievalStatus {
+	retrievalStatuses.RLock()
+	defer retrievalStatuses.RUnlock()
+	statuses := make([]models.APIRetrievalStatus, 0, len(retrievalStatuses.games))
+	for _, s := range retrievalStatuses.games {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Game < statuses[j].Game
+	})
+	return statuses
+}
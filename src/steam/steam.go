@@ -1,21 +1,34 @@
 package steam
 
+import (
+	"bytes"
+	"net"
+
+	"github.com/syncore/a2sapi/src/logger"
+)
+
 const (
 	headerStr     = "\xFF\xFF\xFF\xFF"
 	maxPacketSize = 1400 // specified by steam protocol
+	// maxChallengeAttempts is the number of times that an A2S request will be
+	// re-sent with a new challenge number if the server keeps replying with one.
+	maxChallengeAttempts = 3
 	// QueryTimeout is the connect, read, and write timeout in seconds. It should
 	// be greater than 1.
 	QueryTimeout = 3
-	// QueryRetryCount is the number of times to re-request rules, players, and info
-	// on failure.
-	QueryRetryCount = 3
 )
 
 var (
 	// Multi-packet response header
 	multiPacketRespHeader = []byte{0xFE, 0xFF, 0xFF, 0xFF}
 
-	// A2S_INFO: challenge request packet
+	// Challenge number that is sent when a challenge number has not been received
+	emptyChallenge = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	// Expected header of a challenge number response (S2C_CHALLENGE)
+	challengeRespHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x41}
+
+	// A2S_INFO: request packet, which must be followed by the challenge number
+	// for servers that reply with a challenge (Valve's late 2020 update)
 	infoChallengeReq = []byte{
 		0xFF, 0xFF, 0xFF, 0xFF,
 		0x54, 0x53, 0x6F, 0x75, 0x72,
@@ -23,22 +36,16 @@ var (
 		0x67, 0x69, 0x6E, 0x65, 0x20,
 		0x51, 0x75, 0x65, 0x72, 0x79,
 		0x00}
-	// A2S_INFO: expected challenge response header
+	// A2S_INFO: expected info response header
 	expectedInfoRespHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x49}
 
-	// A2S_PLAYER: challenge request packet
-	playerChallengeReq = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x55, 0xFF, 0xFF,
-		0xFF, 0xFF}
-	// A2S_PLAYER: expected challenge response header
-	expectedPlayerRespHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x41}
+	// A2S_PLAYER: request packet, which must be followed by the challenge number
+	playerChallengeReq = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x55}
 	// A2S_PLAYER: expected player chunk
 	expectedPlayerChunkHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x44}
 
-	// A2S_RULES: challenge request packet
-	rulesChallengeReq = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x56, 0xFF, 0xFF, 0xFF,
-		0xFF}
-	// A2S_RULES: expected challenge response header
-	expectedRulesRespHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x41}
+	// A2S_RULES: request packet, which must be followed by the challenge number
+	rulesChallengeReq = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x56}
 	// A2S_RULES: expected rule chunk
 	expectedRuleChunkHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x45}
 
@@ -47,12 +54,92 @@ var (
 		0x66, 0x0A}
 )
 
-func removeFailedHost(failed []string, host string) []string {
-	for i, v := range failed {
-		if v == host {
-			failed = append(failed[:i], failed[i+1:]...)
-			break
+// sendChallengeRequest sends the A2S request consisting of the request packet
+// and the challenge number over the connection c and reads the reply. If the
+// server replies with a challenge number instead of the requested data, then the
+// request is re-sent with the received challenge number. It returns the first
+// reply that is not a challenge, reassembling it first if the server split it
+// into multiple packets.
+func sendChallengeRequest(c net.Conn, request []byte, challenge []byte) ([]byte,
+	error) {
+	reply, _, err := challengeRequest(c, request, challenge)
+	return reply, err
+}
+
+// challengeRequest performs the request like sendChallengeRequest, additionally
+// returning the last challenge number that was sent to the server so that it can
+// be re-used for subsequent requests to the same server.
+func challengeRequest(c net.Conn, request []byte, challenge []byte) ([]byte,
+	[]byte, error) {
+	for i := 0; i < maxChallengeAttempts; i++ {
+		req := make([]byte, 0, len(request)+len(challenge))
+		req = append(req, request...)
+		req = append(req, challenge...)
+		_, err := c.Write(req)
+		if err != nil {
+			logger.LogSteamError(ErrDataTransmit(err.Error()))
+			return nil, challenge, ErrDataTransmit(err.Error())
+		}
+
+		reply, err := readReply(c, request)
+		if err != nil {
+			return nil, challenge, err
+		}
+		if !bytes.HasPrefix(reply, challengeRespHeader) {
+			return reply, challenge, nil
+		}
+		// challenge number: 4 bytes following the header
+		if len(reply) < len(challengeRespHeader)+4 {
+			logger.LogSteamError(ErrChallengeResponse)
+			return nil, challenge, ErrChallengeResponse
+		}
+		challenge = reply[len(challengeRespHeader) : len(challengeRespHeader)+4]
+	}
+	logger.LogSteamError(ErrChallengeResponse)
+	return nil, challenge, ErrChallengeResponse
+}
+
+// expectedRespHeader returns the header of the reply to the A2S request, or nil
+// if the request is not an A2S_INFO, A2S_PLAYER or A2S_RULES request.
+func expectedRespHeader(request []byte) []byte {
+	switch {
+	case bytes.HasPrefix(request, infoChallengeReq):
+		return expectedInfoRespHeader
+	case bytes.HasPrefix(request, playerChallengeReq):
+		return expectedPlayerChunkHeader
+	case bytes.HasPrefix(request, rulesChallengeReq):
+		return expectedRuleChunkHeader
+	}
+	return nil
+}
+
+// readReply reads the reply to the request from the connection, reassembling it
+// if the server split it into multiple packets. Replies that are neither a
+// challenge nor of the request's type are late replies to an earlier request
+// (i.e. an attempt that timed out), so they are dropped.
+func readReply(c net.Conn, request []byte) ([]byte, error) {
+	expected := expectedRespHeader(request)
+	var buf [maxPacketSize]byte
+	for {
+		numread, err := c.Read(buf[:maxPacketSize])
+		if err != nil {
+			logger.LogSteamError(ErrDataTransmit(err.Error()))
+			return nil, ErrDataTransmit(err.Error())
+		}
+		reply := make([]byte, numread)
+		copy(reply, buf[:numread])
+
+		if bytes.HasPrefix(reply, multiPacketRespHeader) {
+			// already logged; returned as is to keep its error class
+			reply, err = handleMultiPacketResponse(c, reply)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if expected == nil || bytes.HasPrefix(reply, expected) ||
+			bytes.HasPrefix(reply, challengeRespHeader) {
+			return reply, nil
 		}
+		logger.WriteDebug("Dropping reply to an earlier A2S request")
 	}
-	return failed
 }
@@ -0,0 +1,172 @@
+package steam
+
+// Local UDP stub of a Steam game server that replays the A2S handshakes
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// a2sStub is a local UDP server that replies to A2S_INFO, A2S_PLAYER, and
+// A2S_RULES requests. If requireInfoChallenge is set, it replays the handshake
+// introduced by Valve's late 2020 update, where A2S_INFO requests must contain a
+// challenge number; otherwise A2S_INFO is answered right away.
+type a2sStub struct {
+	conn                 *net.UDPConn
+	challenge            []byte
+	requireInfoChallenge bool
+	info                 []byte
+	players              []byte
+	rules                [][]byte
+	requests             int32
+	// number of requests that are ignored before any are answered
+	drop int32
+	// number of requests, after those that are dropped, whose replies are sent
+	// lateReplyDelay after the request
+	late int32
+}
+
+const lateReplyDelay = 300 * time.Millisecond
+
+func newA2SStub(t *testing.T, requireInfoChallenge bool) *a2sStub {
+	return newA2SStubWithInfo(t, requireInfoChallenge,
+		testInfoResponse("stub server", "campgrounds"))
+}
+
+// newA2SStubWithInfo starts a stub that replies to A2S_INFO with info.
+func newA2SStubWithInfo(t *testing.T, requireInfoChallenge bool,
+	info []byte) *a2sStub {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Unable to start A2S stub: %s", err)
+	}
+	s := &a2sStub{
+		conn:                 conn,
+		challenge:            []byte{0x4B, 0xA1, 0x31, 0x07},
+		requireInfoChallenge: requireInfoChallenge,
+		info:                 info,
+		players: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x44, 0x01, 0x00, 0x73, 0x74,
+			0x75, 0x62, 0x00, 0x05, 0x00, 0x00, 0x00, 0xEC, 0x37, 0x92, 0x45},
+		rules: [][]byte{[]byte("\xFF\xFF\xFF\xFF\x45\x01\x00g_gametype\x004\x00")},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *a2sStub) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// requestCount returns the number of requests received by the stub.
+func (s *a2sStub) requestCount() int32 {
+	return atomic.LoadInt32(&s.requests)
+}
+
+func (s *a2sStub) close() {
+	s.conn.Close()
+}
+
+func (s *a2sStub) reply(addr *net.UDPAddr, packets ...[]byte) {
+	for _, p := range packets {
+		s.conn.WriteToUDP(p, addr)
+	}
+}
+
+func (s *a2sStub) sendChallenge(addr *net.UDPAddr) {
+	s.reply(addr, append(append([]byte{}, challengeRespHeader...), s.challenge...))
+}
+
+func (s *a2sStub) serve() {
+	var buf [maxPacketSize]byte
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf[:])
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.requests, 1)
+		if atomic.AddInt32(&s.drop, -1) >= 0 {
+			continue
+		}
+		req := buf[:n]
+		reply := s.reply
+		if atomic.AddInt32(&s.late, -1) >= 0 {
+			reply = func(addr *net.UDPAddr, packets ...[]byte) {
+				time.AfterFunc(lateReplyDelay, func() { s.reply(addr, packets...) })
+			}
+		}
+		switch {
+		case bytes.HasPrefix(req, infoChallengeReq):
+			if s.requireInfoChallenge &&
+				!bytes.Equal(req[len(infoChallengeReq):], s.challenge) {
+				s.sendChallenge(addr)
+				continue
+			}
+			reply(addr, s.info)
+		case bytes.HasPrefix(req, playerChallengeReq):
+			if !bytes.Equal(req[len(playerChallengeReq):], s.challenge) {
+				s.sendChallenge(addr)
+				continue
+			}
+			reply(addr, s.players)
+		case bytes.HasPrefix(req, rulesChallengeReq):
+			if !bytes.Equal(req[len(rulesChallengeReq):], s.challenge) {
+				s.sendChallenge(addr)
+				continue
+			}
+			reply(addr, s.rules...)
+		}
+	}
+}
+
+// testInfoResponse builds a minimal A2S_INFO response without extra data.
+func testInfoResponse(name, mapname string) []byte {
+	b := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x49, 0x11}
+	for _, str := range []string{name, mapname, "baseq3", "Clan Arena"} {
+		b = append(b, []byte(str)...)
+		b = append(b, 0x00)
+	}
+	// app id, players, max players, bots, type, env, visibility, vac
+	b = append(b, 0x00, 0x00, 0x01, 0x10, 0x00, 'd', 'l', 0x00, 0x01)
+	b = append(b, []byte("1069")...)
+	// version terminator, extra data flag
+	return append(b, 0x00, 0x00)
+}
+
+func TestSendChallengeRequest(t *testing.T) {
+	stub := newA2SStub(t, true)
+	defer stub.close()
+	c, err := net.Dial("udp", stub.addr())
+	if err != nil {
+		t.Fatalf("Unable to connect to A2S stub: %s", err)
+	}
+	defer c.Close()
+	reply, err := sendChallengeRequest(c, playerChallengeReq, emptyChallenge)
+	if err != nil {
+		t.Fatalf("Unexpected error when sending challenge request: %s", err)
+	}
+	if !bytes.HasPrefix(reply, expectedPlayerChunkHeader) {
+		t.Fatalf("Expected player reply after challenge, got: %v", reply)
+	}
+	if stub.requestCount() != 2 {
+		t.Fatalf("Expected 2 requests (challenge + players), got: %d",
+			stub.requestCount())
+	}
+}
+
+func TestChallengeRequestDropsOtherReplies(t *testing.T) {
+	players := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x44, 0x00}
+	// a late A2S_INFO reply, both whole and split, precedes the players reply
+	c := &splitConn{packets: append([][]byte{testInfoResponse("stub", "a")},
+		append(splitPackets(testInfoResponse("stub", "b"), 7, 2, false),
+			players)...)}
+	reply, err := sendChallengeRequest(c, playerChallengeReq, emptyChallenge)
+	if err != nil {
+		t.Fatalf("Unexpected error when requesting players: %s", err)
+	}
+	if !bytes.Equal(reply, players) {
+		t.Fatalf("Expected the players reply, got: %v", reply)
+	}
+}
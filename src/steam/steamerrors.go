@@ -5,20 +5,67 @@ import (
 	"fmt"
 )
 
+// ErrorClass represents the class of an error that occurred during a query, which
+// determines whether the query should be re-tried.
+type ErrorClass int
+
+const (
+	// ErrClassTransient is the class of errors that may not occur again when the
+	// query is re-tried (timeouts, lost or out-of-place packets).
+	ErrClassTransient ErrorClass = iota
+	// ErrClassConnection is the class of errors related to the establishment of
+	// a connection.
+	ErrClassConnection
+	// ErrClassMalformed is the class of errors caused by a reply that the server
+	// will send the same way again.
+	ErrClassMalformed
+	// ErrClassEmpty is the class of errors for valid replies without any data.
+	ErrClassEmpty
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrClassTransient:
+		return "transient"
+	case ErrClassConnection:
+		return "connection"
+	case ErrClassMalformed:
+		return "malformed"
+	case ErrClassEmpty:
+		return "empty"
+	default:
+		return ""
+	}
+}
+
+// QueryError represents an error that occurred during a query along with its
+// class.
+type QueryError struct {
+	Class ErrorClass
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	return e.Msg
+}
+
 // Errors
 var (
 	// ErrHostConnection is an error related to the establishment of a connection.
 	ErrHostConnection = func(msg string) error {
-		return fmt.Errorf("Steam: host connection error: %s", msg)
+		return &QueryError{Class: ErrClassConnection,
+			Msg: fmt.Sprintf("Steam: host connection error: %s", msg)}
 	}
 	// ErrDataTransmit is an error related to sending data to a connection.
 	ErrDataTransmit = func(msg string) error {
-		return fmt.Errorf("Steam: data transmission error: %s", msg)
+		return &QueryError{Class: ErrClassTransient,
+			Msg: fmt.Sprintf("Steam: data transmission error: %s", msg)}
 	}
 	// ErrMultiPacketTransmit is an error related to sending data to a connection
-	//  in the multi-packet context of A2S_RULES.
+	//  in the multi-packet context of A2S_INFO, A2S_PLAYER and A2S_RULES.
 	ErrMultiPacketTransmit = func(msg string) error {
-		return fmt.Errorf("Steam: multi-packet data transmission error: %s", msg)
+		return &QueryError{Class: ErrClassTransient,
+			Msg: fmt.Sprintf("Steam: multi-packet data transmission error: %s", msg)}
 	}
 	// ErrChallengeResponse is an error thrown for an invalid challense response
 	// header.
@@ -28,22 +75,38 @@ var (
 	ErrPacketHeader = errors.New("Steam: invalid packet header")
 
 	// ErrMultiPacketDuplicate is an error thrown when a duplicate packet is
-	// detected int he multi-packet context of A2S_RULES.
+	// detected int he multi-packet context.
 	ErrMultiPacketDuplicate = errors.New(
 		"Steam: multi-packet: duplicate packet detected")
 
-	// ErrMultiPacketIDMismatch is an error thrown in the context of multi-packet
-	// A2S_RULES when the current packet ID does match the packet ID for the batch
-	// of multiple packets currently being processed.
+	// ErrMultiPacketIDMismatch is an error thrown in the multi-packet context
+	// when the current packet ID does match the packet ID for the batch of
+	// multiple packets currently being processed.
 	ErrMultiPacketIDMismatch = errors.New(
 		"Steam: multi-packet error: packet ID mismatch")
 
-	// ErrMultiPacketNumExceeded is an error thrown in the A2S_RULES multi-packet
-	// context when the current packet's number is greater than the total number of
+	// ErrMultiPacketNumExceeded is an error thrown in the multi-packet context
+	// when the current packet's number is greater than the total number of
 	// packets to be parsed within the current batch.
 	ErrMultiPacketNumExceeded = errors.New(
 		"Steam: multi-packet error: packet number greater than total")
 
+	// ErrMultiPacketHeader is an error thrown in the multi-packet context when a
+	// packet's split header is invalid or the header format cannot be determined.
+	ErrMultiPacketHeader = errors.New(
+		"Steam: multi-packet error: invalid split packet header")
+
+	// ErrMultiPacketDecompress is an error thrown in the multi-packet context when
+	// a bzip2 compressed response cannot be decompressed.
+	ErrMultiPacketDecompress = errors.New(
+		"Steam: multi-packet error: unable to decompress bzip2 response")
+
+	// ErrMultiPacketChecksum is an error thrown in the multi-packet context when
+	// the size or CRC32 sum of a decompressed response does not match the size
+	// or sum sent by the server.
+	ErrMultiPacketChecksum = errors.New(
+		"Steam: multi-packet error: decompressed size or CRC32 mismatch")
+
 	// ErrNoPlayers is a generic error thrown when a server is empty.
 	ErrNoPlayers = errors.New("Steam: server contains no players")
 
@@ -55,3 +118,17 @@ var (
 	// given server.
 	ErrNoInfo = errors.New("Steam: no A2S_INFO for server")
 )
+
+// GetErrorClass returns the class of an error that occurred during a query.
+func GetErrorClass(err error) ErrorClass {
+	if qe, ok := err.(*QueryError); ok {
+		return qe.Class
+	}
+	switch err {
+	case ErrPacketHeader, ErrMultiPacketHeader, ErrMultiPacketDecompress:
+		return ErrClassMalformed
+	case ErrNoPlayers, ErrNoRules, ErrNoInfo:
+		return ErrClassEmpty
+	}
+	return ErrClassTransient
+}
@@ -5,8 +5,6 @@ package steam
 import (
 	"bytes"
 	"encoding/binary"
-	"net"
-	"sync"
 	"time"
 
 	"github.com/syncore/a2sapi/src/logger"
@@ -14,30 +12,23 @@ import (
 	"github.com/syncore/a2sapi/src/util"
 )
 
-func getServerInfo(host string, timeout int) ([]byte, error) {
-	conn, err := net.DialTimeout("udp", host, time.Duration(timeout)*time.Second)
+func getServerInfo(host string, timeout time.Duration) ([]byte, error) {
+	conn, err := dialHost(host)
 	if err != nil {
 		logger.LogSteamError(ErrHostConnection(err.Error()))
 		return nil, ErrHostConnection(err.Error())
 	}
 	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(time.Duration(timeout-1) * time.Second))
+	conn.SetDeadline(time.Now().Add(timeout))
 
-	_, err = conn.Write(infoChallengeReq)
+	// servers that have been updated since Valve's late 2020 change reply with a
+	// challenge number that must be appended to the request; older servers
+	// reply with the info right away
+	serverInfo, err := sendChallengeRequest(conn, infoChallengeReq, nil)
 	if err != nil {
-		logger.LogSteamError(ErrDataTransmit(err.Error()))
-		return nil, ErrDataTransmit(err.Error())
+		return nil, err
 	}
 
-	var buf [maxPacketSize]byte
-	numread, err := conn.Read(buf[:maxPacketSize])
-	if err != nil {
-		logger.LogSteamError(ErrDataTransmit(err.Error()))
-		return nil, ErrDataTransmit(err.Error())
-	}
-	serverInfo := make([]byte, numread)
-	copy(serverInfo, buf[:numread])
-
 	if !bytes.HasPrefix(serverInfo, expectedInfoRespHeader) {
 		logger.LogSteamError(ErrPacketHeader)
 		return nil, ErrPacketHeader
@@ -175,42 +166,13 @@ func parseServerInfo(serverinfo []byte) (models.SteamServerInfo, error) {
 	}, nil
 }
 
-// RetryFailedInfoReq retries a failed A2S_INFO request for a specified group of
-// failed hosts for a total of retrycount times, returning a host to A2S_INFO
-// mapping for any hosts that were successfully retried.
-func RetryFailedInfoReq(failed []string,
-	retrycount int) map[string]models.SteamServerInfo {
-	m := make(map[string]models.SteamServerInfo)
-	var f []string
-	var wg sync.WaitGroup
-	var mut sync.Mutex
-	for i := 0; i < retrycount; i++ {
-		if i == 0 {
-			f = failed
-		}
-		wg.Add(len(f))
-		for _, host := range f {
-			go func(h string) {
-				defer wg.Done()
-				r, err := GetInfoForServer(h, QueryTimeout)
-				if err != nil {
-					if err != ErrNoInfo {
-						return
-					}
-				}
-				mut.Lock()
-				m[h] = r
-				f = removeFailedHost(f, h)
-				mut.Unlock()
-			}(host)
-		}
-		wg.Wait()
-	}
-	return m
-}
-
 // GetInfoForServer requests A2S_INFO for a given host within timeout seconds.
 func GetInfoForServer(host string, timeout int) (models.SteamServerInfo, error) {
+	return getInfoForServer(host, time.Duration(timeout-1)*time.Second)
+}
+
+// getInfoForServer requests A2S_INFO for a given host within timeout.
+func getInfoForServer(host string, timeout time.Duration) (models.SteamServerInfo, error) {
 	// Caller will log. Return err instead of wrapped logger.LogSteamError so as not
 	// to interfere with custom error types that need to be analyzed when
 	// determining if retry needs to be done.
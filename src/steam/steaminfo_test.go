@@ -39,3 +39,36 @@ func TestParseServerInfo(t *testing.T) {
 		t.Fatalf("Expected server's game folder to be baseq3, got: %s", sinfo.Folder)
 	}
 }
+
+func TestGetInfoForServer(t *testing.T) {
+	// old handshake: info is sent right away
+	oldstub := newA2SStub(t, false)
+	defer oldstub.close()
+	sinfo, err := GetInfoForServer(oldstub.addr(), 2)
+	if err != nil {
+		t.Fatalf("Unexpected error when getting info (old handshake): %s", err)
+	}
+	if sinfo.Name != "stub server" || sinfo.Map != "campgrounds" {
+		t.Fatalf("Expected stub server on campgrounds, got: %s on %s", sinfo.Name,
+			sinfo.Map)
+	}
+	if oldstub.requestCount() != 1 {
+		t.Fatalf("Expected 1 request for old handshake, got: %d",
+			oldstub.requestCount())
+	}
+	// new handshake: challenge must be appended to the request
+	newstub := newA2SStub(t, true)
+	defer newstub.close()
+	sinfo, err = GetInfoForServer(newstub.addr(), 2)
+	if err != nil {
+		t.Fatalf("Unexpected error when getting info (new handshake): %s", err)
+	}
+	if sinfo.Players != 1 || sinfo.MaxPlayers != 16 {
+		t.Fatalf("Expected 1/16 players, got: %d/%d", sinfo.Players,
+			sinfo.MaxPlayers)
+	}
+	if newstub.requestCount() != 2 {
+		t.Fatalf("Expected 2 requests for new handshake, got: %d",
+			newstub.requestCount())
+	}
+}
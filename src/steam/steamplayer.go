@@ -6,58 +6,28 @@ import (
 	"bytes"
 	"encoding/binary"
 	"math"
-	"net"
-	"sync"
 	"time"
 
 	"github.com/syncore/a2sapi/src/logger"
 	"github.com/syncore/a2sapi/src/models"
 )
 
-func getPlayerInfo(host string, timeout int) ([]byte, error) {
-	conn, err := net.DialTimeout("udp", host, time.Duration(timeout)*time.Second)
+func getPlayerInfo(host string, timeout time.Duration) ([]byte, error) {
+	conn, err := dialHost(host)
 	if err != nil {
 		logger.LogSteamError(ErrHostConnection(err.Error()))
 		return nil, ErrHostConnection(err.Error())
 	}
 
 	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(time.Duration(timeout-1) * time.Second))
+	conn.SetDeadline(time.Now().Add(timeout))
 
-	_, err = conn.Write(playerChallengeReq)
+	// request a challenge number then re-send the request with it; some servers
+	// reply with the players right away
+	pi, err := sendChallengeRequest(conn, playerChallengeReq, emptyChallenge)
 	if err != nil {
-		logger.LogSteamError(ErrDataTransmit(err.Error()))
-		return nil, ErrDataTransmit(err.Error())
-	}
-
-	challengeNumResp := make([]byte, maxPacketSize)
-	_, err = conn.Read(challengeNumResp)
-	if err != nil {
-		logger.LogSteamError(ErrDataTransmit(err.Error()))
-		return nil, ErrDataTransmit(err.Error())
-	}
-	if !bytes.HasPrefix(challengeNumResp, expectedPlayerRespHeader) {
-		logger.LogSteamError(ErrChallengeResponse)
-		return nil, ErrChallengeResponse
-	}
-	challengeNum := bytes.TrimLeft(challengeNumResp, headerStr)
-	challengeNum = challengeNum[1:5]
-	request := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x55}
-	request = append(request, challengeNum...)
-
-	_, err = conn.Write(request)
-	if err != nil {
-		logger.LogSteamError(ErrDataTransmit(err.Error()))
-		return nil, ErrDataTransmit(err.Error())
-	}
-	var buf [maxPacketSize]byte
-	numread, err := conn.Read(buf[:maxPacketSize])
-	if err != nil {
-		logger.LogSteamError(ErrDataTransmit(err.Error()))
-		return nil, ErrDataTransmit(err.Error())
+		return nil, err
 	}
-	pi := make([]byte, numread)
-	copy(pi, buf[:numread])
 
 	return pi, nil
 }
@@ -111,43 +81,13 @@ func getDuration(bytes []byte) (float32, string) {
 	return f, s.String()
 }
 
-// RetryFailedPlayersReq retries a failed A2S_PLAYER request for a specified group of
-// failed hosts for a total of retrycount times, returning a host to A2S_PLAYER
-// mapping for any hosts that were successfully retried.
-func RetryFailedPlayersReq(failed []string,
-	retrycount int) map[string][]models.SteamPlayerInfo {
-
-	m := make(map[string][]models.SteamPlayerInfo)
-	var f []string
-	var wg sync.WaitGroup
-	var mut sync.Mutex
-	for i := 0; i < retrycount; i++ {
-		if i == 0 {
-			f = failed
-		}
-		wg.Add(len(f))
-		for _, host := range f {
-			go func(h string) {
-				defer wg.Done()
-				r, err := GetPlayersForServer(h, QueryTimeout)
-				if err != nil {
-					if err != ErrNoPlayers {
-						return
-					}
-				}
-				mut.Lock()
-				m[h] = r
-				f = removeFailedHost(f, h)
-				mut.Unlock()
-			}(host)
-		}
-		wg.Wait()
-	}
-	return m
-}
-
 // GetPlayersForServer requests A2S_PLAYER info for a given host within timeout seconds.
 func GetPlayersForServer(host string, timeout int) ([]models.SteamPlayerInfo, error) {
+	return getPlayersForServer(host, time.Duration(timeout-1)*time.Second)
+}
+
+// getPlayersForServer requests A2S_PLAYER for a given host within timeout.
+func getPlayersForServer(host string, timeout time.Duration) ([]models.SteamPlayerInfo, error) {
 	// Caller will log. Return err instead of wrapped logger.LogSteamError so as not
 	// to interfere with custom error types that need to be analyzed when
 	// determining if retry needs to be done.
@@ -63,3 +63,15 @@ func TestGetDuration(t *testing.T) {
 		t.Fatalf("Expected duration string to be 2m3s, got: %s", durstring)
 	}
 }
+
+func TestGetPlayersForServer(t *testing.T) {
+	stub := newA2SStub(t, true)
+	defer stub.close()
+	players, err := GetPlayersForServer(stub.addr(), 2)
+	if err != nil {
+		t.Fatalf("Unexpected error when getting players: %s", err)
+	}
+	if len(players) != 1 || players[0].Name != "stub" {
+		t.Fatalf("Expected 1 player named stub, got: %v", players)
+	}
+}
@@ -104,3 +104,15 @@ func TestParseRuleInfo(t *testing.T) {
 	}
 
 }
+
+func TestGetRulesForServer(t *testing.T) {
+	stub := newA2SStub(t, true)
+	defer stub.close()
+	rules, err := GetRulesForServer(stub.addr(), 2)
+	if err != nil {
+		t.Fatalf("Unexpected error when getting rules: %s", err)
+	}
+	if rules["g_gametype"] != "4" {
+		t.Fatalf("Expected g_gametype to be 4, got: %s", rules["g_gametype"])
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/syncore/a2sapi/src/config"
 	"github.com/syncore/a2sapi/src/constants"
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/events"
 	"github.com/syncore/a2sapi/src/logger"
 	"github.com/syncore/a2sapi/src/models"
 	"github.com/syncore/a2sapi/src/steam/filters"
@@ -25,40 +27,22 @@ func retrieve(filter filters.Filter) (*models.APIServerList, error) {
 	}
 
 	if err != nil {
-		return nil, logger.LogSteamErrorf("Master server error: %s", err)
+		return nil, logger.Steam.With(logger.FieldGame, filter.Game.Name).Error(
+			"Master server error: %s", err)
 	}
 
 	if filter.Game.IgnoreInfo && filter.Game.IgnorePlayers && filter.Game.IgnoreRules {
 		return nil, logger.LogAppErrorf("Cannot ignore all three AS2 requests!")
 	}
 
-	data := a2sData{}
 	hg := make(map[string]filters.Game, len(mq.Servers))
 	for _, h := range mq.Servers {
 		hg[h] = filter.Game
 	}
-	data.HostsGames = hg
-
-	// Order of retrieval is by amount of work that must be done (generally 1, 2, 3)
-	// 1. rules (request chal #, recv chal #, req rules, recv rules)
-	// games with multi-packet A2S_RULES replies do the most work; otherwise 1 = 2, 3
-	// 2. players (request chal #, recv chal #, req players, recv players)
-	// 3. info: just request info & receive info
+	// Each host's info, players and rules are retrieved in a single session
+	// (one challenge number) and added to the list as soon as the host is done.
 	// Note: some servers (i.e. new beta games) don't have all 3 of AS2_RULES/PLAYER/INFO
-	if !filter.Game.IgnoreRules {
-		data.Rules = batchRuleQuery(mq.Servers)
-	}
-	if !filter.Game.IgnorePlayers {
-		data.Players = batchPlayerQuery(mq.Servers)
-	}
-	if !filter.Game.IgnoreInfo {
-		data.Info = batchInfoQuery(mq.Servers)
-	}
-
-	serverlist, err := buildServerList(data, true)
-	if err != nil {
-		return nil, logger.LogAppError(err)
-	}
+	serverlist := buildList(queryHosts(hg, false))
 
 	if config.Config.DebugConfig.EnableServerDump {
 		if err := dumpServersToDisk(filter.Game.Name, serverlist); err != nil {
@@ -90,10 +74,103 @@ func dumpServersToDisk(gamename string, sl *models.APIServerList) error {
 	return nil
 }
 
+// retrieveAndStore retrieves the servers specified by the filter and stores them
+// as the master list for the filter's game.
+func retrieveAndStore(filter filters.Filter) {
+	start := time.Now()
+	sl, err := retrieve(filter)
+	took := time.Since(start)
+	recordRetrieval(filter.Game.Name, took, sl, err)
+	setRetrievalStatus(filter.Game.Name, start, took, sl, err)
+	storeMasterList(filter.Game.Name, sl, err)
+}
+
+// storeMasterList stores the game's newly retrieved master list and publishes
+// the changes from the game's previous list as events. If the retrieval failed,
+// then the game's last good list is kept.
+func storeMasterList(game string, sl *models.APIServerList, err error) {
+	if err != nil {
+		logger.LogAppErrorf(
+			"Error when performing timed master retrieval; keeping last %s list: %s",
+			game, err)
+		return
+	}
+	recordReliability(game, sl)
+	if prev, gen, ok := models.MasterLists.Swap(game, sl); ok {
+		logger.WriteDebug("Stored %s master list as generation %d", game, gen)
+		events.Stream.Publish(events.Diff(game, prev, sl))
+		events.NotifyListListeners(game, prev, sl)
+		models.PlayerIndex.Rebuild(models.MasterLists.Get(nil), time.Now())
+		go db.ServerDB.SaveSnapshot(game, sl)
+		if config.Config.HistoryConfig.EnableHistory {
+			go recordHistory(sl)
+		}
+	}
+}
+
+// recordReliability records which of the game's servers responded to the
+// retrieval and sets the resulting response history of each server in the list.
+func recordReliability(game string, sl *models.APIServerList) {
+	responded := make(map[int64]float64, len(sl.Servers))
+	ids := make([]int64, 0, len(sl.Servers))
+	for _, s := range sl.Servers {
+		if s.ID != 0 {
+			responded[s.ID] = s.Ping
+			ids = append(ids, s.ID)
+		}
+	}
+	if err := db.ServerDB.RecordResponses(game, sl.RetrievedTimeStamp, responded,
+		sl.FailedServers); err != nil {
+		return
+	}
+	rel, err := db.ServerDB.GetReliability(ids)
+	if err != nil {
+		return
+	}
+	for i := range sl.Servers {
+		sl.Servers[i].Reliability = rel[sl.Servers[i].ID]
+	}
+}
+
+// recordHistory records the history of the list's servers, then downsamples and
+// removes the history that is older than the configured retention periods.
+func recordHistory(sl *models.APIServerList) {
+	cfg := config.Config.HistoryConfig
+	if err := db.HistoryDB.AddHistory(sl.RetrievedTimeStamp, sl.Servers); err != nil {
+		return
+	}
+	now := time.Now()
+	db.HistoryDB.Downsample(
+		now.Add(-time.Duration(cfg.RawRetention)*time.Hour).Unix(),
+		int64(cfg.DownsampleInterval),
+		now.AddDate(0, 0, -cfg.DownsampledRetention).Unix())
+}
+
+// LoadMasterListSnapshot restores the game's master list from its most recent
+// snapshot if the snapshot is no older than maxAge seconds, so that the list can
+// be served before the first timed retrieval completes. Returns true if the list
+// was restored.
+func LoadMasterListSnapshot(game string, maxAge int) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	sl, retrieved, err := db.ServerDB.GetLatestSnapshot(game,
+		time.Duration(maxAge)*time.Second)
+	if err != nil || sl == nil {
+		return false
+	}
+	models.MasterLists.SetAt(game, sl, retrieved)
+	models.PlayerIndex.Rebuild(models.MasterLists.Get(nil), time.Now())
+	logger.LogAppInfo("Restored %s master list from snapshot retrieved at %s",
+		game, retrieved.Format("Mon Jan 2 15:04:05 2006 EST"))
+	return true
+}
+
 // StartMasterRetrieval starts a timed retrieval of servers specified by a given
 // filter from the Steam Master server after an initial delay of initialDelay
-// seconds. It retrieves the list every timeBetweenQueries seconds thereafter.
-// A bool can be sent to the stop channel to cancel all timed retrievals.
+// seconds. It retrieves the list every timeBetweenQueries seconds thereafter and
+// stores it as the master list for the filter's game. Closing the stop channel
+// cancels the timed retrievals of every game that shares the channel.
 func StartMasterRetrieval(stop chan bool, filter filters.Filter,
 	initialDelay int, timeBetweenQueries int) {
 	retrticker := time.NewTicker(time.Duration(timeBetweenQueries) * time.Second)
@@ -108,11 +185,7 @@ func StartMasterRetrieval(stop chan bool, filter filters.Filter,
 	<-firstretrieval.C
 	logger.WriteDebug("Starting first retrieval of %s servers from master.",
 		filter.Game.Name)
-	sl, err := retrieve(filter)
-	if err != nil {
-		logger.LogAppErrorf("Error when performing timed master retrieval: %s", err)
-	}
-	models.MasterList = sl
+	retrieveAndStore(filter)
 
 	for {
 		select {
@@ -122,12 +195,7 @@ func StartMasterRetrieval(stop chan bool, filter filters.Filter,
 					"Mon Jan 2 15:04:05 2006 EST"), filter.Game.Name)
 				logger.LogAppInfo("%s: Starting %s master server query", time.Now().Format(
 					"Mon Jan 2 15:04:05 2006 EST"), filter.Game.Name)
-				sl, err := retrieve(filter)
-				if err != nil {
-					logger.LogAppErrorf("Error when performing timed master retrieval: %s",
-						err)
-				}
-				models.MasterList = sl
+				retrieveAndStore(filter)
 			}(filter)
 		case <-stop:
 			retrticker.Stop()
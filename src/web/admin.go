@@ -0,0 +1,341 @@
+package web
+
+// admin.go - authenticated administrative routes for managing webhooks, server
+// IDs and the log level
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// maximum size of a webhook rule in a request body
+	maxWebhookBodySize = 1 << 16
+	defaultDeadLetters = 100
+)
+
+// writeErrorResponse sets the status code and writes the error message as JSON.
+func writeErrorResponse(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	e := struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	e.Error.Code, e.Error.Message = code, msg
+	writeJSONResponse(w, e)
+}
+
+// requireAPIKey only passes requests that have the configured admin API key in
+// the X-API-Key header (or as a bearer token) to the handler. All requests are
+// refused if no key is configured.
+func requireAPIKey(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		key := config.Config.WebConfig.AdminAPIKey
+		if key == "" {
+			writeErrorResponse(w, http.StatusForbidden,
+				"Administrative routes are disabled.")
+			return
+		}
+		sent := r.Header.Get(apiKeyHeader)
+		if sent == "" {
+			sent = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(key)) != 1 {
+			writeErrorResponse(w, http.StatusUnauthorized, "Invalid API key.")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// decodeWebhookRule reads and validates the webhook rule in the request body.
+// Rules are enabled unless specified otherwise.
+func decodeWebhookRule(r *http.Request) (models.WebhookRule, error) {
+	rule := models.WebhookRule{Enabled: true}
+	d := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxWebhookBodySize))
+	if err := d.Decode(&rule); err != nil {
+		return rule, fmt.Errorf("Invalid webhook rule: %s", err)
+	}
+	u, err := url.Parse(rule.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return rule, fmt.Errorf("The url must be an absolute http or https URL.")
+	}
+	if rule.MinPlayers < 0 {
+		return rule, fmt.Errorf("minPlayers must not be negative.")
+	}
+	if _, err := newWebhookMatcher(rule); err != nil {
+		return rule, fmt.Errorf("Invalid webhook rule: %s", err)
+	}
+	return rule, nil
+}
+
+// getWebhookID returns the webhook ID in the query string, or writes an error
+// response and returns false.
+func getWebhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	vals := getQStringValues(r.URL.Query(), qsWebhookID)
+	if vals != nil {
+		if id, err := strconv.ParseInt(vals[0], 10, 64); err == nil {
+			return id, true
+		}
+	}
+	writeErrorResponse(w, http.StatusBadRequest,
+		fmt.Sprintf("The %s parameter must be a webhook ID.", qsWebhookID))
+	return 0, false
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	rules, err := db.ServerDB.GetWebhooks(false)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to retrieve webhooks.")
+		return
+	}
+	// secrets are only returned when they are created
+	for i := range rules {
+		rules[i].Secret = ""
+	}
+	writeJSONResponse(w, rules)
+}
+
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	rule, err := decodeWebhookRule(r)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if rule.Secret == "" {
+		if rule.Secret, err = newWebhookSecret(); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError,
+				"Unable to create webhook secret.")
+			return
+		}
+	}
+	rule.CreatedAt = time.Now().Unix()
+	if rule.ID, err = db.ServerDB.AddWebhook(rule); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to create webhook.")
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSONResponse(w, rule)
+}
+
+func updateWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	id, ok := getWebhookID(w, r)
+	if !ok {
+		return
+	}
+	rule, err := decodeWebhookRule(r)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rules, err := db.ServerDB.GetWebhooks(false)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to retrieve webhooks.")
+		return
+	}
+	for _, existing := range rules {
+		if existing.ID != id {
+			continue
+		}
+		rule.ID, rule.CreatedAt = id, existing.CreatedAt
+		// the secret is kept unless a new one is specified
+		if rule.Secret == "" {
+			rule.Secret = existing.Secret
+		}
+		if _, err := db.ServerDB.UpdateWebhook(rule); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError,
+				"Unable to update webhook.")
+			return
+		}
+		rule.Secret = ""
+		writeJSONResponse(w, rule)
+		return
+	}
+	writeErrorResponse(w, http.StatusNotFound, "No such webhook.")
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	id, ok := getWebhookID(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := db.ServerDB.DeleteWebhook(id)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to delete webhook.")
+		return
+	}
+	if !deleted {
+		writeErrorResponse(w, http.StatusNotFound, "No such webhook.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	limit := defaultDeadLetters
+	if vals := getQStringValues(r.URL.Query(), qsWebhookLimit); vals != nil {
+		if l, err := strconv.Atoi(vals[0]); err == nil && l > 0 {
+			limit = l
+		}
+	}
+	dls, err := db.ServerDB.GetDeadLetters(limit)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to retrieve failed webhook deliveries.")
+		return
+	}
+	writeJSONResponse(w, dls)
+}
+
+// getServerIDParam returns the server ID in the query string, or writes an error
+// response and returns false.
+func getServerIDParam(w http.ResponseWriter, r *http.Request,
+	qs string) (int64, bool) {
+	vals := getQStringValues(r.URL.Query(), qs)
+	if vals != nil {
+		if id, err := strconv.ParseInt(vals[0], 10, 64); err == nil && id > 0 {
+			return id, true
+		}
+	}
+	writeErrorResponse(w, http.StatusBadRequest,
+		fmt.Sprintf("The %s parameter must be a server ID.", qs))
+	return 0, false
+}
+
+func getStaleServerIDs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	days := config.Config.SteamConfig.ServerIDRetention
+	if vals := getQStringValues(r.URL.Query(), qsStaleServerDays); vals != nil {
+		d, err := strconv.Atoi(vals[0])
+		if err != nil || d < 0 {
+			writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf(
+				"The %s parameter must be a number of days.", qsStaleServerDays))
+			return
+		}
+		days = d
+	}
+	servers, err := db.ServerDB.GetStaleServers(
+		time.Now().AddDate(0, 0, -days).Unix())
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to retrieve stale server IDs.")
+		return
+	}
+	writeJSONResponse(w, struct {
+		Days        int               `json:"days"`
+		ServerCount int               `json:"serverCount"`
+		Servers     []models.DbServer `json:"servers"`
+	}{days, len(servers), servers})
+}
+
+func retireServerIDs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	vals := getQStringValues(r.URL.Query(), qsRetireServerIDs)
+	ids := make([]int64, 0, len(vals))
+	for _, v := range vals {
+		id, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf(
+				"The %s parameter must be a list of server IDs.", qsRetireServerIDs))
+			return
+		}
+		ids = append(ids, id)
+	}
+	retired, err := db.ServerDB.RetireServers(ids)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to retire server IDs.")
+		return
+	}
+	writeJSONResponse(w, struct {
+		Retired int64 `json:"retired"`
+	}{retired})
+}
+
+func mergeServerID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	id, ok := getServerIDParam(w, r, qsMergeServerID)
+	if !ok {
+		return
+	}
+	into, ok := getServerIDParam(w, r, qsMergeServerInto)
+	if !ok {
+		return
+	}
+	if id == into {
+		writeErrorResponse(w, http.StatusBadRequest,
+			"A server ID cannot be merged into itself.")
+		return
+	}
+	if err := db.ServerDB.MergeServer(id, into); err != nil {
+		if err == db.ErrServerNotFound {
+			writeErrorResponse(w, http.StatusNotFound,
+				"Both server IDs must belong to active servers.")
+			return
+		}
+		writeErrorResponse(w, http.StatusInternalServerError,
+			"Unable to merge server IDs.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeLogLevel(w http.ResponseWriter) {
+	writeJSONResponse(w, struct {
+		Level string `json:"level"`
+	}{logger.GetLevel().String()})
+}
+
+func getLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writeLogLevel(w)
+}
+
+func setLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	vals := getQStringValues(r.URL.Query(), qsLogLevel)
+	if vals != nil {
+		if l, err := logger.ParseLevel(vals[0]); err == nil {
+			logger.SetLevel(l)
+			logger.FromRequest(r).Info("Log level set to %s", l)
+			writeLogLevel(w)
+			return
+		}
+	}
+	writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf(
+		"The %s parameter must be debug, info, warn or error.", qsLogLevel))
+}
@@ -0,0 +1,166 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func TestServerIDRoutes(t *testing.T) {
+	srv := httptest.NewServer(newRouter())
+	defer srv.Close()
+	do := func(method, path, key string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error on %s %s: %s", method, path, err)
+		}
+		return resp
+	}
+	key := config.Config.WebConfig.AdminAPIKey
+	hosts := map[string]string{"10.9.3.1:27960": "QuakeLive",
+		"10.9.3.2:27960": "QuakeLive"}
+	db.ServerDB.AddServersToDB(hosts)
+	c := make(chan map[string]int64, 1)
+	db.ServerDB.GetIDsForServerList(c, hosts)
+	ids := <-c
+	from := strconv.FormatInt(ids["10.9.3.1:27960"], 10)
+	into := strconv.FormatInt(ids["10.9.3.2:27960"], 10)
+
+	if resp := do("GET", "/serverIDs/stale", ""); resp.StatusCode !=
+		http.StatusUnauthorized {
+		t.Fatalf("Expected unauthorized without key, got: %d", resp.StatusCode)
+	}
+	resp := do("GET", "/serverIDs/stale?days=0", key)
+	stale := struct {
+		Days    int               `json:"days"`
+		Servers []models.DbServer `json:"servers"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(&stale)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || stale.Days != 0 {
+		t.Fatalf("Expected stale server IDs, got: %d %+v", resp.StatusCode, stale)
+	}
+	if resp := do("GET", "/serverIDs/stale?days=-1", key); resp.StatusCode !=
+		http.StatusBadRequest {
+		t.Fatalf("Expected negative days to be refused, got: %d", resp.StatusCode)
+	}
+	if resp := do("POST", "/serverIDs/merge?id="+from+"&into="+from,
+		key); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected merging into itself to be refused, got: %d",
+			resp.StatusCode)
+	}
+	if resp := do("POST", "/serverIDs/merge?id="+from+"&into="+into,
+		key); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected server ID to be merged, got: %d", resp.StatusCode)
+	}
+	if resp := do("POST", "/serverIDs/merge?id="+from+"&into="+into,
+		key); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected merged server ID to be missing, got: %d", resp.StatusCode)
+	}
+	resp = do("POST", "/serverIDs/retire?ids="+from+","+into, key)
+	retired := struct {
+		Retired int64 `json:"retired"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(&retired)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || retired.Retired != 1 {
+		t.Fatalf("Expected 1 server ID to be retired, got: %d %+v",
+			resp.StatusCode, retired)
+	}
+	if resp := do("POST", "/serverIDs/retire?ids=one", key); resp.StatusCode !=
+		http.StatusBadRequest {
+		t.Fatalf("Expected invalid IDs to be refused, got: %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookRoutesHideSecret(t *testing.T) {
+	srv := httptest.NewServer(newRouter())
+	defer srv.Close()
+	do := func(method, path, body string) models.WebhookRule {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set(apiKeyHeader, config.Config.WebConfig.AdminAPIKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error on %s %s: %s", method, path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("Unexpected status on %s %s: %d", method, path,
+				resp.StatusCode)
+		}
+		if method == "GET" {
+			var rules []models.WebhookRule
+			json.NewDecoder(resp.Body).Decode(&rules)
+			for _, r := range rules {
+				if r.Secret != "" {
+					t.Fatalf("Expected listed webhook without secret, got: %+v", r)
+				}
+			}
+			return models.WebhookRule{}
+		}
+		rule := models.WebhookRule{}
+		json.NewDecoder(resp.Body).Decode(&rule)
+		return rule
+	}
+	created := do("POST", "/webhooks", `{"url": "http://10.0.0.1/hook"}`)
+	defer db.ServerDB.DeleteWebhook(created.ID)
+	if created.Secret == "" {
+		t.Fatalf("Expected created webhook to return its secret")
+	}
+	do("GET", "/webhooks", "")
+	id := strconv.FormatInt(created.ID, 10)
+	if updated := do("PUT", "/webhooks?id="+id,
+		`{"url": "http://10.0.0.2/hook"}`); updated.Secret != "" {
+		t.Fatalf("Expected updated webhook without secret, got: %+v", updated)
+	}
+	rules, _ := db.ServerDB.GetWebhooks(false)
+	for _, r := range rules {
+		if r.ID == created.ID && r.Secret != created.Secret {
+			t.Fatalf("Expected the secret to be kept, got: %s", r.Secret)
+		}
+	}
+}
+
+func TestLogLevelRoutes(t *testing.T) {
+	srv := httptest.NewServer(newRouter())
+	defer srv.Close()
+	defer logger.SetLevel(logger.GetLevel())
+	do := func(method, path string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set(apiKeyHeader, config.Config.WebConfig.AdminAPIKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error on %s %s: %s", method, path, err)
+		}
+		defer resp.Body.Close()
+		l := struct {
+			Level string `json:"level"`
+		}{}
+		json.NewDecoder(resp.Body).Decode(&l)
+		return resp, l.Level
+	}
+	if resp, l := do("PUT", "/logLevel?level=warn"); resp.StatusCode !=
+		http.StatusOK || l != "warn" || logger.GetLevel() != logger.LevelWarn {
+		t.Fatalf("Expected warn level, got: %d %s", resp.StatusCode, l)
+	}
+	if resp, l := do("GET", "/logLevel"); resp.StatusCode != http.StatusOK ||
+		l != "warn" {
+		t.Fatalf("Expected warn level, got: %d %s", resp.StatusCode, l)
+	}
+	if resp, _ := do("PUT", "/logLevel?level=verbose"); resp.StatusCode !=
+		http.StatusBadRequest {
+		t.Fatalf("Expected unknown level to be refused, got: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,580 @@
+package web
+
+// filterexpr.go - expression language for filtering the server list, i.e.:
+// players>=4 && !hasPassword && (map~"campgrounds" || country in [US,CA])
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// FilterError represents an error in a filter expression, at the position (in
+// bytes) of the offending token.
+type FilterError struct {
+	Pos int
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+// filter operators, longest first so that they are lexed greedily
+var filterOps = []string{"&&", "||", "==", "!=", ">=", "<=", "!~", ">", "<", "~",
+	"!"}
+
+func lexFilter(expr string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(expr) {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokRBracket, "]", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(expr) && rune(expr[i]) != c {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				sb.WriteByte(expr[i])
+				i++
+			}
+			if i >= len(expr) {
+				return nil, &FilterError{start, "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(expr) &&
+			unicode.IsDigit(rune(expr[i+1]))):
+			start := i
+			i++
+			for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, expr[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(expr) && (unicode.IsLetter(rune(expr[i])) ||
+				unicode.IsDigit(rune(expr[i])) || strings.IndexByte("_.-:", expr[i]) >= 0) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, expr[start:i], start})
+		default:
+			matched := false
+			for _, op := range filterOps {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &FilterError{i, fmt.Sprintf("unexpected character '%c'", c)}
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(expr)}), nil
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindBool
+)
+
+type filterValue struct {
+	kind valueKind
+	str  string
+	num  float64
+	b    bool
+}
+
+// filterField is a field of an APIServer (or one of its rules) that can be used
+// in a filter expression.
+type filterField struct {
+	name  string
+	kind  valueKind
+	index []int
+	// set for rules, whose values are only known per server
+	rule string
+	// set for fields that are derived from other fields
+	derived func(*models.APIServer) filterValue
+}
+
+// filterAliases are shorter names for common fields and the boolean filters of
+// the /servers endpoint.
+var filterAliases = map[string]string{
+	"players":    "info.players",
+	"maxplayers": "info.maxPlayers",
+	"bots":       "info.bots",
+	"map":        "info.map",
+	"name":       "info.serverName",
+	"gametype":   "info.gameTypeShort",
+	"keywords":   "info.extra.keywords",
+	"country":    "location.countryCode",
+}
+
+var filterDerived = map[string]func(*models.APIServer) filterValue{
+	"hasplayers": func(s *models.APIServer) filterValue {
+		return filterValue{kind: kindBool, b: s.Info.Players > 0}
+	},
+	"hasbots": func(s *models.APIServer) filterValue {
+		return filterValue{kind: kindBool, b: s.Info.Bots > 0}
+	},
+	"haspassword": func(s *models.APIServer) filterValue {
+		return filterValue{kind: kindBool, b: s.Info.Visibility == 1}
+	},
+	"hasanticheat": func(s *models.APIServer) filterValue {
+		return filterValue{kind: kindBool, b: s.Info.VAC == 1}
+	},
+	"isnotfull": func(s *models.APIServer) filterValue {
+		return filterValue{kind: kindBool, b: s.Info.Players != s.Info.MaxPlayers}
+	},
+}
+
+// structs whose fields can be referred to without their prefix, in order of
+// precedence
+var filterImplicitPrefixes = []string{"", "info.", "location.", "info.extra."}
+
+// resolveJSONPath finds the field of t with the dot-separated JSON names.
+func resolveJSONPath(t reflect.Type, path string) (reflect.StructField, []int, bool) {
+	var index []int
+	var field reflect.StructField
+	for _, part := range strings.Split(path, ".") {
+		if t.Kind() != reflect.Struct {
+			return field, nil, false
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if strings.EqualFold(tag, part) {
+				field, t, found = t.Field(i), t.Field(i).Type, true
+				index = append(index, i)
+				break
+			}
+		}
+		if !found {
+			return field, nil, false
+		}
+	}
+	return field, index, true
+}
+
+// lookupFilterField resolves a field name of a filter expression, ignoring case.
+// Fields are named by their JSON names, i.e. info.serverName or serverName.
+func lookupFilterField(name string) (filterField, bool) {
+	lname := strings.ToLower(name)
+	if strings.HasPrefix(lname, "rules.") && len(name) > len("rules.") {
+		return filterField{name: name, kind: kindString, rule: name[len("rules."):]},
+			true
+	}
+	if d, ok := filterDerived[lname]; ok {
+		return filterField{name: name, kind: kindBool, derived: d}, true
+	}
+	if a, ok := filterAliases[lname]; ok {
+		name = a
+	}
+	t := reflect.TypeOf(models.APIServer{})
+	for _, prefix := range filterImplicitPrefixes {
+		f, index, ok := resolveJSONPath(t, prefix+name)
+		if !ok {
+			continue
+		}
+		ff := filterField{name: name, index: index}
+		switch f.Type.Kind() {
+		case reflect.String:
+			ff.kind = kindString
+		case reflect.Bool:
+			ff.kind = kindBool
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64, reflect.Slice, reflect.Map:
+			// slices and maps are compared by their length
+			ff.kind = kindNumber
+		default:
+			return ff, false
+		}
+		return ff, true
+	}
+	return filterField{}, false
+}
+
+// value returns the field's value for the server. Returns false if the server
+// does not have the rule.
+func (f filterField) value(s *models.APIServer) (filterValue, bool) {
+	if f.rule != "" {
+		for k, v := range s.Rules {
+			if strings.EqualFold(k, f.rule) {
+				return filterValue{kind: kindString, str: v}, true
+			}
+		}
+		return filterValue{}, false
+	}
+	if f.derived != nil {
+		return f.derived(s), true
+	}
+	v := reflect.ValueOf(s).Elem().FieldByIndex(f.index)
+	switch v.Kind() {
+	case reflect.String:
+		return filterValue{kind: kindString, str: v.String()}, true
+	case reflect.Bool:
+		return filterValue{kind: kindBool, b: v.Bool()}, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return filterValue{kind: kindNumber, num: float64(v.Int())}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return filterValue{kind: kindNumber, num: float64(v.Uint())}, true
+	case reflect.Float32, reflect.Float64:
+		return filterValue{kind: kindNumber, num: v.Float()}, true
+	}
+	return filterValue{kind: kindNumber, num: float64(v.Len())}, true
+}
+
+// filterNode is a node of a parsed filter expression.
+type filterNode interface {
+	eval(s *models.APIServer) bool
+}
+
+type orNode struct{ left, right filterNode }
+type andNode struct{ left, right filterNode }
+type notNode struct{ n filterNode }
+type truthNode struct{ field filterField }
+type compareNode struct {
+	field  filterField
+	op     string
+	values []token
+}
+
+func (n orNode) eval(s *models.APIServer) bool  { return n.left.eval(s) || n.right.eval(s) }
+func (n andNode) eval(s *models.APIServer) bool { return n.left.eval(s) && n.right.eval(s) }
+func (n notNode) eval(s *models.APIServer) bool { return !n.n.eval(s) }
+
+func (n truthNode) eval(s *models.APIServer) bool {
+	v, ok := n.field.value(s)
+	if !ok {
+		return false
+	}
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindNumber:
+		return v.num != 0
+	}
+	return v.str != "" && v.str != "0"
+}
+
+func (n compareNode) eval(s *models.APIServer) bool {
+	v, ok := n.field.value(s)
+	if !ok {
+		return false
+	}
+	if n.op == "in" {
+		for _, t := range n.values {
+			if compareFilterValue(v, "==", t) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareFilterValue(v, n.op, n.values[0])
+}
+
+func compareFilterValue(v filterValue, op string, t token) bool {
+	switch v.kind {
+	case kindBool:
+		b := strings.EqualFold(t.val, "true")
+		if op == "!=" {
+			return v.b != b
+		}
+		return v.b == b
+	case kindString:
+		// rules are compared as numbers if both sides are numbers
+		num, err1 := strconv.ParseFloat(v.str, 64)
+		if _, err2 := strconv.ParseFloat(t.val, 64); err1 == nil && err2 == nil {
+			return compareFilterValue(filterValue{kind: kindNumber, num: num}, op, t)
+		}
+		a, b := strings.ToLower(v.str), strings.ToLower(t.val)
+		switch op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		case "~":
+			return strings.Contains(a, b)
+		case "!~":
+			return !strings.Contains(a, b)
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+	case kindNumber:
+		b, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case "==":
+			return v.num == b
+		case "!=":
+			return v.num != b
+		case "<":
+			return v.num < b
+		case "<=":
+			return v.num <= b
+		case ">":
+			return v.num > b
+		case ">=":
+			return v.num >= b
+		}
+	}
+	return false
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+// parseFilterExpr parses the filter expression. Unknown fields, and values that
+// do not fit their field, are reported as errors.
+func parseFilterExpr(expr string) (filterNode, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	if p.peek().typ == tokEOF {
+		return nil, &FilterError{0, "empty expression"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tokEOF {
+		return nil, &FilterError{t.pos, fmt.Sprintf("unexpected '%s'", t.val)}
+	}
+	return n, nil
+}
+
+func (p *filterParser) peek() token { return p.tokens[p.pos] }
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokOp && p.peek().val == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokOp && p.peek().val == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	t := p.peek()
+	if t.typ == tokOp && t.val == "!" {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	if t.typ == tokLParen {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.typ != tokRParen {
+			return nil, &FilterError{c.pos, "expected ')'"}
+		}
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	t := p.next()
+	if t.typ != tokIdent {
+		if t.typ == tokEOF {
+			return nil, &FilterError{t.pos, "unexpected end of expression"}
+		}
+		return nil, &FilterError{t.pos, fmt.Sprintf("expected a field, got '%s'",
+			t.val)}
+	}
+	field, ok := lookupFilterField(t.val)
+	if !ok {
+		return nil, &FilterError{t.pos, fmt.Sprintf("unknown field '%s'", t.val)}
+	}
+	op := p.peek()
+	switch {
+	case op.typ == tokIdent && strings.EqualFold(op.val, "in"):
+		p.next()
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if err := checkFilterValue(field, "==", v); err != nil {
+				return nil, err
+			}
+		}
+		return compareNode{field: field, op: "in", values: values}, nil
+	case op.typ == tokOp && op.val != "&&" && op.val != "||" && op.val != "!":
+		p.next()
+		v := p.next()
+		if v.typ != tokIdent && v.typ != tokNumber && v.typ != tokString {
+			return nil, &FilterError{v.pos, "expected a value"}
+		}
+		if err := checkFilterValue(field, op.val, v); err != nil {
+			return nil, err
+		}
+		return compareNode{field: field, op: op.val, values: []token{v}}, nil
+	}
+	// bare field
+	return truthNode{field}, nil
+}
+
+func (p *filterParser) parseList() ([]token, error) {
+	if t := p.next(); t.typ != tokLBracket {
+		return nil, &FilterError{t.pos, "expected '['"}
+	}
+	var values []token
+	for {
+		v := p.next()
+		if v.typ != tokIdent && v.typ != tokNumber && v.typ != tokString {
+			return nil, &FilterError{v.pos, "expected a value"}
+		}
+		values = append(values, v)
+		sep := p.next()
+		if sep.typ == tokRBracket {
+			return values, nil
+		}
+		if sep.typ != tokComma {
+			return nil, &FilterError{sep.pos, "expected ',' or ']'"}
+		}
+	}
+}
+
+// checkFilterValue determines whether the operator and value can be used with
+// the field.
+func checkFilterValue(f filterField, op string, v token) error {
+	switch f.kind {
+	case kindBool:
+		if op != "==" && op != "!=" {
+			return &FilterError{v.pos, fmt.Sprintf(
+				"operator '%s' cannot be used with boolean field '%s'", op, f.name)}
+		}
+		if !strings.EqualFold(v.val, "true") && !strings.EqualFold(v.val, "false") {
+			return &FilterError{v.pos, fmt.Sprintf(
+				"field '%s' must be compared to true or false", f.name)}
+		}
+	case kindNumber:
+		if op == "~" || op == "!~" {
+			return &FilterError{v.pos, fmt.Sprintf(
+				"operator '%s' cannot be used with numeric field '%s'", op, f.name)}
+		}
+		if _, err := strconv.ParseFloat(v.val, 64); err != nil {
+			return &FilterError{v.pos, fmt.Sprintf(
+				"field '%s' must be compared to a number", f.name)}
+		}
+	}
+	return nil
+}
+
+// filterServersByExpr returns the servers of the list that match the parsed
+// filter expression.
+func filterServersByExpr(n filterNode,
+	a *models.APIServerList) *models.APIServerList {
+	filtered := make([]models.APIServer, 0, len(a.Servers))
+	for i := range a.Servers {
+		if n.eval(&a.Servers[i]) {
+			filtered = append(filtered, a.Servers[i])
+		}
+	}
+	sl := *a
+	sl.Servers = filtered
+	sl.ServerCount = len(filtered)
+	sl.TotalCount = len(filtered)
+	return &sl
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+var testExprServers = []models.APIServer{
+	models.APIServer{ID: 1, Host: "10.0.0.1:27960", Game: "QuakeLive", Port: 27960,
+		CountryInfo: models.DbCountry{CountryCode: "US", Continent: "North America"},
+		Info: models.SteamServerInfo{Name: "Campgrounds CA", Map: "campgrounds",
+			Players: 6, MaxPlayers: 16, GameTypeShort: "CA",
+			ExtraData: models.SteamExtraData{Keywords: "minqlx,ca"}},
+		Rules: map[string]string{"g_gametype": "4", "sv_hostname": "cg"}},
+	models.APIServer{ID: 2, Host: "10.0.0.2:27960", Game: "QuakeLive", Port: 27960,
+		CountryInfo: models.DbCountry{CountryCode: "DE", Continent: "Europe"},
+		Info: models.SteamServerInfo{Name: "Duel", Map: "bloodrun", Players: 2,
+			MaxPlayers: 2, Visibility: 1, GameTypeShort: "DUEL"},
+		Rules: map[string]string{"g_gametype": "1"}},
+	models.APIServer{ID: 3, Host: "10.0.0.3:25801", Game: "Reflex", Port: 25801,
+		CountryInfo: models.DbCountry{CountryCode: "CA", Continent: "North America"},
+		Info: models.SteamServerInfo{Name: "Reflex FFA", Map: "aerowalk", Players: 4,
+			MaxPlayers: 8, Bots: 2},
+		Players: []models.SteamPlayerInfo{models.SteamPlayerInfo{Name: "a"},
+			models.SteamPlayerInfo{Name: "b"}}},
+}
+
+func TestFilterExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		ids  []int64
+	}{
+		{`players>=4 && !hasPassword && (map~"campgrounds" || country in [US,CA])`,
+			[]int64{1, 3}},
+		{`rules.g_gametype==4`, []int64{1}},
+		{`rules.g_gametype < 4`, []int64{2}},
+		{`rules.sv_hostname`, []int64{1}},
+		{`hasPassword`, []int64{2}},
+		{`!isNotFull || bots > 0`, []int64{2, 3}},
+		{`game == quakelive && region != "North America"`, []int64{2}},
+		{`info.serverName ~ 'ffa' || keywords ~ minqlx`, []int64{1, 3}},
+		{`serverID in [1, 3] && port != 25801`, []int64{1}},
+		{`location.countryCode !~ U`, []int64{2, 3}},
+		{`players == 2 && gameTypeShort == DUEL`, []int64{2}},
+		// maps and slices are compared by length
+		{`rules >= 2`, []int64{1}},
+		{`info.players - 1 == 3`, nil},
+	}
+	for _, tt := range tests {
+		n, err := parseFilterExpr(tt.expr)
+		if tt.ids == nil {
+			if err == nil {
+				t.Errorf("Expected %s to be invalid", tt.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %s", tt.expr, err)
+			continue
+		}
+		sl := models.GetDefaultServerList()
+		sl.Servers = testExprServers
+		var ids []int64
+		for _, s := range filterServersByExpr(n, sl).Servers {
+			ids = append(ids, s.ID)
+		}
+		if len(ids) != len(tt.ids) {
+			t.Errorf("%s: expected servers %v, got: %v", tt.expr, tt.ids, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.ids[i] {
+				t.Errorf("%s: expected servers %v, got: %v", tt.expr, tt.ids, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestFilterExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{`players >= `, 11},
+		{`bogus == 1`, 0},
+		{`players == many`, 11},
+		{`map ~ "camp`, 6},
+		{`(players > 1`, 12},
+		{`hasBots > 1`, 10},
+		{`players ~ 1`, 10},
+		{`country in [US CA]`, 15},
+		{`players > 1 map`, 12},
+		{`players # 1`, 8},
+		{``, 0},
+	}
+	for _, tt := range tests {
+		_, err := parseFilterExpr(tt.expr)
+		fe, ok := err.(*FilterError)
+		if !ok {
+			t.Errorf("Expected filter error for %s, got: %v", tt.expr, err)
+			continue
+		}
+		if fe.Pos != tt.pos {
+			t.Errorf("Expected error for %s at %d, got: %s", tt.expr, tt.pos, fe)
+		}
+	}
+}
+
+func TestGetServersFilterError(t *testing.T) {
+	expr := "players >> 1"
+	r, _ := http.NewRequest("GET",
+		formatURL("servers?filter="+url.QueryEscape(expr)), nil)
+	w := newRecorder()
+	getServers(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %v for invalid filter; got: %v",
+			http.StatusBadRequest, w.Code)
+	}
+	e := struct {
+		Error struct {
+			Code       int    `json:"code"`
+			Message    string `json:"message"`
+			Expression string `json:"expression"`
+			Position   int    `json:"position"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("Unable to decode filter error: %s", err)
+	}
+	if e.Error.Code != 400 || e.Error.Position != 9 || e.Error.Expression != expr ||
+		e.Error.Message == "" {
+		t.Fatalf("Unexpected filter error: %+v", e.Error)
+	}
+}
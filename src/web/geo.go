@@ -0,0 +1,101 @@
+package web
+
+// geo.go - distance filtering and sorting of the server list
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+const (
+	// mean radius of the earth
+	earthRadiusKm = 6371.0088
+	// value of the near parameter that locates the caller by IP
+	nearCaller = "me"
+	// sort field for the distance from the near parameter's location
+	distanceSortField = "distance"
+)
+
+type geoPoint struct {
+	lat, lon float64
+}
+
+// distanceKm returns the great-circle distance between the points.
+func distanceKm(a, b geoPoint) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dlat, dlon := rad(b.lat-a.lat), rad(b.lon-a.lon)
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(rad(a.lat))*math.Cos(rad(b.lat))*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// parseGeoPoint parses the latitude and longitude values of the near parameter.
+func parseGeoPoint(vals []string) (geoPoint, bool) {
+	if len(vals) != 2 {
+		return geoPoint{}, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(vals[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return geoPoint{}, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(vals[1]), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return geoPoint{}, false
+	}
+	return geoPoint{lat, lon}, true
+}
+
+// callerIP returns the IP address of the client that made the request. The first
+// address in X-Forwarded-For is preferred for deployments behind a proxy; since
+// it is only used to locate the caller, a forged header only affects the
+// caller's own results.
+func callerIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// locateCaller geolocates the IP address of the caller. Returns false if the
+// caller's location is not known.
+func locateCaller(ip string) (geoPoint, bool) {
+	if db.CountryDB == nil {
+		return geoPoint{}, false
+	}
+	c := db.CountryDB.LookupCountryInfo(ip)
+	if !c.HasCoordinates {
+		return geoPoint{}, false
+	}
+	return geoPoint{c.Latitude, c.Longitude}, true
+}
+
+// filterServersByDistance sets the distance of each server from the point and
+// returns the servers within the radius, if any. Servers without coordinates are
+// only kept if there is no radius.
+func filterServersByDistance(p geoPoint, radiusKm float64,
+	servers []models.APIServer) []models.APIServer {
+	filtered := servers[:0]
+	for _, s := range servers {
+		if s.CountryInfo.HasCoordinates {
+			s.DistanceKm = distanceKm(p, geoPoint{s.CountryInfo.Latitude,
+				s.CountryInfo.Longitude})
+		} else if radiusKm > 0 {
+			continue
+		}
+		if radiusKm > 0 && s.DistanceKm > radiusKm {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func newTestGeoList() *models.APIServerList {
+	loc := func(lat, lon float64) models.DbCountry {
+		return models.DbCountry{HasCoordinates: true, Latitude: lat, Longitude: lon}
+	}
+	servers := []models.APIServer{
+		// Oslo, Dallas, unknown and Stockholm
+		models.APIServer{ID: 1, CountryInfo: loc(59.91, 10.75)},
+		models.APIServer{ID: 2, CountryInfo: loc(32.78, -96.8)},
+		models.APIServer{ID: 3},
+		models.APIServer{ID: 4, CountryInfo: loc(59.33, 18.07)},
+	}
+	return &models.APIServerList{Servers: servers, ServerCount: len(servers),
+		TotalCount: len(servers)}
+}
+
+func TestDistanceKm(t *testing.T) {
+	// Oslo to Stockholm is about 417 km
+	d := distanceKm(geoPoint{59.91, 10.75}, geoPoint{59.33, 18.07})
+	if math.Abs(d-417) > 5 {
+		t.Fatalf("Expected a distance of about 417 km; got: %f", d)
+	}
+	if d = distanceKm(geoPoint{10, 20}, geoPoint{10, 20}); d != 0 {
+		t.Fatalf("Expected a distance of 0 km; got: %f", d)
+	}
+}
+
+func TestServerPageNear(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		ids   []int64
+	}{
+		// servers without coordinates are kept unless there is a radius
+		{url.Values{"near": {"59.9,10.7"}}, []int64{1, 2, 3, 4}},
+		{url.Values{"near": {"59.9,10.7"}, "sort": {"distance:desc"}},
+			[]int64{2, 4, 1, 3}},
+		{url.Values{"near": {"59.9,10.7"}, "radiusKm": {"500"},
+			"sort": {"distance"}}, []int64{1, 4}},
+		{url.Values{"near": {"33,-97"}, "radiusKm": {"100"}}, []int64{2}},
+	}
+	for _, tt := range tests {
+		p, perr := getServerPage(tt.query, 0, "")
+		if perr != nil {
+			t.Errorf("Unexpected error for %v: %s", tt.query, perr)
+			continue
+		}
+		sl := p.apply(newTestGeoList())
+		if ids := serverIDs(sl.Servers); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("Expected %v to return servers %v; got: %v", tt.query, tt.ids,
+				ids)
+		}
+		if sl.TotalCount != len(tt.ids) {
+			t.Errorf("Expected a total count of %d for %v; got: %d", len(tt.ids),
+				tt.query, sl.TotalCount)
+		}
+	}
+	invalid := []url.Values{
+		{"near": {"91,0"}},
+		{"near": {"10"}},
+		{"near": {"somewhere"}},
+		{"radiusKm": {"100"}},
+		{"near": {"10,10"}, "radiusKm": {"-1"}},
+		{"sort": {"distance"}},
+		// the caller could not be located
+		{"near": {"me"}},
+	}
+	for _, v := range invalid {
+		if _, perr := getServerPage(v, 0, "unknown"); perr == nil ||
+			perr.code != http.StatusBadRequest {
+			t.Errorf("Expected %v to be a bad request; got: %v", v, perr)
+		}
+	}
+}
+
+func TestServerPageNearCaller(t *testing.T) {
+	r, _ := http.NewRequest("GET", formatURL("servers?near=me&radiusKm=200"), nil)
+	r.RemoteAddr = "10.1.1.1:5000"
+	r.Header.Set("X-Forwarded-For", "89.20.244.197, 10.0.0.1")
+	if ip := callerIP(r); ip != "89.20.244.197" {
+		t.Fatalf("Expected the forwarded caller IP; got: %s", ip)
+	}
+	p, perr := getServerPage(r.URL.Query(), 0, callerIP(r))
+	if perr != nil {
+		t.Fatalf("Unexpected error locating the caller: %s", perr)
+	}
+	sl := p.apply(newTestGeoList())
+	if ids := serverIDs(sl.Servers); !reflect.DeepEqual(ids, []int64{1}) {
+		t.Fatalf("Expected only the server in Oslo near the caller; got: %v", ids)
+	}
+	r.Header.Del("X-Forwarded-For")
+	if ip := callerIP(r); ip != "10.1.1.1" {
+		t.Fatalf("Expected the remote address as the caller IP; got: %s", ip)
+	}
+}
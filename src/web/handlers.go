@@ -9,9 +9,13 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/syncore/a2sapi/src/config"
 	"github.com/syncore/a2sapi/src/constants"
+	"github.com/syncore/a2sapi/src/db"
 	"github.com/syncore/a2sapi/src/logger"
 	"github.com/syncore/a2sapi/src/models"
 )
@@ -40,25 +44,84 @@ func useDumpFileAsMasterList(dumppath string) *models.APIServerList {
 	return ml
 }
 
+// getMasterList returns the combined master server lists of the specified games,
+// or of all games if no games were specified or if none of the specified games
+// are retrieved at timed intervals (i.e. a game description from A2S_INFO).
+func getMasterList(games []string) *models.APIServerList {
+	entries := models.MasterLists.Get(games)
+	if len(entries) == 0 && len(games) != 0 {
+		entries = models.MasterLists.Get(nil)
+	}
+	return models.MergeMasterLists(entries)
+}
+
 func getServers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if name := invalidNumericFilter(r.URL.Query(),
+		getServersQueryStrings); name != "" {
+		writeErrorResponse(w, http.StatusBadRequest,
+			fmt.Sprintf("The %s parameter must be a number.", name))
+		return
+	}
 	var asl *models.APIServerList
 
 	if config.Config.DebugConfig.ServerDumpFileAsMasterList {
 		asl = useDumpFileAsMasterList(constants.DumpFileFullPath(
 			config.Config.DebugConfig.ServerDumpFilename))
 	} else {
-		asl = models.MasterList
+		asl = getMasterList(getQStringValues(r.URL.Query(), qsGetServersGame))
 	}
 	// Empty (i.e. during first retrieval/startup)
 	if asl == nil {
 		writeJSONResponse(w, models.GetDefaultServerList())
 		return
 	}
+	var expr filterNode
+	if raw := getQStringRawValue(r.URL.Query(), qsGetServersFilter); raw != "" {
+		var err error
+		if expr, err = parseFilterExpr(raw); err != nil {
+			writeFilterError(w, raw, err)
+			return
+		}
+	}
+	page, perr := getServerPage(r.URL.Query(), asl.Generation,
+		callerIP(r))
+	if perr != nil {
+		writeErrorResponse(w, perr.code, perr.msg)
+		return
+	}
 	srvfilters := getSrvFilterFromQString(r.URL.Query(), getServersQueryStrings)
 	logger.WriteDebug("server list will be filtered with: %v", srvfilters)
 	list := filterServers(srvfilters, asl)
-	writeJSONResponse(w, list)
+	if expr != nil {
+		list = filterServersByExpr(expr, list)
+	}
+	projected, err := page.project(page.apply(list))
+	if err != nil {
+		writeJSONEncodeError(w, err)
+		return
+	}
+	writeJSONResponse(w, projected)
+}
+
+// writeFilterError responds with the error in the filter expression and its
+// position.
+func writeFilterError(w http.ResponseWriter, expr string, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	e := struct {
+		Error struct {
+			Code       int    `json:"code"`
+			Message    string `json:"message"`
+			Expression string `json:"expression"`
+			Position   int    `json:"position"`
+		} `json:"error"`
+	}{}
+	e.Error.Code, e.Error.Message, e.Error.Expression = http.StatusBadRequest,
+		err.Error(), expr
+	if fe, ok := err.(*FilterError); ok {
+		e.Error.Message, e.Error.Position = fe.Msg, fe.Pos
+	}
+	writeJSONResponse(w, e)
 }
 
 func getServerIDs(w http.ResponseWriter, r *http.Request) {
@@ -97,6 +160,23 @@ func queryServerIDs(w http.ResponseWriter, r *http.Request) {
 	queryServerIDRetriever(w, ids)
 }
 
+func getPing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	ids := getQStringValues(r.URL.Query(), qsPingServerIDs)
+	logger.WriteDebug("getPing: ids are: %s", ids)
+
+	if ids == nil {
+		writeJSONResponse(w, models.GetDefaultPingList())
+		return
+	}
+	if len(ids) > config.Config.WebConfig.MaximumHostsPerAPIQuery {
+		logger.WriteDebug("Maximum number of allowed API query hosts exceeded, truncating")
+		ids = ids[:config.Config.WebConfig.MaximumHostsPerAPIQuery]
+	}
+
+	pingRetriever(w, ids)
+}
+
 func queryServerAddrs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
@@ -141,6 +221,99 @@ func queryServerAddrs(w http.ResponseWriter, r *http.Request) {
 	queryServerAddrRetriever(w, parsedaddresses)
 }
 
+// defaultHistoryPeriod is the period of history that is returned when the start
+// of the period is not specified.
+const defaultHistoryPeriod = 24 * time.Hour
+
+func getHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	qry := r.URL.Query()
+	q := db.HistoryQuery{
+		Games:     getQStringValues(qry, qsHistoryGames),
+		Countries: getQStringValues(qry, qsHistoryCountries),
+	}
+	for _, id := range getQStringValues(qry, qsHistoryServerIDs) {
+		parsed, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		q.IDs = append(q.IDs, parsed)
+	}
+	if len(q.IDs) == 0 && q.Games == nil && q.Countries == nil {
+		w.WriteHeader(http.StatusOK)
+		logger.WriteDebug("getHistory: Got empty query. Ignoring.")
+		writeJSONResponse(w, models.GetDefaultHistoryList())
+		return
+	}
+	if len(q.IDs) > config.Config.WebConfig.MaximumHostsPerAPIQuery {
+		logger.WriteDebug("Maximum number of allowed API query hosts exceeded, truncating")
+		q.IDs = q.IDs[:config.Config.WebConfig.MaximumHostsPerAPIQuery]
+	}
+
+	now := time.Now()
+	q.To = now.Unix()
+	q.From = now.Add(-defaultHistoryPeriod).Unix()
+	for _, v := range []struct {
+		name string
+		val  *int64
+	}{{qsHistoryFrom, &q.From}, {qsHistoryTo, &q.To},
+		{qsHistoryResolution, &q.Resolution}} {
+		vals := getQStringValues(qry, v.name)
+		if vals == nil {
+			continue
+		}
+		parsed, err := strconv.ParseInt(vals[0], 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w,
+				`{"error": {"code": 400,"message": "The %s parameter must be a number."}}`,
+				v.name)
+			return
+		}
+		*v.val = parsed
+	}
+	if q.From > q.To {
+		writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf(
+			"The %s parameter must not be after the %s parameter.", qsHistoryFrom,
+			qsHistoryTo))
+		return
+	}
+	if q.Resolution < 0 {
+		writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf(
+			"The %s parameter must not be negative.", qsHistoryResolution))
+		return
+	}
+	historyRetriever(w, q)
+}
+
+// minPlayerSearchLength is the minimum length of a searched player name.
+const minPlayerSearchLength = 2
+
+func getPlayers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	qry := r.URL.Query()
+	names := getQStringValues(qry, qsPlayersNames)
+	logger.WriteDebug("getPlayers: names are: %s", names)
+	if names == nil {
+		w.WriteHeader(http.StatusOK)
+		logger.WriteDebug("getPlayers: Got empty query. Ignoring.")
+		writeJSONResponse(w, models.GetDefaultPlayerList())
+		return
+	}
+	for _, n := range names {
+		if len(strings.TrimSpace(n)) < minPlayerSearchLength {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSONResponse(w, models.GetDefaultPlayerList())
+			return
+		}
+	}
+	fuzzy := getQStringValues(qry, qsPlayersFuzzy)
+	sessions := getQStringValues(qry, qsPlayersSessions)
+	writeJSONResponse(w, models.PlayerIndex.Search(names,
+		fuzzy != nil && strings.EqualFold(fuzzy[0], "true"),
+		sessions != nil && strings.EqualFold(sessions[0], "true")))
+}
+
 // writeJSONResponse encodes data as JSON and writes it to w; if unsuccessful,
 // the error will be logged and a generic error message will be displayed to the user.
 func writeJSONResponse(w http.ResponseWriter, data interface{}) {
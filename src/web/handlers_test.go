@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -108,6 +110,17 @@ func TestGetServers(t *testing.T) {
 	if len(w.Body.Bytes()) == 0 {
 		t.Errorf("Response body should not be empty")
 	}
+	// filters that must be numbers
+	for _, q := range []string{"maxPing=abc", "minReliability=high"} {
+		r, _ = http.NewRequest("GET", formatURL("servers?"+q), nil)
+		w = newRecorder()
+		getServers(w, r)
+		if w.Code != http.StatusBadRequest ||
+			!strings.Contains(w.Body.String(), "must be a number") {
+			t.Errorf("Expected status code %v for %s; got: %v %s",
+				http.StatusBadRequest, q, w.Code, w.Body.Bytes())
+		}
+	}
 }
 
 // TestGetServerID tests the GetServerID HTTP handler
@@ -190,3 +203,233 @@ func TestQueryServerAddr(t *testing.T) {
 		t.Errorf("queryServerAddr handler body should not be empty")
 	}
 }
+
+// TestGetMasterList tests the selection of per-game master lists
+func TestGetMasterList(t *testing.T) {
+	ql := models.GetDefaultServerList()
+	ql.Servers = append(ql.Servers, models.APIServer{Game: "QuakeLive",
+		Host: "10.0.0.1:27960"})
+	reflex := models.GetDefaultServerList()
+	reflex.Servers = append(reflex.Servers, models.APIServer{Game: "Reflex",
+		Host: "10.0.0.2:25801"})
+	models.MasterLists.Set("QuakeLive", ql)
+	gen, _ := models.MasterLists.Set("Reflex", reflex)
+	defer models.MasterLists.Remove("QuakeLive")
+	defer models.MasterLists.Remove("Reflex")
+
+	asl := getMasterList([]string{"quakelive"})
+	if len(asl.Servers) != 1 || asl.Servers[0].Game != "QuakeLive" {
+		t.Fatalf("Expected only the QuakeLive master list, got: %v", asl.Servers)
+	}
+	asl = getMasterList(nil)
+	if asl.ServerCount != 2 {
+		t.Fatalf("Expected 2 servers from all master lists, got: %d",
+			asl.ServerCount)
+	}
+	if asl.Generation != gen {
+		t.Fatalf("Expected generation %d, got: %d", gen, asl.Generation)
+	}
+	// not a timed game name, so all lists should be used
+	asl = getMasterList([]string{"Clan Arena"})
+	if asl.ServerCount != 2 {
+		t.Fatalf("Expected 2 servers from all master lists, got: %d",
+			asl.ServerCount)
+	}
+	// failed retrieval keeps the last good list
+	if _, ok := models.MasterLists.Set("QuakeLive", nil); ok {
+		t.Fatalf("Expected failed retrieval not to be stored")
+	}
+	asl = getMasterList([]string{"QuakeLive"})
+	if asl == nil || asl.ServerCount != 1 || asl.Generation != gen-1 {
+		t.Fatalf("Expected last good QuakeLive list to be kept, got: %v", asl)
+	}
+	// merged list is a copy and must not change the stored list
+	if ql.Generation != 0 {
+		t.Fatalf("Expected stored list not to be modified")
+	}
+}
+
+func TestMasterListStoreConcurrency(t *testing.T) {
+	defer models.MasterLists.Remove("QuakeLive")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			models.MasterLists.Set("QuakeLive", models.GetDefaultServerList())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			getMasterList([]string{"QuakeLive"})
+		}
+	}()
+	wg.Wait()
+	if asl := getMasterList([]string{"QuakeLive"}); asl == nil {
+		t.Fatalf("Expected QuakeLive master list to exist")
+	}
+}
+
+// TestGetHistory tests the GetHistory HTTP handler
+func TestGetHistory(t *testing.T) {
+	now := time.Now().Unix()
+	err := db.HistoryDB.AddHistory(now-60, []models.APIServer{
+		models.APIServer{ID: 7, Game: "Reflex",
+			Info: models.SteamServerInfo{Players: 3, Map: "aerowalk"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error when adding history: %s", err)
+	}
+	r, _ := http.NewRequest("GET", formatURL("history?ids=7,notanid"), nil)
+	w := newRecorder()
+	getHistory(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %v for getHistory handler; got: %v",
+			http.StatusOK, w.Code)
+	}
+	hl := &models.HistoryList{}
+	if err := json.Unmarshal(w.Body.Bytes(), hl); err != nil {
+		t.Fatalf("Unable to decode history: %s", err)
+	}
+	if hl.SeriesCount != 1 || hl.Series[0].ServerID != 7 ||
+		len(hl.Series[0].Points) != 1 || hl.Series[0].Points[0].Players != 3 {
+		t.Fatalf("Expected history of server 7, got: %+v", hl)
+	}
+	// nothing specified
+	r, _ = http.NewRequest("GET", formatURL("history"), nil)
+	w = newRecorder()
+	getHistory(w, r)
+	m := &models.HistoryList{}
+	_, modelMatches := w.ExpectJSON(m, models.GetDefaultHistoryList())
+	if !modelMatches || w.Code != http.StatusOK {
+		t.Errorf("getHistory: expected default history list, got: %s", w.Body.Bytes())
+	}
+	// invalid time
+	r, _ = http.NewRequest("GET", formatURL("history?ids=7&from=yesterday"), nil)
+	w = newRecorder()
+	getHistory(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %v for invalid from; got: %v",
+			http.StatusBadRequest, w.Code)
+	}
+	for _, q := range []string{"from=2000&to=1000", "resolution=-60"} {
+		r, _ = http.NewRequest("GET", formatURL("history?ids=7&"+q), nil)
+		w = newRecorder()
+		getHistory(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %v for %s; got: %v",
+				http.StatusBadRequest, q, w.Code)
+		}
+	}
+}
+
+func testPlayerServer(id int64, host string, names ...string) models.APIServer {
+	srv := models.APIServer{ID: id, Host: host, Game: "QuakeLive",
+		Info: models.SteamServerInfo{Name: "test server", Map: "toxicity"}}
+	for _, n := range names {
+		srv.FilteredPlayers.FilteredPlayers = append(
+			srv.FilteredPlayers.FilteredPlayers,
+			models.SteamPlayerInfo{Name: n, TimeConnectedSecs: 30})
+	}
+	return srv
+}
+
+func testPlayerEntries(timestamp int64,
+	servers ...models.APIServer) []models.MasterListEntry {
+	sl := models.GetDefaultServerList()
+	sl.RetrievedTimeStamp = timestamp
+	sl.Servers = servers
+	return []models.MasterListEntry{models.MasterListEntry{Game: "QuakeLive",
+		List: sl}}
+}
+
+// TestPlayerIndex tests the searching and session tracking of the player index
+func TestPlayerIndex(t *testing.T) {
+	idx := models.NewPlayerIndexStore()
+	now := time.Now()
+	idx.Rebuild(testPlayerEntries(now.Unix()-120,
+		testPlayerServer(1, "10.0.0.1:27960", "^1rapha", "cypher"),
+		testPlayerServer(2, "10.0.0.2:27960", "k1llsen")), now.Add(-2*time.Minute))
+	idx.Rebuild(testPlayerEntries(now.Unix()-60,
+		testPlayerServer(1, "10.0.0.1:27960", "^1rapha"),
+		testPlayerServer(2, "10.0.0.2:27960", "cypher")), now.Add(-time.Minute))
+	idx.Rebuild(testPlayerEntries(now.Unix(),
+		testPlayerServer(1, "10.0.0.1:27960", "^1rapha"),
+		testPlayerServer(2, "10.0.0.2:27960", "cypher")), now)
+
+	pl := idx.Search([]string{"RAPH"}, false, false)
+	if pl.PlayerCount != 1 || pl.Players[0].ServerID != 1 ||
+		pl.Players[0].MatchType != models.PlayerMatchSubstring {
+		t.Fatalf("Expected substring match for rapha on server 1, got: %+v", pl)
+	}
+	if pl.Players[0].Sessions != nil {
+		t.Fatalf("Expected no sessions unless requested, got: %+v",
+			pl.Players[0].Sessions)
+	}
+	if pl := idx.Search([]string{"cyphre"}, false, false); pl.PlayerCount != 0 {
+		t.Fatalf("Expected no match without fuzzy matching, got: %+v", pl)
+	}
+	pl = idx.Search([]string{"cyphre"}, true, true)
+	if pl.PlayerCount != 1 || pl.Players[0].MatchType != models.PlayerMatchFuzzy {
+		t.Fatalf("Expected fuzzy match for cypher, got: %+v", pl)
+	}
+	// moved from server 1 to server 2
+	s := pl.Players[0].Sessions
+	if len(s) != 2 || s[0].Ongoing || s[0].ServerID != 1 || !s[1].Ongoing ||
+		s[1].ServerID != 2 || s[1].Start != now.Unix()-90 ||
+		s[1].End != now.Unix() {
+		t.Fatalf("Expected ended session on 1 and ongoing session on 2, got: %+v", s)
+	}
+	// left; session is kept but no longer current
+	if pl := idx.Search([]string{"k1llsen"}, false, false); pl.PlayerCount != 0 {
+		t.Fatalf("Expected k1llsen to no longer be indexed, got: %+v", pl)
+	}
+}
+
+// TestGetPlayers tests the GetPlayers HTTP handler
+func TestGetPlayers(t *testing.T) {
+	models.PlayerIndex.Rebuild(testPlayerEntries(time.Now().Unix(),
+		testPlayerServer(5, "10.0.0.5:27960", "evil")), time.Now())
+	r, _ := http.NewRequest("GET", formatURL("players?names=EVI,zzz&sessions=true"),
+		nil)
+	w := newRecorder()
+	getPlayers(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %v for getPlayers handler; got: %v",
+			http.StatusOK, w.Code)
+	}
+	pl := &models.APIPlayerList{}
+	if err := json.Unmarshal(w.Body.Bytes(), pl); err != nil {
+		t.Fatalf("Unable to decode players: %s", err)
+	}
+	if pl.PlayerCount != 1 || pl.Players[0].ServerID != 5 ||
+		len(pl.Players[0].Sessions) != 1 {
+		t.Fatalf("Expected evil on server 5 with a session, got: %+v", pl)
+	}
+	// too short
+	r, _ = http.NewRequest("GET", formatURL("players?names=e"), nil)
+	w = newRecorder()
+	getPlayers(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %v for short name; got: %v",
+			http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestGetPing(t *testing.T) {
+	// no such server
+	r, _ := http.NewRequest("GET", formatURL("ping?ids=999999"), nil)
+	w := newRecorder()
+	getPing(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %v for getPing handler; got: %v",
+			http.StatusOK, w.Code)
+	}
+	pl := &models.APIPingList{}
+	if err := json.Unmarshal(w.Body.Bytes(), pl); err != nil {
+		t.Fatalf("Unable to decode ping list: %s", err)
+	}
+	if pl.ServerCount != 0 || pl.Servers == nil || pl.FailedServers == nil {
+		t.Fatalf("Expected an empty ping list, got: %+v", pl)
+	}
+}
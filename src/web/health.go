@@ -0,0 +1,128 @@
+package web
+
+// health.go - liveness, readiness and status endpoints for load balancers,
+// orchestrators and administrators
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/constants"
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/models"
+	"github.com/syncore/a2sapi/src/steam"
+)
+
+// a game's master list is stale once it has missed this many of its retrievals
+const staleMasterListRetrievals = 3
+
+var startedAt = time.Now()
+
+// readinessCheck represents the outcome of one of the readiness checks.
+type readinessCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// checkReadiness determines whether the country and server databases are open
+// and, if the master lists are retrieved at timed intervals, whether each game's
+// master list is loaded and not stale.
+func checkReadiness() (bool, []readinessCheck) {
+	var checks []readinessCheck
+	ready := true
+	check := func(name string, err error) {
+		c := readinessCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+			ready = false
+		}
+		checks = append(checks, c)
+	}
+	var err error
+	if db.CountryDB == nil {
+		err = fmt.Errorf("country database is not open")
+	}
+	check("countryDB", err)
+	if db.ServerDB == nil {
+		err = fmt.Errorf("server database is not open")
+	} else if err = db.ServerDB.Ping(); err != nil {
+		err = fmt.Errorf("server database is unreachable: %s", err)
+	}
+	check("serverDB", err)
+
+	cfg := config.Config.SteamConfig
+	if !cfg.AutoQueryMaster || config.Config.DebugConfig.ServerDumpFileAsMasterList {
+		return ready, checks
+	}
+	for _, g := range cfg.AutoQueryGames {
+		err = nil
+		maxAge := time.Duration(staleMasterListRetrievals*
+			g.TimeBetweenMasterQueries) * time.Second
+		if entries := models.MasterLists.Get([]string{g.Name}); len(entries) == 0 {
+			err = fmt.Errorf("master list is not loaded")
+		} else if age := entries[0].Age(); age > maxAge {
+			err = fmt.Errorf("master list is stale: %d secs old",
+				int64(age.Seconds()))
+		}
+		check("masterList:"+g.Name, err)
+	}
+	return ready, checks
+}
+
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writeJSONResponse(w, struct {
+		Status string `json:"status"`
+	}{"ok"})
+}
+
+func getReadiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	ready, checks := checkReadiness()
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSONResponse(w, struct {
+		Ready  bool             `json:"ready"`
+		Checks []readinessCheck `json:"checks"`
+	}{ready, checks})
+}
+
+// getRetrievalStatuses returns the status of each game that is retrieved at
+// timed intervals or has been retrieved; games that have not yet been retrieved
+// only have their name.
+func getRetrievalStatuses() []models.APIRetrievalStatus {
+	statuses := steam.GetRetrievalStatuses()
+	if !config.Config.SteamConfig.AutoQueryMaster {
+		return statuses
+	}
+	for _, g := range config.Config.SteamConfig.AutoQueryGames {
+		found := false
+		for _, s := range statuses {
+			if s.Game == g.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			statuses = append(statuses, models.APIRetrievalStatus{Game: g.Name})
+		}
+	}
+	return statuses
+}
+
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	uptime := time.Since(startedAt)
+	writeJSONResponse(w, models.APIStatus{
+		Version:          constants.Version,
+		StartedTimeStamp: startedAt.Unix(),
+		Uptime:           uptime.Truncate(time.Second).String(),
+		UptimeSecs:       int64(uptime.Seconds()),
+		Games:            getRetrievalStatuses(),
+		Config:           config.Config.Redacted(),
+	})
+}
@@ -0,0 +1,110 @@
+package web
+
+// metrics.go - /metrics endpoint in the Prometheus text format and the metrics of
+// the API's HTTP requests
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/metrics"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+var (
+	httpRequestDuration = metrics.NewHistogram(
+		"a2sapi_http_request_duration_seconds",
+		"Duration of the HTTP requests by route.", metrics.DefaultBuckets, "route")
+	httpRequests = metrics.NewCounter("a2sapi_http_requests_total",
+		"HTTP requests by route and status code.", "route", "code")
+	masterListAge = metrics.NewGauge("a2sapi_master_list_age_seconds",
+		"Time since each game's master list was stored.", "game")
+	serverDBSize = metrics.NewGauge("a2sapi_server_db_size_bytes",
+		"Size of the server database.")
+)
+
+func init() {
+	metrics.OnCollect(collectMetrics)
+}
+
+// collectMetrics sets the gauges whose values are only known when the metrics
+// are requested.
+func collectMetrics() {
+	masterListAge.Reset()
+	for _, e := range models.MasterLists.Get(nil) {
+		masterListAge.Set(e.Age().Seconds(), e.Game)
+	}
+	if db.ServerDB == nil {
+		return
+	}
+	if size, err := db.ServerDB.Size(); err == nil {
+		serverDBSize.Set(float64(size))
+	}
+}
+
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.Write(w); err != nil {
+		logger.FromRequest(r).Error(err.Error())
+	}
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying response, i.e.
+// to flush streamed responses.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Hijack takes over the connection for WebSocket upgrades, which are recorded as
+// switching protocols.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && s.code == 0 {
+		s.code = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// instrumentRoute records the duration and status code of the route's requests.
+func instrumentRoute(inner http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		inner.ServeHTTP(sr, r)
+		if sr.code == 0 {
+			sr.code = http.StatusOK
+		}
+		httpRequestDuration.Observe(time.Since(start).Seconds(), name)
+		httpRequests.Inc(name, strconv.Itoa(sr.code))
+	})
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/metrics"
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func TestGetMetrics(t *testing.T) {
+	srv := httptest.NewServer(newRouter())
+	defer srv.Close()
+	models.MasterLists.Set("MetricsGame", models.GetDefaultServerList())
+	defer models.MasterLists.Remove("MetricsGame")
+	if resp, err := http.Get(srv.URL + "/serverIDs?hosts=10.9.9.9"); err == nil {
+		resp.Body.Close()
+	}
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Unexpected error getting metrics: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("Expected metrics, got: %d %s", resp.StatusCode,
+			resp.Header.Get("Content-Type"))
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	out := string(body)
+	for _, s := range []string{
+		`a2sapi_http_requests_total{route="GetServerIDs",code="200"}`,
+		`a2sapi_http_request_duration_seconds_count{route="GetServerIDs"}`,
+		`a2sapi_master_list_age_seconds{game="MetricsGame"}`,
+		"a2sapi_server_db_size_bytes ",
+		"# TYPE a2sapi_query_duration_seconds histogram",
+		"# TYPE a2sapi_retrievals_total counter",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("Expected %q in metrics:\n%s", s, out)
+		}
+	}
+}
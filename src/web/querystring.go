@@ -7,7 +7,12 @@ import "strings"
 type querystring struct {
 	name     string
 	boolonly bool
+	// set for keys whose values must be numbers
+	numeric  bool
 	required bool
+	// set for keys that are not matched against the server fields, i.e. sorting,
+	// paging and distance
+	notFilter bool
 }
 
 type slQueryFilter struct {
@@ -64,6 +69,72 @@ const (
 	qsGetServersHasAntiCheat = "hasAntiCheat"
 	// ?isNotFull= (bool)
 	qsGetServersIsNotFull = "isNotFull"
+	// ?maxPing= (milliseconds)
+	qsGetServersMaxPing = "maxPing"
+	// ?minReliability= (availability percentage)
+	qsGetServersMinReliability = "minReliability"
+	// ?filter= (expression; not split on commas)
+	qsGetServersFilter = "filter"
+	// ?sort= (field or field:desc, comma-separated)
+	qsGetServersSort = "sort"
+	// ?limit=
+	qsGetServersLimit = "limit"
+	// ?offset=
+	qsGetServersOffset = "offset"
+	// ?cursor= (nextCursor of the previous page)
+	qsGetServersCursor = "cursor"
+	// ?fields= (comma-separated)
+	qsGetServersFields = "fields"
+	// ?near= (lat,lon or me)
+	qsGetServersNear = "near"
+	// ?radiusKm=
+	qsGetServersRadius = "radiusKm"
+
+	// history:
+	// ?ids=
+	qsHistoryServerIDs = "ids"
+	// ?games=
+	qsHistoryGames = "games"
+	// ?countries=
+	qsHistoryCountries = "countries"
+	// ?from= (unix timestamp)
+	qsHistoryFrom = "from"
+	// ?to= (unix timestamp)
+	qsHistoryTo = "to"
+	// ?resolution= (seconds)
+	qsHistoryResolution = "resolution"
+
+	// players:
+	// ?names=
+	qsPlayersNames = "names"
+	// ?fuzzy= (bool)
+	qsPlayersFuzzy = "fuzzy"
+	// ?sessions= (bool)
+	qsPlayersSessions = "sessions"
+
+	// ping:
+	// ?ids=
+	qsPingServerIDs = "ids"
+
+	// webhooks:
+	// ?id=
+	qsWebhookID = "id"
+	// ?limit=
+	qsWebhookLimit = "limit"
+
+	// stale server IDs:
+	// ?days=
+	qsStaleServerDays = "days"
+	// ?ids=
+	qsRetireServerIDs = "ids"
+	// ?id=
+	qsMergeServerID = "id"
+	// ?into=
+	qsMergeServerInto = "into"
+
+	// log level:
+	// ?level=
+	qsLogLevel = "level"
 )
 
 // getServerIDs query strings
@@ -90,6 +161,102 @@ var queryServerAddrQueryStrings = []querystring{
 	},
 }
 
+// history query strings
+var historyQueryStrings = []querystring{
+	querystring{
+		name: qsHistoryServerIDs,
+	},
+	querystring{
+		name: qsHistoryGames,
+	},
+	querystring{
+		name: qsHistoryCountries,
+	},
+	querystring{
+		name: qsHistoryFrom,
+	},
+	querystring{
+		name: qsHistoryTo,
+	},
+	querystring{
+		name: qsHistoryResolution,
+	},
+}
+
+// players query strings
+var playersQueryStrings = []querystring{
+	querystring{
+		name:     qsPlayersNames,
+		required: true,
+	},
+	querystring{
+		name:     qsPlayersFuzzy,
+		boolonly: true,
+	},
+	querystring{
+		name:     qsPlayersSessions,
+		boolonly: true,
+	},
+}
+
+// ping query strings
+var pingQueryStrings = []querystring{
+	querystring{
+		name:     qsPingServerIDs,
+		required: true,
+	},
+}
+
+// webhook update and deletion query strings
+var webhookIDQueryStrings = []querystring{
+	querystring{
+		name:     qsWebhookID,
+		required: true,
+	},
+}
+
+// webhook dead letter query strings
+var webhookDeadLetterQueryStrings = []querystring{
+	querystring{
+		name: qsWebhookLimit,
+	},
+}
+
+// stale server ID query strings
+var staleServerIDQueryStrings = []querystring{
+	querystring{
+		name: qsStaleServerDays,
+	},
+}
+
+// server ID retirement query strings
+var retireServerIDQueryStrings = []querystring{
+	querystring{
+		name:     qsRetireServerIDs,
+		required: true,
+	},
+}
+
+// server ID merge query strings
+var mergeServerIDQueryStrings = []querystring{
+	querystring{
+		name:     qsMergeServerID,
+		required: true,
+	},
+	querystring{
+		name:     qsMergeServerInto,
+		required: true,
+	},
+}
+
+// log level query strings
+var logLevelQueryStrings = []querystring{
+	querystring{
+		name:     qsLogLevel,
+		required: true,
+	},
+}
+
 // getServers query strings
 var getServersQueryStrings = []querystring{
 	querystring{
@@ -145,6 +312,42 @@ var getServersQueryStrings = []querystring{
 		name:     qsGetServersIsNotFull,
 		boolonly: true,
 	},
+	querystring{
+		name:    qsGetServersMaxPing,
+		numeric: true,
+	},
+	querystring{
+		name:    qsGetServersMinReliability,
+		numeric: true,
+	},
+	querystring{
+		name:      qsGetServersSort,
+		notFilter: true,
+	},
+	querystring{
+		name:      qsGetServersLimit,
+		notFilter: true,
+	},
+	querystring{
+		name:      qsGetServersOffset,
+		notFilter: true,
+	},
+	querystring{
+		name:      qsGetServersCursor,
+		notFilter: true,
+	},
+	querystring{
+		name:      qsGetServersFields,
+		notFilter: true,
+	},
+	querystring{
+		name:      qsGetServersNear,
+		notFilter: true,
+	},
+	querystring{
+		name:      qsGetServersRadius,
+		notFilter: true,
+	},
 }
 
 // getQStringValues takes the map returned by a *http.Request URL.Query(),
@@ -167,3 +370,14 @@ func getQStringValues(m map[string][]string, querystring string) []string {
 	}
 	return vals
 }
+
+// getQStringRawValue returns the unsplit value of a query string key, matched
+// without regard to case, or an empty string if the key is not present.
+func getQStringRawValue(m map[string][]string, querystring string) string {
+	for k := range m {
+		if strings.EqualFold(k, querystring) && len(m[k]) > 0 {
+			return m[k][0]
+		}
+	}
+	return ""
+}
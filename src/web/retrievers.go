@@ -5,6 +5,7 @@ package web
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 
 	"github.com/syncore/a2sapi/src/db"
 	"github.com/syncore/a2sapi/src/logger"
@@ -70,3 +71,57 @@ func queryServerAddrRetriever(w http.ResponseWriter, addresses []string) {
 		writeJSONEncodeError(w, err)
 	}
 }
+
+func pingRetriever(w http.ResponseWriter, ids []string) {
+	s := make(chan map[string]string, 1)
+	db.ServerDB.GetHostsAndGameFromIDAPIQuery(s, ids)
+	hostsgames := <-s
+	pl := models.GetDefaultPingList()
+	if len(hostsgames) == 0 {
+		writeJSONResponse(w, pl)
+		return
+	}
+	result := make(chan map[string]int64, 1)
+	go db.ServerDB.GetIDsForServerList(result, hostsgames)
+	hostids := <-result
+
+	hosts := make([]string, 0, len(hostsgames))
+	for h := range hostsgames {
+		hosts = append(hosts, h)
+	}
+	rtts := steam.Ping(hosts)
+	for _, h := range hosts {
+		if len(rtts[h]) == 0 {
+			pl.FailedServers = append(pl.FailedServers, h)
+			continue
+		}
+		pl.Servers = append(pl.Servers, models.APIServerPing{
+			ID:          hostids[h],
+			Host:        h,
+			Game:        hostsgames[h],
+			Ping:        steam.MedianRTTMillis(rtts[h]),
+			PingSamples: steam.RTTMillis(rtts[h]),
+		})
+	}
+	sort.Slice(pl.Servers, func(i, j int) bool {
+		return pl.Servers[i].Ping < pl.Servers[j].Ping
+	})
+	sort.Strings(pl.FailedServers)
+	pl.ServerCount, pl.FailedCount = len(pl.Servers), len(pl.FailedServers)
+	writeJSONResponse(w, pl)
+}
+
+func historyRetriever(w http.ResponseWriter, q db.HistoryQuery) {
+	hl, err := db.HistoryDB.GetHistory(q)
+	if err != nil {
+		setNotFoundAndLog(w, err)
+		if err := json.NewEncoder(w).Encode(models.GetDefaultHistoryList()); err != nil {
+			writeJSONEncodeError(w, err)
+		}
+		return
+	}
+	if err := json.NewEncoder(w).Encode(hl); err != nil {
+		writeJSONEncodeError(w, err)
+		logger.LogWebError(err)
+	}
+}
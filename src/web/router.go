@@ -17,10 +17,17 @@ import (
 func newRouter() *mux.Router {
 	r := mux.NewRouter().StrictSlash(true)
 	for _, ar := range apiRoutes {
-		handler := http.TimeoutHandler(compressGzip(ar.handlerFunc, config.Config.WebConfig.CompressResponses),
-			time.Duration(config.Config.WebConfig.APIWebTimeout)*time.Second,
-			`{"error": {"code": 503,"message": "Request timeout."}}`)
+		var handler http.Handler = ar.handlerFunc
+		if !ar.stream {
+			handler = http.TimeoutHandler(compressGzip(ar.handlerFunc, config.Config.WebConfig.CompressResponses),
+				time.Duration(config.Config.WebConfig.APIWebTimeout)*time.Second,
+				`{"error": {"code": 503,"message": "Request timeout."}}`)
+		}
+		if ar.admin {
+			handler = requireAPIKey(handler)
+		}
 		handler = logger.LogWebRequest(handler, ar.name)
+		handler = instrumentRoute(handler, ar.name)
 
 		r.Methods(ar.method).
 			MatcherFunc(pathQStrToLowerMatcherFunc(r, ar.path, ar.queryStrings,
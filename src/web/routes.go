@@ -10,6 +10,10 @@ type route struct {
 	path         string
 	queryStrings []querystring
 	handlerFunc  http.HandlerFunc
+	// streaming responses are neither compressed nor timed out
+	stream bool
+	// requires the admin API key
+	admin bool
 }
 
 var apiRoutes = []route{
@@ -21,6 +25,34 @@ var apiRoutes = []route{
 		queryStrings: getServersQueryStrings,
 		handlerFunc:  getServers,
 	},
+	// serverIDs - not seen in the retention period; before /serverIDs, which it
+	// is prefixed by
+	route{
+		name:         "GetStaleServerIDs",
+		method:       "GET",
+		path:         "/serverIDs/stale",
+		queryStrings: staleServerIDQueryStrings,
+		handlerFunc:  getStaleServerIDs,
+		admin:        true,
+	},
+	// serverIDs - retire
+	route{
+		name:         "RetireServerIDs",
+		method:       "POST",
+		path:         "/serverIDs/retire",
+		queryStrings: retireServerIDQueryStrings,
+		handlerFunc:  retireServerIDs,
+		admin:        true,
+	},
+	// serverIDs - merge
+	route{
+		name:         "MergeServerID",
+		method:       "POST",
+		path:         "/serverIDs/merge",
+		queryStrings: mergeServerIDQueryStrings,
+		handlerFunc:  mergeServerID,
+		admin:        true,
+	},
 	// serverID
 	route{
 		name:         "GetServerIDs",
@@ -45,4 +77,125 @@ var apiRoutes = []route{
 		queryStrings: queryServerAddrQueryStrings,
 		handlerFunc:  queryServerAddrs,
 	},
+	// ping - by ID
+	route{
+		name:         "GetPing",
+		method:       "GET",
+		path:         "/ping",
+		queryStrings: pingQueryStrings,
+		handlerFunc:  getPing,
+	},
+	// history
+	route{
+		name:         "GetHistory",
+		method:       "GET",
+		path:         "/history",
+		queryStrings: historyQueryStrings,
+		handlerFunc:  getHistory,
+	},
+	// players
+	route{
+		name:         "GetPlayers",
+		method:       "GET",
+		path:         "/players",
+		queryStrings: playersQueryStrings,
+		handlerFunc:  getPlayers,
+	},
+	// events - SSE or WebSocket
+	route{
+		name:         "GetEvents",
+		method:       "GET",
+		path:         "/events",
+		queryStrings: getServersQueryStrings,
+		handlerFunc:  getEvents,
+		stream:       true,
+	},
+	// metrics - Prometheus text format
+	route{
+		name:        "GetMetrics",
+		method:      "GET",
+		path:        "/metrics",
+		handlerFunc: getMetrics,
+	},
+	// health - process is alive
+	route{
+		name:        "GetHealth",
+		method:      "GET",
+		path:        "/healthz",
+		handlerFunc: getHealth,
+	},
+	// readiness - databases are open and the master lists are current
+	route{
+		name:        "GetReadiness",
+		method:      "GET",
+		path:        "/readyz",
+		handlerFunc: getReadiness,
+	},
+	// status - version, uptime, retrievals and effective configuration
+	route{
+		name:        "GetStatus",
+		method:      "GET",
+		path:        "/status",
+		handlerFunc: getStatus,
+	},
+	// webhooks - failed deliveries; before /webhooks, which it is prefixed by
+	route{
+		name:         "GetWebhookDeadLetters",
+		method:       "GET",
+		path:         "/webhooks/deadletters",
+		queryStrings: webhookDeadLetterQueryStrings,
+		handlerFunc:  getWebhookDeadLetters,
+		admin:        true,
+	},
+	// webhooks - list
+	route{
+		name:        "GetWebhooks",
+		method:      "GET",
+		path:        "/webhooks",
+		handlerFunc: getWebhooks,
+		admin:       true,
+	},
+	// webhooks - create
+	route{
+		name:        "CreateWebhook",
+		method:      "POST",
+		path:        "/webhooks",
+		handlerFunc: createWebhook,
+		admin:       true,
+	},
+	// webhooks - update
+	route{
+		name:         "UpdateWebhook",
+		method:       "PUT",
+		path:         "/webhooks",
+		queryStrings: webhookIDQueryStrings,
+		handlerFunc:  updateWebhook,
+		admin:        true,
+	},
+	// webhooks - delete
+	route{
+		name:         "DeleteWebhook",
+		method:       "DELETE",
+		path:         "/webhooks",
+		queryStrings: webhookIDQueryStrings,
+		handlerFunc:  deleteWebhook,
+		admin:        true,
+	},
+	// log level - current
+	route{
+		name:        "GetLogLevel",
+		method:      "GET",
+		path:        "/logLevel",
+		handlerFunc: getLogLevel,
+		admin:       true,
+	},
+	// log level - change at runtime
+	route{
+		name:         "SetLogLevel",
+		method:       "PUT",
+		path:         "/logLevel",
+		queryStrings: logLevelQueryStrings,
+		handlerFunc:  setLogLevel,
+		admin:        true,
+	},
 }
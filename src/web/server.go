@@ -15,6 +15,7 @@ import (
 // if unable to start.
 func Start(runSilent bool) {
 	r := newRouter()
+	startWebhooks()
 
 	if !runSilent {
 		printStartInfo()
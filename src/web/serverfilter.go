@@ -4,6 +4,7 @@ package web
 // string data.
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/syncore/a2sapi/src/models"
@@ -15,7 +16,7 @@ func getSrvFilterFromQString(m map[string][]string, qs []querystring) []slQueryF
 	var qfilters []slQueryFilter
 	for key := range m {
 		for _, q := range qs {
-			if strings.EqualFold(key, q.name) {
+			if strings.EqualFold(key, q.name) && !q.notFilter {
 				vals := getQStringValues(m, key)
 				if len(vals) > 0 {
 					qfilters = append(qfilters, slQueryFilter{name: q.name,
@@ -27,6 +28,22 @@ func getSrvFilterFromQString(m map[string][]string, qs []querystring) []slQueryF
 	return qfilters
 }
 
+// invalidNumericFilter returns the name of the first numeric key in the query
+// string whose value is not a number, or an empty string if there is none.
+func invalidNumericFilter(m map[string][]string, qs []querystring) string {
+	for _, q := range qs {
+		if !q.numeric {
+			continue
+		}
+		for _, v := range getQStringValues(m, q.name) {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return q.name
+			}
+		}
+	}
+	return ""
+}
+
 func findMatches(sqf slQueryFilter,
 	servers []models.APIServer) []models.APIServer {
 	var matched []models.APIServer
@@ -34,6 +51,8 @@ func findMatches(sqf slQueryFilter,
 	bsearcht, bsearchf, useContains := false, false, false
 
 	for _, srv := range servers {
+		// secondary value to search, if any
+		altsearch := ""
 		switch sqf.name {
 		// location-based
 		case qsGetServersRegion:
@@ -50,7 +69,9 @@ func findMatches(sqf slQueryFilter,
 			useContains = true
 			ssearch = srv.Info.Map
 		case qsGetServersGame:
+			// game name (i.e. QuakeLive) or A2S_INFO game description
 			ssearch = srv.Info.Game
+			altsearch = srv.Game
 		case qsGetServersGameType:
 			ssearch = srv.Info.GameTypeShort
 		case qsGetServersType:
@@ -86,6 +107,21 @@ func findMatches(sqf slQueryFilter,
 			} else {
 				bsearchf = srv.Info.Visibility == 0
 			}
+		case qsGetServersMaxPing:
+			// servers whose ping is not known (0) never match
+			max, err := strconv.ParseFloat(sqf.values[0], 64)
+			if err == nil && srv.Ping > 0 && srv.Ping <= max {
+				matched = append(matched, srv)
+			}
+			continue
+		case qsGetServersMinReliability:
+			// servers that have not been checked never match
+			min, err := strconv.ParseFloat(sqf.values[0], 64)
+			if err == nil && srv.Reliability.Checks > 0 &&
+				srv.Reliability.Availability >= min {
+				matched = append(matched, srv)
+			}
+			continue
 		case qsGetServersHasAntiCheat:
 			if strings.EqualFold(sqf.values[0], "true") {
 				bsearcht = srv.Info.VAC == 1
@@ -107,7 +143,8 @@ func findMatches(sqf slQueryFilter,
 						matched = append(matched, srv)
 					}
 				} else {
-					if strings.EqualFold(ssearch, val) {
+					if strings.EqualFold(ssearch, val) ||
+						(altsearch != "" && strings.EqualFold(altsearch, val)) {
 						matched = append(matched, srv)
 					}
 				}
@@ -137,8 +174,11 @@ func filterServers(sqf []slQueryFilter,
 	return &models.APIServerList{
 		RetrievedAt:        a.RetrievedAt,
 		RetrievedTimeStamp: a.RetrievedTimeStamp,
+		Generation:         a.Generation,
+		DataAge:            a.DataAge,
 		Servers:            filtered,
 		ServerCount:        len(filtered),
+		TotalCount:         len(filtered),
 		FailedCount:        0,
 		FailedServers:      make([]string, 0),
 	}
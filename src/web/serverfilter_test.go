@@ -149,3 +149,81 @@ func TestFilterServers(t *testing.T) {
 		}
 	}
 }
+
+func TestFindMatchesGame(t *testing.T) {
+	servers := []models.APIServer{
+		models.APIServer{Game: "QuakeLive",
+			Info: models.SteamServerInfo{Game: "Clan Arena"}},
+		models.APIServer{Game: "Reflex",
+			Info: models.SteamServerInfo{Game: "Reflex"}},
+	}
+	// game name
+	matches := findMatches(slQueryFilter{name: qsGetServersGame,
+		values: []string{"quakelive"}}, servers)
+	if len(matches) != 1 {
+		t.Fatalf("Expected 1 match, got: %d", len(matches))
+	}
+	// A2S_INFO game description
+	matches = findMatches(slQueryFilter{name: qsGetServersGame,
+		values: []string{"clan arena"}}, servers)
+	if len(matches) != 1 {
+		t.Fatalf("Expected 1 match, got: %d", len(matches))
+	}
+}
+
+func TestFindMatchesMaxPing(t *testing.T) {
+	servers := []models.APIServer{
+		models.APIServer{ID: 1, Ping: 12.5},
+		models.APIServer{ID: 2, Ping: 80},
+		// not measured
+		models.APIServer{ID: 3},
+	}
+	tests := []struct {
+		max string
+		ids []int64
+	}{
+		{"50", []int64{1}},
+		{"80", []int64{1, 2}},
+		{"5", nil},
+		{"fast", nil},
+	}
+	for _, tt := range tests {
+		matched := findMatches(slQueryFilter{name: qsGetServersMaxPing,
+			values: []string{tt.max}}, servers)
+		var ids []int64
+		for _, s := range matched {
+			ids = append(ids, s.ID)
+		}
+		if len(ids) != len(tt.ids) {
+			t.Errorf("Expected maxPing=%s to match %v, got: %v", tt.max, tt.ids, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.ids[i] {
+				t.Errorf("Expected maxPing=%s to match %v, got: %v", tt.max, tt.ids,
+					ids)
+				break
+			}
+		}
+	}
+}
+
+func TestFindMatchesMinReliability(t *testing.T) {
+	servers := []models.APIServer{
+		models.APIServer{ID: 1, Reliability: models.ServerReliability{Checks: 10,
+			Responses: 10, Availability: 100}},
+		models.APIServer{ID: 2, Reliability: models.ServerReliability{Checks: 4,
+			Responses: 3, Availability: 75}},
+		// not checked yet
+		models.APIServer{ID: 3},
+	}
+	tests := map[string]int{"90": 1, "75": 2, "0": 2, "reliable": 0}
+	for min, count := range tests {
+		matched := findMatches(slQueryFilter{name: qsGetServersMinReliability,
+			values: []string{min}}, servers)
+		if len(matched) != count {
+			t.Errorf("Expected minReliability=%s to match %d servers, got: %d", min,
+				count, len(matched))
+		}
+	}
+}
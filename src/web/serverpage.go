@@ -0,0 +1,349 @@
+package web
+
+// serverpage.go - distance, sorting, paging and field selection of the server
+// list
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+// maxServerPageSize is the largest number of servers that can be requested per
+// page.
+const maxServerPageSize = 1000
+
+// pageError is an error in the sorting, paging or field selection of a request
+// and the status code that it should be responded to with.
+type pageError struct {
+	code int
+	msg  string
+}
+
+func (e *pageError) Error() string { return e.msg }
+
+func badPageRequest(format string, a ...interface{}) *pageError {
+	return &pageError{http.StatusBadRequest, fmt.Sprintf(format, a...)}
+}
+
+type sortKey struct {
+	field filterField
+	desc  bool
+	// set for sorting by the distance from the near location
+	distance bool
+}
+
+// serverPage is the distance, sorting, paging and field selection of a /servers
+// request.
+type serverPage struct {
+	near     *geoPoint
+	radiusKm float64
+	sort     []sortKey
+	offset   int
+	// zero if the list is not paged
+	limit  int
+	fields []string
+}
+
+// getServerPage reads the distance, sorting, paging and field selection from the
+// query string. A near value of "me" is the location of the caller's IP. Cursors
+// are only valid for the generation of the list that they were created for.
+func getServerPage(m map[string][]string, generation uint64,
+	caller string) (serverPage, *pageError) {
+	var p serverPage
+	if vals := getQStringValues(m, qsGetServersNear); vals != nil {
+		var near geoPoint
+		var ok bool
+		if len(vals) == 1 && strings.EqualFold(vals[0], nearCaller) {
+			if near, ok = locateCaller(caller); !ok {
+				return p, badPageRequest("Unable to determine your location.")
+			}
+		} else if near, ok = parseGeoPoint(vals); !ok {
+			return p, badPageRequest(
+				"The %s parameter must be a latitude and longitude, or %s.",
+				qsGetServersNear, nearCaller)
+		}
+		p.near = &near
+	}
+	if vals := getQStringValues(m, qsGetServersRadius); vals != nil {
+		r, err := strconv.ParseFloat(vals[0], 64)
+		if err != nil || r <= 0 {
+			return p, badPageRequest("The %s parameter must be a positive distance.",
+				qsGetServersRadius)
+		}
+		if p.near == nil {
+			return p, badPageRequest("The %s parameter requires %s.",
+				qsGetServersRadius, qsGetServersNear)
+		}
+		p.radiusKm = r
+	}
+	for _, v := range getQStringValues(m, qsGetServersSort) {
+		name, dir := v, ""
+		if i := strings.LastIndex(v, ":"); i != -1 {
+			name, dir = v[:i], strings.ToLower(v[i+1:])
+		}
+		if dir != "" && dir != "asc" && dir != "desc" {
+			return p, badPageRequest("Sort direction of %s must be asc or desc.",
+				name)
+		}
+		if strings.EqualFold(name, distanceSortField) {
+			if p.near == nil {
+				return p, badPageRequest("Sorting by %s requires %s.",
+					distanceSortField, qsGetServersNear)
+			}
+			p.sort = append(p.sort, sortKey{distance: true, desc: dir == "desc"})
+			continue
+		}
+		f, ok := lookupFilterField(name)
+		if !ok {
+			return p, badPageRequest("Unknown sort field: %s", name)
+		}
+		p.sort = append(p.sort, sortKey{field: f, desc: dir == "desc"})
+	}
+	if vals := getQStringValues(m, qsGetServersLimit); vals != nil {
+		l, err := strconv.Atoi(vals[0])
+		if err != nil || l < 1 || l > maxServerPageSize {
+			return p, badPageRequest("The %s parameter must be between 1 and %d.",
+				qsGetServersLimit, maxServerPageSize)
+		}
+		p.limit = l
+	}
+	offsets := getQStringValues(m, qsGetServersOffset)
+	if offsets != nil {
+		o, err := strconv.Atoi(offsets[0])
+		if err != nil || o < 0 {
+			return p, badPageRequest("The %s parameter must not be negative.",
+				qsGetServersOffset)
+		}
+		p.offset = o
+	}
+	if c := getQStringRawValue(m, qsGetServersCursor); c != "" {
+		if offsets != nil {
+			return p, badPageRequest("The %s and %s parameters cannot be combined.",
+				qsGetServersCursor, qsGetServersOffset)
+		}
+		gen, offset, limit, err := decodeServerCursor(c)
+		if err != nil {
+			return p, badPageRequest("Invalid cursor.")
+		}
+		if gen != generation {
+			return p, &pageError{http.StatusGone,
+				"The server list has been updated since the cursor was created."}
+		}
+		p.offset = offset
+		if p.limit == 0 {
+			p.limit = limit
+		}
+	}
+	for _, v := range getQStringValues(m, qsGetServersFields) {
+		if !isServerField(v) {
+			return p, badPageRequest("Unknown field: %s", v)
+		}
+		p.fields = append(p.fields, v)
+	}
+	return p, nil
+}
+
+// The cursor is the generation, offset and limit, base64-encoded.
+func encodeServerCursor(generation uint64, offset, limit int) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%d:%d:%d", generation, offset, limit)))
+}
+
+func decodeServerCursor(c string) (generation uint64, offset, limit int,
+	err error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("malformed cursor")
+	}
+	if generation, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, 0, 0, err
+	}
+	if offset, err = strconv.Atoi(parts[1]); err != nil || offset < 0 {
+		return 0, 0, 0, fmt.Errorf("malformed cursor")
+	}
+	if limit, err = strconv.Atoi(parts[2]); err != nil || limit < 1 ||
+		limit > maxServerPageSize {
+		return 0, 0, 0, fmt.Errorf("malformed cursor")
+	}
+	return generation, offset, limit, nil
+}
+
+// isServerField determines whether the dot-separated path is a field of an
+// APIServer, by JSON name, or one of its rules.
+func isServerField(path string) bool {
+	lpath := strings.ToLower(path)
+	if strings.HasPrefix(lpath, "rules.") && len(path) > len("rules.") {
+		return true
+	}
+	_, _, ok := resolveJSONPath(reflect.TypeOf(models.APIServer{}), path)
+	return ok
+}
+
+// compareValues orders two values of a field: numerically, case-insensitively
+// for strings (numerically if both strings are numbers) and false before true.
+func compareValues(a, b filterValue) int {
+	if a.kind == kindString {
+		an, aerr := strconv.ParseFloat(a.str, 64)
+		bn, berr := strconv.ParseFloat(b.str, 64)
+		if aerr == nil && berr == nil {
+			a, b = filterValue{kind: kindNumber, num: an},
+				filterValue{kind: kindNumber, num: bn}
+		}
+	}
+	switch a.kind {
+	case kindNumber:
+		switch {
+		case a.num < b.num:
+			return -1
+		case a.num > b.num:
+			return 1
+		}
+		return 0
+	case kindBool:
+		switch {
+		case a.b == b.b:
+			return 0
+		case !a.b:
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(strings.ToLower(a.str), strings.ToLower(b.str))
+}
+
+// value returns the server's value of the key's field. Returns false if the
+// server does not have the field (i.e. the rule or its coordinates).
+func (k sortKey) value(s *models.APIServer) (filterValue, bool) {
+	if k.distance {
+		return filterValue{kind: kindNumber, num: s.DistanceKm},
+			s.CountryInfo.HasCoordinates
+	}
+	return k.field.value(s)
+}
+
+// sortServers sorts the servers by each of the keys in turn, keeping the order of
+// servers that compare equal. Servers without a value (i.e. the rule) are sorted
+// last in either direction.
+func sortServers(keys []sortKey, servers []models.APIServer) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(servers, func(i, j int) bool {
+		for _, k := range keys {
+			a, aok := k.value(&servers[i])
+			b, bok := k.value(&servers[j])
+			if !aok || !bok {
+				if aok != bok {
+					return aok
+				}
+				continue
+			}
+			c := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// apply filters the list by distance, sorts and pages it, returning a new list
+// with the total count and the offset and cursor of the next page, if there is
+// one. The servers of the list are filtered and sorted in place.
+func (p serverPage) apply(a *models.APIServerList) *models.APIServerList {
+	sl := *a
+	if p.near != nil {
+		sl.Servers = filterServersByDistance(*p.near, p.radiusKm, sl.Servers)
+	}
+	sortServers(p.sort, sl.Servers)
+	sl.TotalCount = len(sl.Servers)
+	if p.offset > 0 || p.limit > 0 {
+		start := p.offset
+		if start > len(sl.Servers) {
+			start = len(sl.Servers)
+		}
+		end := len(sl.Servers)
+		if p.limit > 0 && start+p.limit < end {
+			end = start + p.limit
+			sl.NextOffset = end
+			sl.NextCursor = encodeServerCursor(sl.Generation, end, p.limit)
+		}
+		sl.Servers = sl.Servers[start:end]
+	}
+	sl.ServerCount = len(sl.Servers)
+	return &sl
+}
+
+// projectedServerList is a server list with only the selected fields of each
+// server.
+type projectedServerList struct {
+	*models.APIServerList
+	Servers []map[string]interface{} `json:"servers"`
+}
+
+// project returns the list with only the selected fields of its servers, or the
+// list itself if no fields were selected.
+func (p serverPage) project(a *models.APIServerList) (interface{}, error) {
+	if len(p.fields) == 0 {
+		return a, nil
+	}
+	pl := projectedServerList{APIServerList: a,
+		Servers: make([]map[string]interface{}, 0, len(a.Servers))}
+	for _, s := range a.Servers {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		var full map[string]interface{}
+		if err := json.Unmarshal(b, &full); err != nil {
+			return nil, err
+		}
+		projected := make(map[string]interface{})
+		for _, f := range p.fields {
+			copyJSONPath(full, projected, strings.Split(f, "."))
+		}
+		pl.Servers = append(pl.Servers, projected)
+	}
+	return pl, nil
+}
+
+// copyJSONPath copies the value at the path (matched without regard to case)
+// from src to the same path in dst, creating the objects along the path.
+func copyJSONPath(src, dst map[string]interface{}, path []string) {
+	for k, v := range src {
+		if !strings.EqualFold(k, path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			dst[k] = v
+			return
+		}
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		sub, ok := dst[k].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			dst[k] = sub
+		}
+		copyJSONPath(child, sub, path[1:])
+		return
+	}
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/syncore/a2sapi/src/models"
+)
+
+func newTestPageList() *models.APIServerList {
+	servers := make([]models.APIServer, len(testExprServers))
+	copy(servers, testExprServers)
+	return &models.APIServerList{Generation: 7, Servers: servers,
+		ServerCount: len(servers), TotalCount: len(servers)}
+}
+
+func serverIDs(servers []models.APIServer) []int64 {
+	ids := make([]int64, 0, len(servers))
+	for _, s := range servers {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func TestServerPageSort(t *testing.T) {
+	tests := []struct {
+		sort string
+		ids  []int64
+	}{
+		{"players", []int64{2, 3, 1}},
+		{"info.players:desc", []int64{1, 3, 2}},
+		{"game:desc,maxPlayers", []int64{3, 2, 1}},
+		{"location.countryCode", []int64{3, 2, 1}},
+		{"hasPassword:desc,serverID:desc", []int64{2, 3, 1}},
+		// servers without the rule are last in either direction
+		{"rules.g_gametype", []int64{2, 1, 3}},
+		{"rules.g_gametype:desc", []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		p, perr := getServerPage(url.Values{"sort": {tt.sort}}, 7, "")
+		if perr != nil {
+			t.Errorf("Unexpected error for sort %s: %s", tt.sort, perr)
+			continue
+		}
+		sl := p.apply(newTestPageList())
+		if ids := serverIDs(sl.Servers); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("Expected sort %s to order servers %v; got: %v", tt.sort,
+				tt.ids, ids)
+		}
+	}
+}
+
+func TestServerPagePaging(t *testing.T) {
+	p, perr := getServerPage(url.Values{"sort": {"serverID"}, "limit": {"2"}}, 7,
+		"")
+	if perr != nil {
+		t.Fatalf("Unexpected error: %s", perr)
+	}
+	sl := p.apply(newTestPageList())
+	if ids := serverIDs(sl.Servers); !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Fatalf("Expected servers [1 2] on the first page; got: %v", ids)
+	}
+	if sl.ServerCount != 2 || sl.TotalCount != 3 || sl.NextOffset != 2 ||
+		sl.NextCursor == "" {
+		t.Fatalf("Unexpected paging of the first page: %+v", sl)
+	}
+	p, perr = getServerPage(url.Values{"sort": {"serverID"},
+		"cursor": {sl.NextCursor}}, 7, "")
+	if perr != nil {
+		t.Fatalf("Unexpected error for cursor: %s", perr)
+	}
+	sl = p.apply(newTestPageList())
+	if ids := serverIDs(sl.Servers); !reflect.DeepEqual(ids, []int64{3}) {
+		t.Fatalf("Expected servers [3] on the second page; got: %v", ids)
+	}
+	if sl.TotalCount != 3 || sl.NextOffset != 0 || sl.NextCursor != "" {
+		t.Fatalf("Unexpected paging of the last page: %+v", sl)
+	}
+	p, _ = getServerPage(url.Values{"offset": {"5"}}, 7, "")
+	if sl = p.apply(newTestPageList()); len(sl.Servers) != 0 ||
+		sl.TotalCount != 3 {
+		t.Fatalf("Expected an empty page past the end; got: %+v", sl)
+	}
+	cursor := encodeServerCursor(6, 2, 2)
+	if _, perr = getServerPage(url.Values{"cursor": {cursor}}, 7,
+		""); perr == nil || perr.code != http.StatusGone {
+		t.Fatalf("Expected a stale cursor to be gone; got: %v", perr)
+	}
+}
+
+func TestServerPageErrors(t *testing.T) {
+	invalid := []url.Values{
+		{"sort": {"nosuchfield"}},
+		{"sort": {"players:up"}},
+		{"limit": {"0"}},
+		{"limit": {"1001"}},
+		{"limit": {"ten"}},
+		{"offset": {"-1"}},
+		{"cursor": {"not a cursor"}},
+		{"cursor": {encodeServerCursor(7, 2, 2)}, "offset": {"2"}},
+		{"fields": {"info.nosuchfield"}},
+	}
+	for _, v := range invalid {
+		if _, perr := getServerPage(v, 7, ""); perr == nil ||
+			perr.code != http.StatusBadRequest {
+			t.Errorf("Expected %v to be a bad request; got: %v", v, perr)
+		}
+	}
+}
+
+func TestServerPageFields(t *testing.T) {
+	p, perr := getServerPage(url.Values{
+		"fields": {"serverID,address,info.map,INFO.players,rules.g_gametype"}}, 7, "")
+	if perr != nil {
+		t.Fatalf("Unexpected error: %s", perr)
+	}
+	list := newTestPageList()
+	list.Servers = list.Servers[:1]
+	projected, err := p.project(list)
+	if err != nil {
+		t.Fatalf("Unexpected error projecting fields: %s", err)
+	}
+	b, err := json.Marshal(projected)
+	if err != nil {
+		t.Fatalf("Unable to encode projected list: %s", err)
+	}
+	var decoded struct {
+		TotalCount int                      `json:"totalCount"`
+		Servers    []map[string]interface{} `json:"servers"`
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Unable to decode projected list: %s", err)
+	}
+	expected := map[string]interface{}{
+		"serverID": float64(1),
+		"address":  "10.0.0.1:27960",
+		"info":     map[string]interface{}{"map": "campgrounds", "players": float64(6)},
+		"rules":    map[string]interface{}{"g_gametype": "4"},
+	}
+	if len(decoded.Servers) != 1 || !reflect.DeepEqual(decoded.Servers[0],
+		expected) {
+		t.Fatalf("Expected projected server %v; got: %v", expected, decoded.Servers)
+	}
+	if decoded.TotalCount != 3 {
+		t.Fatalf("Expected the total count to be kept; got: %d", decoded.TotalCount)
+	}
+}
+
+func TestGetServersPageError(t *testing.T) {
+	r, _ := http.NewRequest("GET", formatURL("servers?limit=-1"), nil)
+	w := newRecorder()
+	getServers(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %v for invalid limit; got: %v",
+			http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,162 @@
+package web
+
+// stream.go - streaming of master server list events over server-sent events
+// (SSE) and WebSockets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/syncore/a2sapi/src/events"
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// retrievals whose events are buffered for a stream before it is dropped for
+	// falling behind
+	streamBufferSize = 16
+	// keeps idle connections from being closed by proxies
+	streamPingInterval = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	// the API is meant to be used by frontends on other origins
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// getEvents streams the events of the timed master server retrievals for the
+// servers that match the same filters as getServers. Requests to upgrade the
+// connection are streamed over a WebSocket, all others over SSE.
+func getEvents(w http.ResponseWriter, r *http.Request) {
+	if name := invalidNumericFilter(r.URL.Query(),
+		getServersQueryStrings); name != "" {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		writeErrorResponse(w, http.StatusBadRequest,
+			fmt.Sprintf("The %s parameter must be a number.", name))
+		return
+	}
+	srvfilters := getSrvFilterFromQString(r.URL.Query(), getServersQueryStrings)
+	logger.WriteDebug("events will be filtered with: %v", srvfilters)
+	sub := events.Stream.Subscribe(streamBufferSize, func(e events.Event) bool {
+		return matchesFilters(srvfilters, e.Server)
+	})
+	defer events.Stream.Unsubscribe(sub)
+
+	if websocket.IsWebSocketUpgrade(r) {
+		streamWebSocket(w, r, sub)
+		return
+	}
+	streamSSE(w, r, sub)
+}
+
+// matchesFilters determines whether the server matches every one of the filters.
+func matchesFilters(sqf []slQueryFilter, srv models.APIServer) bool {
+	for _, s := range sqf {
+		if len(findMatches(s, []models.APIServer{srv})) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func streamSSE(w http.ResponseWriter, r *http.Request, sub *events.Subscription) {
+	rc := http.NewResponseController(w)
+	write := func(format string, a ...interface{}) error {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, a...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := write(": connected\n\n"); err != nil {
+		logger.FromRequest(r).Error(err.Error())
+		return
+	}
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case batch, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					write("event: dropped\ndata: {}\n\n")
+				}
+				return
+			}
+			for _, e := range batch {
+				data, err := json.Marshal(e)
+				if err != nil {
+					logger.FromRequest(r).Error(err.Error())
+					continue
+				}
+				if err := write("event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+					return
+				}
+			}
+		case <-ping.C:
+			if err := write(": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func streamWebSocket(w http.ResponseWriter, r *http.Request,
+	sub *events.Subscription) {
+	// Upgrade replies to the client on failure
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.FromRequest(r).Error(err.Error())
+		return
+	}
+	defer conn.Close()
+	// the client does not send anything; reading detects that it went away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case batch, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseTryAgainLater,
+							"dropped"), time.Now().Add(streamWriteTimeout))
+				}
+				return
+			}
+			for _, e := range batch {
+				conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+				if err := conn.WriteJSON(e); err != nil {
+					return
+				}
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil,
+				time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/syncore/a2sapi/src/events"
+	"github.com/syncore/a2sapi/src/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// publishWhenSubscribed publishes the changes of a busy retrieval, once the
+// stream has subscribed: thousands of events for a server that does not match
+// the test's filters, followed by one for a server that does.
+func publishWhenSubscribed(t *testing.T) {
+	deadline := time.Now().Add(2 * time.Second)
+	for events.Stream.Subscribers() == 0 {
+		if time.Now().After(deadline) {
+			t.Errorf("Stream did not subscribe")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	burst := make([]events.Event, 0, 5001)
+	for i := 0; i < 5000; i++ {
+		burst = append(burst, events.Event{Type: events.MapChanged,
+			Server: models.APIServer{Host: "10.0.0.1:27960",
+				Info: models.SteamServerInfo{Map: "bloodrun"}}})
+	}
+	events.Stream.Publish(append(burst, events.Event{Type: events.MapChanged,
+		Server: models.APIServer{Host: "10.0.0.2:27960",
+			Info: models.SteamServerInfo{Map: "campgrounds"}}}))
+}
+
+func TestGetEventsSSE(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(getEvents))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/events?maps=camp")
+	if err != nil {
+		t.Fatalf("Unable to connect to event stream: %s", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream content type, got: %s", ct)
+	}
+	go publishWhenSubscribed(t)
+	r := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unable to read event stream: %s", err)
+		}
+		if line == "\n" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if lines[0] != "event: mapChanged" {
+		t.Fatalf("Expected mapChanged event, got: %s", lines[0])
+	}
+	e := events.Event{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")),
+		&e); err != nil {
+		t.Fatalf("Unable to decode event: %s", err)
+	}
+	if e.Server.Host != "10.0.0.2:27960" {
+		t.Fatalf("Expected only the event of the filtered server, got: %+v", e)
+	}
+}
+
+func TestGetEventsWebSocket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(getEvents))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(srv.URL, "http")+"/events?maps=camp", nil)
+	if err != nil {
+		t.Fatalf("Unable to connect to event WebSocket: %s", err)
+	}
+	defer conn.Close()
+	go publishWhenSubscribed(t)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	e := events.Event{}
+	if err := conn.ReadJSON(&e); err != nil {
+		t.Fatalf("Unable to read event: %s", err)
+	}
+	if e.Type != events.MapChanged || e.Server.Host != "10.0.0.2:27960" {
+		t.Fatalf("Expected only the event of the filtered server, got: %+v", e)
+	}
+}
+
+func TestGetEventsInvalidFilter(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/events?maxPing=abc", nil)
+	w := httptest.NewRecorder()
+	getEvents(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected invalid filter to be refused, got: %d %s", w.Code,
+			w.Body.Bytes())
+	}
+}
@@ -0,0 +1,268 @@
+package web
+
+// webhooks.go - evaluation of the webhook rules after each timed retrieval and
+// delivery of the signed webhook requests
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/events"
+	"github.com/syncore/a2sapi/src/logger"
+	"github.com/syncore/a2sapi/src/models"
+	"github.com/syncore/a2sapi/src/steam"
+)
+
+const (
+	webhookQueueSize = 1024
+	webhookWorkers   = 4
+	// hex-encoded HMAC-SHA256 of the timestamp, a period and the body, using the
+	// rule's secret
+	webhookSignatureHeader = "X-A2SAPI-Signature"
+	webhookTimestampHeader = "X-A2SAPI-Timestamp"
+)
+
+// webhookRetryPolicy determines how failed webhook deliveries are re-tried.
+var webhookRetryPolicy = steam.RetryPolicy{
+	MaxAttempts:       5,
+	InitialTimeout:    10 * time.Second,
+	MaxTimeout:        10 * time.Second,
+	TimeoutMultiplier: 1,
+	InitialBackoff:    time.Second,
+	MaxBackoff:        time.Minute,
+	BackoffMultiplier: 4,
+	Jitter:            0.2,
+}
+
+type webhookDelivery struct {
+	rule models.WebhookRule
+	body []byte
+}
+
+// webhookDispatcher queues the deliveries of the rules that fired and posts them
+// from a fixed number of workers.
+type webhookDispatcher struct {
+	queue  chan webhookDelivery
+	client *http.Client
+	policy steam.RetryPolicy
+}
+
+// webhookMatcher determines whether servers match a webhook rule.
+type webhookMatcher struct {
+	ids        map[int64]bool
+	minPlayers int
+	filters    []slQueryFilter
+}
+
+// startWebhooks starts the webhook workers and evaluates the webhook rules after
+// each timed retrieval.
+func startWebhooks() {
+	d := newWebhookDispatcher(webhookRetryPolicy, webhookWorkers)
+	events.AddListListener(d.evaluate)
+}
+
+func newWebhookDispatcher(policy steam.RetryPolicy,
+	workers int) *webhookDispatcher {
+	d := &webhookDispatcher{
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+		client: &http.Client{},
+		policy: policy,
+	}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// newWebhookMatcher creates the matcher for the rule. Returns an error if the
+// rule's filter is not a valid /servers query string.
+func newWebhookMatcher(rule models.WebhookRule) (*webhookMatcher, error) {
+	qry, err := url.ParseQuery(rule.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %s", err)
+	}
+	for key, vals := range qry {
+		var known *querystring
+		for i, qs := range getServersQueryStrings {
+			if strings.EqualFold(key, qs.name) {
+				known = &getServersQueryStrings[i]
+				break
+			}
+		}
+		if known == nil || known.notFilter {
+			return nil, fmt.Errorf("unknown filter: %s", key)
+		}
+		if known.boolonly && !strings.EqualFold(vals[0], "true") &&
+			!strings.EqualFold(vals[0], "false") {
+			return nil, fmt.Errorf("filter %s must be true or false", key)
+		}
+	}
+	m := &webhookMatcher{
+		ids:        make(map[int64]bool, len(rule.ServerIDs)),
+		minPlayers: rule.MinPlayers,
+		filters:    getSrvFilterFromQString(qry, getServersQueryStrings),
+	}
+	for _, id := range rule.ServerIDs {
+		m.ids[id] = true
+	}
+	return m, nil
+}
+
+func (m *webhookMatcher) matches(srv models.APIServer) bool {
+	if len(m.ids) != 0 && !m.ids[srv.ID] {
+		return false
+	}
+	if int(srv.Info.Players) < m.minPlayers {
+		return false
+	}
+	return matchesFilters(m.filters, srv)
+}
+
+// evaluate fires each enabled rule for the servers of the game's new list that
+// match it but did not match it (or were not in the list) after the previous
+// retrieval.
+func (d *webhookDispatcher) evaluate(game string, prev,
+	cur *models.APIServerList) {
+	if prev == nil {
+		return
+	}
+	rules, err := db.ServerDB.GetWebhooks(true)
+	if err != nil || len(rules) == 0 {
+		return
+	}
+	previous := make(map[string]models.APIServer, len(prev.Servers))
+	for _, s := range prev.Servers {
+		previous[s.Host] = s
+	}
+	for _, rule := range rules {
+		m, err := newWebhookMatcher(rule)
+		if err != nil {
+			logger.LogWebError(fmt.Errorf("webhook %d: %s", rule.ID, err))
+			continue
+		}
+		for _, srv := range cur.Servers {
+			if !m.matches(srv) {
+				continue
+			}
+			if old, ok := previous[srv.Host]; ok && m.matches(old) {
+				continue
+			}
+			d.enqueue(rule, models.WebhookPayload{
+				RuleID:    rule.ID,
+				RuleName:  rule.Name,
+				Game:      game,
+				Timestamp: cur.RetrievedTimeStamp,
+				Server:    srv,
+			})
+		}
+	}
+}
+
+// enqueue queues the delivery of the payload. Deliveries that do not fit in the
+// queue are dead-lettered.
+func (d *webhookDispatcher) enqueue(rule models.WebhookRule,
+	payload models.WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.LogWebError(err)
+		return
+	}
+	select {
+	case d.queue <- webhookDelivery{rule: rule, body: body}:
+	default:
+		d.deadLetter(webhookDelivery{rule: rule, body: body}, 0,
+			fmt.Errorf("webhook queue full"))
+	}
+}
+
+func (d *webhookDispatcher) work() {
+	for wd := range d.queue {
+		d.deliver(wd)
+	}
+}
+
+// deliver posts the delivery, re-trying it according to the dispatcher's policy
+// on connection errors, server errors and rate limiting. Deliveries that fail are
+// dead-lettered.
+func (d *webhookDispatcher) deliver(wd webhookDelivery) {
+	var err error
+	attempt := 0
+	for attempt < d.policy.MaxAttempts {
+		var retry bool
+		retry, err = d.post(wd, d.policy.Timeout(attempt))
+		attempt++
+		if err == nil || !retry {
+			break
+		}
+		if attempt < d.policy.MaxAttempts {
+			time.Sleep(d.policy.Backoff(attempt - 1))
+		}
+	}
+	if err != nil {
+		d.deadLetter(wd, attempt, err)
+	}
+}
+
+func (d *webhookDispatcher) post(wd webhookDelivery,
+	timeout time.Duration) (retry bool, err error) {
+	req, err := http.NewRequest("POST", wd.rule.URL, bytes.NewReader(wd.body))
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader,
+		"sha256="+signWebhook(wd.rule.Secret, timestamp, wd.body))
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode >= 500,
+		fmt.Errorf("%s responded with %s", wd.rule.URL, resp.Status)
+}
+
+func (d *webhookDispatcher) deadLetter(wd webhookDelivery, attempts int,
+	err error) {
+	logger.LogWebError(fmt.Errorf("webhook %d delivery failed after %d attempt(s): %s",
+		wd.rule.ID, attempts, err))
+	db.ServerDB.AddDeadLetter(models.WebhookDeadLetter{
+		RuleID:   wd.rule.ID,
+		URL:      wd.rule.URL,
+		Payload:  string(wd.body),
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().Unix(),
+	})
+}
+
+// signWebhook returns the hex-encoded HMAC-SHA256 of the timestamp, a period and
+// the body, keyed with the secret.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
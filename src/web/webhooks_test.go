@@ -0,0 +1,192 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syncore/a2sapi/src/config"
+	"github.com/syncore/a2sapi/src/db"
+	"github.com/syncore/a2sapi/src/models"
+	"github.com/syncore/a2sapi/src/steam"
+)
+
+var testWebhookPolicy = steam.RetryPolicy{
+	MaxAttempts:       3,
+	InitialTimeout:    time.Second,
+	MaxTimeout:        time.Second,
+	TimeoutMultiplier: 1,
+	InitialBackoff:    10 * time.Millisecond,
+	MaxBackoff:        10 * time.Millisecond,
+	BackoffMultiplier: 1,
+}
+
+func TestWebhookMatcher(t *testing.T) {
+	m, err := newWebhookMatcher(models.WebhookRule{
+		Filter: "games=QuakeLive&countries=SE&gametypes=CA"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating matcher: %s", err)
+	}
+	srv := models.APIServer{Game: "QuakeLive",
+		CountryInfo: models.DbCountry{CountryCode: "SE"},
+		Info:        models.SteamServerInfo{GameTypeShort: "CA"}}
+	if !m.matches(srv) {
+		t.Fatalf("Expected CA server in SE to match")
+	}
+	srv.Info.GameTypeShort = "FFA"
+	if m.matches(srv) {
+		t.Fatalf("Expected FFA server not to match")
+	}
+	m, _ = newWebhookMatcher(models.WebhookRule{ServerIDs: []int64{42},
+		MinPlayers: 6})
+	if m.matches(models.APIServer{ID: 42, Info: models.SteamServerInfo{Players: 5}}) ||
+		!m.matches(models.APIServer{ID: 42, Info: models.SteamServerInfo{Players: 6}}) ||
+		m.matches(models.APIServer{ID: 41, Info: models.SteamServerInfo{Players: 6}}) {
+		t.Fatalf("Expected only server 42 with at least 6 players to match")
+	}
+	for _, f := range []string{"bogus=1", "hasBots=maybe", "%zz"} {
+		if _, err := newWebhookMatcher(models.WebhookRule{Filter: f}); err == nil {
+			t.Fatalf("Expected filter %s to be invalid", f)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	var requests int32
+	received := make(chan models.WebhookPayload, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		// first attempt fails with a server error and is re-tried
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		sig := "sha256=" + signWebhook("s3cret", r.Header.Get(webhookTimestampHeader),
+			body)
+		if r.Header.Get(webhookSignatureHeader) != sig {
+			t.Errorf("Invalid webhook signature: %s", r.Header.Get(webhookSignatureHeader))
+		}
+		p := models.WebhookPayload{}
+		json.Unmarshal(body, &p)
+		received <- p
+	}))
+	defer hook.Close()
+
+	id, err := db.ServerDB.AddWebhook(models.WebhookRule{URL: hook.URL,
+		Secret: "s3cret", ServerIDs: []int64{4242}, MinPlayers: 6, Enabled: true})
+	if err != nil {
+		t.Fatalf("Unexpected error when adding webhook: %s", err)
+	}
+	defer db.ServerDB.DeleteWebhook(id)
+
+	d := newWebhookDispatcher(testWebhookPolicy, 1)
+	srv := models.APIServer{ID: 4242, Host: "10.0.0.42:27960",
+		Info: models.SteamServerInfo{Players: 4}}
+	prev := models.GetDefaultServerList()
+	prev.Servers = []models.APIServer{srv}
+	srv.Info.Players = 6
+	cur := models.GetDefaultServerList()
+	cur.Servers = []models.APIServer{srv}
+	d.evaluate("QuakeLive", prev, cur)
+	// still matching; does not fire again
+	d.evaluate("QuakeLive", cur, cur)
+
+	select {
+	case p := <-received:
+		if p.RuleID != id || p.Server.ID != 4242 || p.Game != "QuakeLive" {
+			t.Fatalf("Unexpected webhook payload: %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Webhook was not delivered")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("Expected 2 requests (1 re-try), got: %d", n)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	var requests int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer hook.Close()
+	d := newWebhookDispatcher(testWebhookPolicy, 0)
+	d.deliver(webhookDelivery{rule: models.WebhookRule{ID: 77, URL: hook.URL},
+		body: []byte("{}")})
+	// client errors are not re-tried
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("Expected 1 request, got: %d", n)
+	}
+	dls, err := db.ServerDB.GetDeadLetters(1)
+	if err != nil || len(dls) != 1 || dls[0].RuleID != 77 || dls[0].Attempts != 1 {
+		t.Fatalf("Expected dead letter for webhook 77, got: %+v, %v", dls, err)
+	}
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	srv := httptest.NewServer(newRouter())
+	defer srv.Close()
+	do := func(method, path, key, body string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error on %s %s: %s", method, path, err)
+		}
+		return resp
+	}
+	key := config.Config.WebConfig.AdminAPIKey
+	if resp := do("GET", "/webhooks", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected unauthorized without key, got: %d", resp.StatusCode)
+	}
+	if resp := do("POST", "/webhooks", key,
+		`{"url": "ftp://10.0.0.1"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected invalid URL to be refused, got: %d", resp.StatusCode)
+	}
+	resp := do("POST", "/webhooks", key,
+		`{"name": "ca", "url": "http://10.0.0.1/hook", "filter": "gametypes=CA"}`)
+	rule := models.WebhookRule{}
+	json.NewDecoder(resp.Body).Decode(&rule)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || rule.ID == 0 || !rule.Enabled ||
+		len(rule.Secret) != 64 {
+		t.Fatalf("Expected enabled rule with generated secret, got: %d %+v",
+			resp.StatusCode, rule)
+	}
+	path := "/webhooks?id=" + strconv.FormatInt(rule.ID, 10)
+	resp = do("PUT", path, key,
+		`{"url": "http://10.0.0.1/hook", "filter": "gametypes=FFA", "enabled": false}`)
+	updated := models.WebhookRule{}
+	json.NewDecoder(resp.Body).Decode(&updated)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || updated.Enabled ||
+		updated.Secret != "" || updated.Filter != "gametypes=FFA" {
+		t.Fatalf("Expected disabled rule without its secret, got: %d %+v",
+			resp.StatusCode, updated)
+	}
+	if resp := do("DELETE", path, key, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected rule to be deleted, got: %d", resp.StatusCode)
+	}
+	if resp := do("DELETE", path, key, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected missing rule, got: %d", resp.StatusCode)
+	}
+	resp = do("GET", "/webhooks/deadletters?limit=5", key, "")
+	dls := []models.WebhookDeadLetter{}
+	if err := json.NewDecoder(resp.Body).Decode(&dls); err != nil ||
+		resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected dead letters, got: %d %v", resp.StatusCode, err)
+	}
+	resp.Body.Close()
+}